@@ -0,0 +1,92 @@
+package tiny_kvDB
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// CompareAndSwap 当key当前的值等于old时写入new，返回是否写入成功
+// old为nil时表示要求key不存在
+func (db *DB) CompareAndSwap(key, old, new []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	value, err := db.get(key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return false, err
+	}
+	if errors.Is(err, ErrKeyNotFound) {
+		if old != nil {
+			return false, nil
+		}
+	} else if old == nil || !bytes.Equal(value, old) {
+		return false, nil
+	}
+	if _, err := db.put(key, new); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PutIfAbsent key不存在时才写入，返回是否写入成功
+func (db *DB) PutIfAbsent(key, value []byte) (bool, error) {
+	return db.CompareAndSwap(key, nil, value)
+}
+
+// DeleteIfEquals 当key当前的值等于value时删除，返回是否删除成功
+func (db *DB) DeleteIfEquals(key, value []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	current, err := db.get(key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !bytes.Equal(current, value) {
+		return false, nil
+	}
+	if _, err := db.delete(key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// IncrBy 将key对应的十进制整数加上delta并写回，key不存在时视为0，返回增加后的值
+func (db *DB) IncrBy(key []byte, delta int64) (int64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var num int64
+	value, err := db.get(key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	if err == nil {
+		if num, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, ErrValueIsNotInteger
+		}
+	}
+	// 判断是否溢出
+	if (delta > 0 && num > math.MaxInt64-delta) || (delta < 0 && num < math.MinInt64-delta) {
+		return 0, ErrIncrOverflow
+	}
+	num += delta
+	if _, err := db.put(key, []byte(strconv.FormatInt(num, 10))); err != nil {
+		return 0, err
+	}
+	return num, nil
+}
@@ -0,0 +1,102 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"tiny-kvDB/utils"
+)
+
+func TestDB_CompareAndSwap(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-atomic")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	key := utils.GetTestKey(1)
+	// key不存在时，old不为nil则失败
+	ok, err := db.CompareAndSwap(key, []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// PutIfAbsent
+	ok, err = db.PutIfAbsent(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.PutIfAbsent(key, []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// 值匹配时才替换
+	ok, err = db.CompareAndSwap(key, []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CompareAndSwap(key, []byte("a"), []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+
+	// DeleteIfEquals
+	ok, err = db.DeleteIfEquals(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.DeleteIfEquals(key, []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = db.CompareAndSwap(nil, nil, []byte("a"))
+	assert.Equal(t, ErrKeyIsEmpty, err)
+}
+
+func TestDB_IncrBy(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-atomic")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	key := utils.GetTestKey(1)
+	num, err := db.IncrBy(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), num)
+	num, err = db.IncrBy(key, -15)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-5), num)
+
+	// 并发自增不会丢失更新
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := db.IncrBy(key, 1)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("995"), val)
+
+	// 非整数
+	assert.Nil(t, db.Put(utils.GetTestKey(2), []byte("abc")))
+	_, err = db.IncrBy(utils.GetTestKey(2), 1)
+	assert.Equal(t, ErrValueIsNotInteger, err)
+
+	// 溢出
+	assert.Nil(t, db.Put(utils.GetTestKey(3), []byte("9223372036854775807")))
+	_, err = db.IncrBy(utils.GetTestKey(3), 1)
+	assert.Equal(t, ErrIncrOverflow, err)
+}
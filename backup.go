@@ -0,0 +1,221 @@
+package tiny_kvDB
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+	"tiny-kvDB/data"
+	"tiny-kvDB/utils"
+)
+
+// BackupManifestFileName 备份目录中的manifest文件，最后写入，存在说明备份已经完成
+const BackupManifestFileName = "backup-manifest"
+
+// BackupManifest 描述一次备份包含的文件
+type BackupManifest struct {
+	CreatedAt   time.Time     `json:"created_at"`
+	SeqNo       uint64        `json:"seq_no"`             // 备份时最新的序列号
+	MergeFileID uint32        `json:"merge_file_id"`      // 备份时已经生效的merge的nonMergeFileID，没有merge时为0
+	BaseDir     string        `json:"base_dir,omitempty"` // 增量备份依赖的备份目录
+	Files       []*BackupFile `json:"files"`
+}
+
+// BackupFile 备份中的一个文件
+type BackupFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// 文件所在的备份目录，为空表示就在当前备份目录中，增量备份没有拷贝的文件指向之前的备份
+	Dir string `json:"dir,omitempty"`
+}
+
+// Backup 在线备份数据库到dir
+// 只在封存活跃文件、记录文件列表时短暂加锁，拷贝文件时不阻塞读写
+// 备份目录中包含数据文件、hint索引、序列号文件和manifest，可以直接用Open打开
+func (db *DB) Backup(dir string) error {
+	_, err := db.backup(dir, "")
+	return err
+}
+
+// BackupIncremental 增量备份到dir，只拷贝baseDir中的备份之后新增或者变化的文件
+// 没有拷贝的文件在manifest中指向之前的备份，增量备份需要通过Restore恢复
+func (db *DB) BackupIncremental(dir, baseDir string) error {
+	_, err := db.backup(dir, baseDir)
+	return err
+}
+
+// ReadBackupManifest 读取备份目录中的manifest
+func ReadBackupManifest(dir string) (*BackupManifest, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, BackupManifestFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrBackupManifestNotFound
+		}
+		return nil, err
+	}
+	manifest := &BackupManifest{}
+	if err := json.Unmarshal(buf, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (db *DB) backup(dir, baseDir string) (*BackupManifest, error) {
+	var base *BackupManifest
+	if baseDir != "" {
+		var err error
+		if base, err = ReadBackupManifest(baseDir); err != nil {
+			return nil, err
+		}
+		if baseDir, err = filepath.Abs(baseDir); err != nil {
+			return nil, err
+		}
+	}
+	if err := prepareBackupDir(dir); err != nil {
+		return nil, err
+	}
+
+	manifest, err := db.snapshotFiles()
+	if err != nil {
+		return nil, err
+	}
+	manifest.BaseDir = baseDir
+
+	// 在锁外拷贝文件，记录的文件在数据库打开期间只会追加，拷贝前size个字节就是加锁时的内容
+	for _, file := range manifest.Files {
+		if base != nil && base.MergeFileID == manifest.MergeFileID {
+			// 之后没有发生过merge，名字和大小都相同的文件没有变化
+			if baseFile := base.file(file.Name); baseFile != nil && baseFile.Size == file.Size {
+				file.Dir = baseFile.Dir
+				if file.Dir == "" {
+					file.Dir = baseDir
+				}
+				continue
+			}
+		}
+		if err := utils.CopyFile(filepath.Join(db.options.DirPath, file.Name), filepath.Join(dir, file.Name), file.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeSeqNoFile(dir, manifest.SeqNo); err != nil {
+		return nil, err
+	}
+	if err := writeBackupManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// 加锁封存活跃文件，记录需要备份的文件和大小
+func (db *DB) snapshotFiles() (*BackupManifest, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.isClosed {
+		return nil, ErrDatabaseIsClosed
+	}
+
+	// 封存活跃文件，之后的写入都进入新的活跃文件
+	// 从节点的文件需要和主节点保持一致，不能切换活跃文件，只记录当前的写入位置
+	if db.activeFile != nil && db.activeFile.WriteOff > 0 && !db.readOnly {
+		if err := db.syncActiveFile(); err != nil {
+			return nil, err
+		}
+		db.olderFile[db.activeFile.FileID] = db.activeFile
+		if err := db.setActiveDataFile(); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := &BackupManifest{CreatedAt: time.Now(), SeqNo: atomic.LoadUint64(&db.seqNo)}
+	for _, dataFile := range db.olderFile {
+		size, err := dataFile.IOManager.Size()
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, &BackupFile{
+			Name: data.GetDataFileName("", dataFile.FileID),
+			Size: size,
+		})
+	}
+	if db.activeFile != nil && db.activeFile.WriteOff > 0 {
+		if err := db.syncActiveFile(); err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, &BackupFile{
+			Name: data.GetDataFileName("", db.activeFile.FileID),
+			Size: db.activeFile.WriteOff,
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Name < manifest.Files[j].Name
+	})
+
+	// 已经生效的merge留下的hint索引，数据库打开期间不会变化
+	if _, err := os.Stat(filepath.Join(db.options.DirPath, data.MergeFinishedFileName)); err == nil {
+		mergeFileID, err := getNonMergeFileID(db.options.DirPath)
+		if err != nil {
+			return nil, err
+		}
+		manifest.MergeFileID = mergeFileID
+		for _, name := range []string{data.HintFileName, data.MergeFinishedFileName} {
+			info, err := os.Stat(filepath.Join(db.options.DirPath, name))
+			if err != nil {
+				return nil, err
+			}
+			manifest.Files = append(manifest.Files, &BackupFile{Name: name, Size: info.Size()})
+		}
+	}
+	return manifest, nil
+}
+
+func (m *BackupManifest) file(name string) *BackupFile {
+	for _, file := range m.Files {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+// 备份目录必须为空，避免和之前的文件混在一起
+func prepareBackupDir(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return ErrBackupDirIsNotEmpty
+	}
+	return nil
+}
+
+// 先写临时文件再重命名，manifest要么完整存在要么不存在
+func writeBackupManifest(dir string, manifest *BackupManifest) error {
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpName := filepath.Join(dir, BackupManifestFileName+".tmp")
+	file, err := os.OpenFile(tmpName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filepath.Join(dir, BackupManifestFileName))
+}
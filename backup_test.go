@@ -0,0 +1,138 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"tiny-kvDB/utils"
+)
+
+func TestDB_Backup(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+
+	// 备份期间的写入不会被阻塞
+	stop := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 10000; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+		}
+	}()
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-test")
+	defer os.RemoveAll(backupDir)
+	assert.Nil(t, db.Backup(backupDir))
+	close(stop)
+	wg.Wait()
+
+	manifest, err := ReadBackupManifest(backupDir)
+	assert.Nil(t, err)
+	assert.True(t, manifest.SeqNo >= 2000)
+	assert.True(t, len(manifest.Files) > 1)
+	for _, file := range manifest.Files {
+		info, err := os.Stat(filepath.Join(backupDir, file.Name))
+		assert.Nil(t, err)
+		assert.Equal(t, file.Size, info.Size())
+	}
+
+	// 备份目录可以直接打开，包含备份时已经提交的全部数据
+	opts2 := DefaultOptions
+	opts2.DirPath = backupDir
+	db2, err := Open(opts2)
+	assert.Nil(t, err)
+	defer db2.Close()
+	assert.Equal(t, manifest.SeqNo, db2.LastSeq())
+	for i := 0; i < 2000; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	keys, err := db2.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, int(manifest.SeqNo), len(keys))
+
+	// 备份目录不为空
+	assert.Equal(t, ErrBackupDirIsNotEmpty, db.Backup(backupDir))
+}
+
+func TestDB_BackupIncremental(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	baseDir, _ := os.MkdirTemp("", "bitcask-go-backup-base")
+	defer os.RemoveAll(baseDir)
+	assert.Nil(t, db.Backup(baseDir))
+	base, err := ReadBackupManifest(baseDir)
+	assert.Nil(t, err)
+
+	for i := 2000; i < 2500; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	incrDir, _ := os.MkdirTemp("", "bitcask-go-backup-incr")
+	defer os.RemoveAll(incrDir)
+	assert.Nil(t, db.BackupIncremental(incrDir, baseDir))
+
+	// 只拷贝了新增的数据文件，其余文件指向基础备份
+	manifest, err := ReadBackupManifest(incrDir)
+	assert.Nil(t, err)
+	absBase, _ := filepath.Abs(baseDir)
+	assert.Equal(t, absBase, manifest.BaseDir)
+	assert.Equal(t, len(base.Files)+1, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if base.file(file.Name) != nil {
+			assert.Equal(t, absBase, file.Dir)
+			_, err := os.Stat(filepath.Join(incrDir, file.Name))
+			assert.True(t, os.IsNotExist(err))
+		} else {
+			assert.Equal(t, "", file.Dir)
+			_, err := os.Stat(filepath.Join(incrDir, file.Name))
+			assert.Nil(t, err)
+		}
+	}
+	assert.True(t, manifest.SeqNo > base.SeqNo)
+	assert.True(t, manifest.CreatedAt.After(base.CreatedAt) || manifest.CreatedAt.Equal(base.CreatedAt))
+	assert.True(t, time.Since(manifest.CreatedAt) < time.Minute)
+
+	_, err = ReadBackupManifest(dir)
+	assert.Equal(t, ErrBackupManifestNotFound, err)
+
+	// 增量备份通过Restore恢复
+	target, _ := os.MkdirTemp("", "bitcask-go-backup-restore")
+	defer os.RemoveAll(target)
+	assert.Nil(t, Restore(incrDir, target, RestoreOptions{}))
+	opts2 := DefaultOptions
+	opts2.DirPath = target
+	db2, err := Open(opts2)
+	assert.Nil(t, err)
+	defer db2.Close()
+	keys, err := db2.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 2500, len(keys))
+	assert.Equal(t, manifest.SeqNo, db2.LastSeq())
+}
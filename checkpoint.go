@@ -0,0 +1,128 @@
+package tiny_kvDB
+
+import (
+	"os"
+	"sync/atomic"
+	"tiny-kvDB/data"
+	"tiny-kvDB/fio"
+	"tiny-kvDB/index"
+	"tiny-kvDB/utils"
+)
+
+// checkpointFile 检查点需要的一个数据文件
+type checkpointFile struct {
+	fileID uint32
+	size   int64 // 只拷贝前size个字节，为-1时硬链接整个文件
+}
+
+// Checkpoint 在dir中创建数据库的检查点，可以作为独立的数据库直接打开
+// 封存活跃文件之后，不可变的数据文件通过硬链接放入dir，不需要拷贝数据
+// 同时写入覆盖全部数据的hint文件和序列号文件，打开检查点时不需要遍历数据文件
+// 检查点和数据库不共享可写的文件，之后两者的写入互不影响
+func (db *DB) Checkpoint(dir string) error {
+	if err := prepareBackupDir(dir); err != nil {
+		return err
+	}
+
+	files, indexIter, seqNo, err := db.snapshotCheckpoint()
+	if err != nil {
+		return err
+	}
+	if indexIter == nil {
+		// 数据库为空
+		return writeSeqNoFile(dir, seqNo)
+	}
+	defer indexIter.Close()
+
+	var maxFileID uint32
+	for _, file := range files {
+		src := data.GetDataFileName(db.options.DirPath, file.fileID)
+		dest := data.GetDataFileName(dir, file.fileID)
+		if file.size >= 0 {
+			if err := utils.CopyFile(src, dest, file.size); err != nil {
+				return err
+			}
+		} else if err := os.Link(src, dest); err != nil {
+			// 不在同一个文件系统中时无法硬链接，退化为拷贝
+			info, statErr := os.Stat(src)
+			if statErr != nil {
+				return err
+			}
+			if err := utils.CopyFile(src, dest, info.Size()); err != nil {
+				return err
+			}
+		}
+		if file.fileID > maxFileID {
+			maxFileID = file.fileID
+		}
+	}
+
+	// 全部索引写入hint文件，数据文件都在merge完成的边界之前，打开时只加载hint文件
+	hintFile, err := data.OpenHintFile(dir)
+	if err != nil {
+		return err
+	}
+	for indexIter.Rewind(); indexIter.Valid(); indexIter.Next() {
+		if err := hintFile.WriteHintRecord(indexIter.Key(), indexIter.Value()); err != nil {
+			_ = hintFile.Close()
+			return err
+		}
+	}
+	if err := hintFile.Sync(); err != nil {
+		_ = hintFile.Close()
+		return err
+	}
+	if err := hintFile.Close(); err != nil {
+		return err
+	}
+	if err := writeMergeFinishedFile(dir, maxFileID+1); err != nil {
+		return err
+	}
+
+	// 新建空的活跃文件，否则打开检查点时会向硬链接的文件追加数据
+	activeFile, err := data.OpenDataFile(dir, maxFileID+1, fio.StandardFileIO)
+	if err != nil {
+		return err
+	}
+	if err := activeFile.Close(); err != nil {
+		return err
+	}
+	return writeSeqNoFile(dir, seqNo)
+}
+
+// 加锁封存活跃文件，记录需要的数据文件、索引的快照和序列号
+func (db *DB) snapshotCheckpoint() ([]*checkpointFile, index.Iterator, uint64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.isClosed {
+		return nil, nil, 0, ErrDatabaseIsClosed
+	}
+	seqNo := atomic.LoadUint64(&db.seqNo)
+	if db.activeFile == nil {
+		return nil, nil, seqNo, nil
+	}
+
+	var files []*checkpointFile
+	if db.activeFile.WriteOff > 0 {
+		if err := db.syncActiveFile(); err != nil {
+			return nil, nil, 0, err
+		}
+		if db.readOnly {
+			// 从节点不能切换活跃文件，只拷贝已经写入的部分
+			files = append(files, &checkpointFile{fileID: db.activeFile.FileID, size: db.activeFile.WriteOff})
+		} else {
+			db.olderFile[db.activeFile.FileID] = db.activeFile
+			if err := db.setActiveDataFile(); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+	}
+	for fileID := range db.olderFile {
+		files = append(files, &checkpointFile{fileID: fileID, size: -1})
+	}
+	indexIter, err := db.index.Iterator(false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return files, indexIter, seqNo, nil
+}
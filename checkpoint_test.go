@@ -0,0 +1,119 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"tiny-kvDB/data"
+	"tiny-kvDB/utils"
+)
+
+func TestDB_Checkpoint(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put([]byte("batch"), []byte("value")))
+	assert.Nil(t, wb.Commit())
+	seqNo := db.LastSeq()
+
+	checkpointDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-target")
+	defer os.RemoveAll(checkpointDir)
+	assert.Nil(t, db.Checkpoint(checkpointDir))
+
+	// 数据文件是硬链接，不是拷贝
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	var linked int
+	for _, entry := range entries {
+		src, err := os.Stat(filepath.Join(dir, entry.Name()))
+		assert.Nil(t, err)
+		dest, err := os.Stat(filepath.Join(checkpointDir, entry.Name()))
+		if err == nil && os.SameFile(src, dest) {
+			linked++
+		}
+	}
+	assert.True(t, linked > 1)
+
+	opts2 := DefaultOptions
+	opts2.DirPath = checkpointDir
+	db2, err := Open(opts2)
+	assert.Nil(t, err)
+	defer db2.Close()
+	assert.Equal(t, seqNo, db2.LastSeq())
+	keys, err := db2.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 1901, len(keys))
+	for i := 0; i < 2000; i++ {
+		want, err1 := db.Get(utils.GetTestKey(i))
+		got, err2 := db2.Get(utils.GetTestKey(i))
+		assert.Equal(t, err1, err2)
+		assert.Equal(t, want, got)
+	}
+	value, err := db2.Get([]byte("batch"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	// 检查点和数据库之后的写入互不影响
+	assert.Nil(t, db2.Put([]byte("only-checkpoint"), []byte("1")))
+	assert.Nil(t, db.Put([]byte("only-db"), []byte("1")))
+	_, err = db.Get([]byte("only-checkpoint"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get([]byte("only-db"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	for i := 100; i < 2000; i++ {
+		_, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	// 检查点重新打开后写入的数据仍然存在
+	assert.Nil(t, db2.Close())
+	db2, err = Open(opts2)
+	assert.Nil(t, err)
+	value, err = db2.Get([]byte("only-checkpoint"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+	keys, err = db2.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 1902, len(keys))
+
+	assert.Equal(t, ErrBackupDirIsNotEmpty, db.Checkpoint(checkpointDir))
+}
+
+func TestDB_CheckpointEmpty(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	checkpointDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-target")
+	defer os.RemoveAll(checkpointDir)
+	assert.Nil(t, db.Checkpoint(checkpointDir))
+	_, err = os.Stat(filepath.Join(checkpointDir, data.SeqNoFileName))
+	assert.Nil(t, err)
+
+	opts2 := DefaultOptions
+	opts2.DirPath = checkpointDir
+	db2, err := Open(opts2)
+	assert.Nil(t, err)
+	defer db2.Close()
+	keys, err := db2.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(keys))
+	assert.Nil(t, db2.Put([]byte("key"), []byte("value")))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	tiny_kvDB "tiny-kvDB"
+	"tiny-kvDB/redis"
+)
+
+// kvdump 导出和导入数据库中的数据
+//
+//	kvdump export -dir <数据目录> [-prefix p] [-start s] [-end e] [-redis] [-o 文件]
+//	kvdump import -dir <数据目录> [-i 文件]
+//
+// 不指定文件时使用标准输出和标准输入，格式见tiny_kvDB.DB.Export
+// 导出redis服务的数据目录时指定-redis，导出key的过期时间，导入时跳过已经过期的key
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kvdump: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: kvdump export -dir <dir> [-prefix p] [-start s] [-end e] [-redis] [-o file]")
+	fmt.Fprintln(os.Stderr, "       kvdump import -dir <dir> [-i file]")
+	os.Exit(2)
+}
+
+func openDB(dir string) (*tiny_kvDB.DB, error) {
+	if dir == "" {
+		return nil, tiny_kvDB.ErrDatabaseDirIsEmpty
+	}
+	options := tiny_kvDB.DefaultOptions
+	options.DirPath = dir
+	return tiny_kvDB.Open(options)
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", "", "数据目录")
+	prefix := fs.String("prefix", "", "只导出前缀为prefix的key")
+	start := fs.String("start", "", "只导出不小于start的key")
+	end := fs.String("end", "", "只导出小于end的key")
+	isRedis := fs.Bool("redis", false, "数据目录是redis服务的数据，导出key的过期时间")
+	output := fs.String("o", "", "输出文件，默认标准输出")
+	_ = fs.Parse(args)
+
+	db, err := openDB(*dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	options := tiny_kvDB.ExportOptions{
+		Prefix: []byte(*prefix),
+		Start:  []byte(*start),
+		End:    []byte(*end),
+	}
+	if *isRedis {
+		options.ExpireAt = redis.DumpExpireAt
+	}
+	writer := bufio.NewWriter(w)
+	count, err := db.Export(writer, options)
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d keys\n", count)
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dir := fs.String("dir", "", "数据目录")
+	input := fs.String("i", "", "输入文件，默认标准输入")
+	_ = fs.Parse(args)
+
+	db, err := openDB(*dir)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+	count, err := db.Import(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d keys\n", count)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	tiny_kvDB "tiny-kvDB"
+	tiny_kvDB_redis "tiny-kvDB/redis"
+)
+
+// rdsmigrate 把redis数据结构服务旧编排的数据目录迁移到新的空目录
+//
+//	rdsmigrate -src <旧数据目录> -dst <新数据目录>
+//
+// 迁移完成之后用新目录替换旧目录，见tiny_kvDB_redis.MigrateLegacyLayout
+func main() {
+	src := flag.String("src", "", "旧编排的数据目录")
+	dst := flag.String("dst", "", "迁移到的数据目录，必须为空")
+	flag.Parse()
+	if *src == "" || *dst == "" {
+		fmt.Fprintln(os.Stderr, "usage: rdsmigrate -src <dir> -dst <dir>")
+		os.Exit(2)
+	}
+	if err := run(*src, *dst); err != nil {
+		fmt.Fprintf(os.Stderr, "rdsmigrate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func openDB(dir string) (*tiny_kvDB.DB, error) {
+	options := tiny_kvDB.DefaultOptions
+	options.DirPath = dir
+	return tiny_kvDB.Open(options)
+}
+
+func run(src, dst string) error {
+	srcDB, err := openDB(src)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+	dstDB, err := openDB(dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+
+	count, err := tiny_kvDB_redis.MigrateLegacyLayout(srcDB, dstDB)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "migrated %d keys\n", count)
+	return nil
+}
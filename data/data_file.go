@@ -131,7 +131,7 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
 	recordSize := keySize + valueSize + headerSize
 
-	logRecord := &LogRecord{Type: header.recordType}
+	logRecord := &LogRecord{Type: header.recordType, AutoCommit: header.autoCommit, Timestamp: header.timestamp}
 	// 读取实际的key和value
 	if keySize > 0 || valueSize > 0 {
 		kvBuf, err := df.readNBtyes(keySize+valueSize, offset+headerSize)
@@ -11,9 +11,17 @@ const (
 	LogRecordNormal LogRecordType = iota
 	LogRecordDeleted
 	LogRecordTxnFinished
+	LogRecordMerge // merge操作数，value中记录了同一个key上一条记录的位置
 )
 
-const maxLogRecordHeaderSize = 15
+const maxLogRecordHeaderSize = 15 + binary.MaxVarintLen64
+
+// 记录类型字节的最高位，标识记录不属于任何事务，写入即提交
+// 旧版本写入的记录不会设置该位，仍然按照key中的序列号是否为0区分
+const autoCommitFlag byte = 1 << 7
+
+// 记录类型字节的次高位，标识头部在valueSize之后带有写入时间
+const timestampFlag byte = 1 << 6
 
 // LogRecordPos 数据内存索引，主要描述数据在磁盘上的位置
 type LogRecordPos struct {
@@ -25,17 +33,21 @@ type LogRecordPos struct {
 // LogRecord 写入到数据文件的记录
 // 因为数据是追加写入的，类似于日志，故称之为日志记录
 type LogRecord struct {
-	Key   []byte
-	Value []byte
-	Type  LogRecordType
+	Key        []byte
+	Value      []byte
+	Type       LogRecordType
+	AutoCommit bool  // 非事务写入，key中携带了自己的序列号
+	Timestamp  int64 // 写入时间（UnixNano），旧版本写入的记录为0
 }
 
 // LogRecord的头部信息
 type logRecordHeader struct {
 	crc        uint32        // crc校验值
 	recordType LogRecordType // 标识是否删除
+	autoCommit bool          // 是否是非事务写入
 	keySize    uint32        // key的长度
 	valueSize  uint32        // value的长度
+	timestamp  int64         // 写入时间
 }
 
 // TransactionRecord 事务记录，存储logRecord和索引信息
@@ -44,18 +56,27 @@ type TransactionRecord struct {
 	Pos    *LogRecordPos
 }
 
-// logRecord 4    1           5        5         key     value
+// logRecord 4    1           5        5          10(可选)    key     value
 //
-//	crc  recordType  keySize  valueSize
+//	crc  recordType  keySize  valueSize  timestamp
 //
 // EncodeLogRecord 对应logRecord进行编码，根据logRecord自动补充上头部信息编码存到disk中
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	headerBytes := make([]byte, maxLogRecordHeaderSize)
 	headerBytes[4] = logRecord.Type
+	if logRecord.AutoCommit {
+		headerBytes[4] |= autoCommitFlag
+	}
+	if logRecord.Timestamp != 0 {
+		headerBytes[4] |= timestampFlag
+	}
 	index := 5
 	// 装 keySize 和 valueSize 到headerBytes中
 	index += binary.PutVarint(headerBytes[index:], int64(len(logRecord.Key)))
 	index += binary.PutVarint(headerBytes[index:], int64(len(logRecord.Value)))
+	if logRecord.Timestamp != 0 {
+		index += binary.PutVarint(headerBytes[index:], logRecord.Timestamp)
+	}
 
 	sumLen := index + len(logRecord.Key) + len(logRecord.Value)
 	retBytes := make([]byte, sumLen)
@@ -81,13 +102,38 @@ func EncodeLogRecordPos(pos *LogRecordPos) []byte {
 	return buf[:index]
 }
 
+// EncodeMergeOperand 编码merge操作数记录的value：上一条记录位置的长度 + 上一条记录的位置 + 操作数
+// prev为nil表示key之前不存在
+func EncodeMergeOperand(prev *LogRecordPos, operand []byte) []byte {
+	var prevBuf []byte
+	if prev != nil {
+		prevBuf = EncodeLogRecordPos(prev)
+	}
+	buf := make([]byte, binary.MaxVarintLen32+len(prevBuf)+len(operand))
+	index := binary.PutUvarint(buf, uint64(len(prevBuf)))
+	index += copy(buf[index:], prevBuf)
+	index += copy(buf[index:], operand)
+	return buf[:index]
+}
+
+// DecodeMergeOperand 解码merge操作数记录的value
+func DecodeMergeOperand(buf []byte) (*LogRecordPos, []byte) {
+	prevLen, n := binary.Uvarint(buf)
+	var prev *LogRecordPos
+	if prevLen > 0 {
+		prev = DecodeLogRecordPos(buf[n : n+int(prevLen)])
+	}
+	return prev, buf[n+int(prevLen):]
+}
+
 func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	if len(buf) <= 4 { // crc未传到
 		return nil, 0
 	}
 	header := &logRecordHeader{
 		crc:        binary.LittleEndian.Uint32(buf[:4]),
-		recordType: buf[4],
+		recordType: buf[4] &^ (autoCommitFlag | timestampFlag),
+		autoCommit: buf[4]&autoCommitFlag != 0,
 	}
 	// 从字节流中取出keySize和valueSize
 	index := 5
@@ -97,6 +143,11 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	index += n
 	header.keySize = uint32(keySize)
 	header.valueSize = uint32(valueSize)
+	if buf[4]&timestampFlag != 0 {
+		timestamp, n := binary.Varint(buf[index:])
+		index += n
+		header.timestamp = timestamp
+	}
 	return header, int64(index)
 }
 
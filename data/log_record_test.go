@@ -90,3 +90,67 @@ func TestGetLogRecordCrc(t *testing.T) {
 	assert.Equal(t, crc, uint32(240712713))
 
 }
+
+func TestEncodeMergeOperand(t *testing.T) {
+	// 没有上一条记录
+	buf := EncodeMergeOperand(nil, []byte("operand"))
+	prev, operand := DecodeMergeOperand(buf)
+	assert.Nil(t, prev)
+	assert.Equal(t, []byte("operand"), operand)
+
+	pos := &LogRecordPos{Fid: 3, Offset: 1024, Size: 28}
+	buf = EncodeMergeOperand(pos, []byte("operand"))
+	prev, operand = DecodeMergeOperand(buf)
+	assert.Equal(t, pos, prev)
+	assert.Equal(t, []byte("operand"), operand)
+
+	// 空操作数
+	prev, operand = DecodeMergeOperand(EncodeMergeOperand(pos, nil))
+	assert.Equal(t, pos, prev)
+	assert.Equal(t, 0, len(operand))
+}
+
+func TestEncodeLogRecordAutoCommit(t *testing.T) {
+	rec := &LogRecord{
+		Key:        []byte("name"),
+		Value:      []byte("bitcask-go"),
+		Type:       LogRecordDeleted,
+		AutoCommit: true,
+	}
+	buf, size := EncodeLogRecord(rec)
+	header, headerSize := decodeLogRecordHeader(buf)
+	assert.Equal(t, LogRecordDeleted, header.recordType)
+	assert.True(t, header.autoCommit)
+	assert.Equal(t, size, headerSize+int64(header.keySize)+int64(header.valueSize))
+
+	// 旧版本的记录没有标记位
+	rec.AutoCommit = false
+	buf, _ = EncodeLogRecord(rec)
+	header, _ = decodeLogRecordHeader(buf)
+	assert.Equal(t, LogRecordDeleted, header.recordType)
+	assert.False(t, header.autoCommit)
+}
+
+func TestEncodeLogRecordTimestamp(t *testing.T) {
+	rec := &LogRecord{
+		Key:        []byte("name"),
+		Value:      []byte("bitcask-go"),
+		Type:       LogRecordNormal,
+		AutoCommit: true,
+		Timestamp:  1700000000123456789,
+	}
+	buf, size := EncodeLogRecord(rec)
+	header, headerSize := decodeLogRecordHeader(buf)
+	assert.Equal(t, LogRecordNormal, header.recordType)
+	assert.True(t, header.autoCommit)
+	assert.Equal(t, rec.Timestamp, header.timestamp)
+	assert.Equal(t, size, headerSize+int64(header.keySize)+int64(header.valueSize))
+	assert.Equal(t, rec.Key, buf[headerSize:headerSize+int64(header.keySize)])
+
+	// 没有写入时间的记录和旧版本的编码一致
+	rec.Timestamp = 0
+	buf, _ = EncodeLogRecord(rec)
+	header, headerSize = decodeLogRecordHeader(buf)
+	assert.Equal(t, int64(0), header.timestamp)
+	assert.Equal(t, int64(7), headerSize)
+}
@@ -1,7 +1,6 @@
 package tiny_kvDB
 
 import (
-	"fmt"
 	"github.com/gofrs/flock"
 	"io"
 	"os"
@@ -10,6 +9,8 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"tiny-kvDB/data"
 	"tiny-kvDB/fio"
 	"tiny-kvDB/index"
@@ -28,13 +29,25 @@ type DB struct {
 	activeFile      *data.DataFile            // 当前活跃文件，用于写入
 	olderFile       map[uint32]*data.DataFile // 旧的数据文件，仅用于读
 	index           index.Indexer             // 内存索引
-	seqNo           uint64                    // 事务序列号，全局递增
+	seqNo           uint64                    // 写入序列号，所有提交（包括事务和非事务写入）全局递增
 	isMerging       bool                      // 是否正在merge
 	seqNoFileExists bool                      // seqNo文件是否存在
 	isInitial       bool                      // 是否是第一次初始化当前数据库
 	fileLock        *flock.Flock              // 文件所保证多数据间的互斥
 	bytesWrite      uint                      // 累计写了多少字节
 	reclaimSize     int64                     // 表示有多少数据是无效的
+	refMu           *sync.Mutex               // 保护数据文件引用计数
+	fileRefs        map[uint32]int            // 数据文件被迭代器引用的次数，引用期间不能关闭或删除
+	isClosed        bool                      // 数据库是否已经关闭，关闭后被引用的文件由最后一个引用者关闭
+	mergeBoundary   uint32                    // 小于该ID的数据文件会被merge重写，merge操作数不能再引用其中的位置
+	watchers        map[*Watcher]struct{}     // 订阅已提交写入的订阅者
+	readOnly        bool                      // 只读模式，复制的从节点不能直接写入
+	appendSignal    chan struct{}             // 有新数据写入时关闭，用于唤醒复制连接
+	metrics         *metrics                  // 运行指标
+	listener        EventListener             // 生命周期事件的回调，不会为空
+	logger          Logger                    // 日志输出，不会为空
+	// 加载数据文件后仍未完成的事务记录，从节点继续复制时事务剩余的部分会接在后面
+	pendingTxnRecords map[uint64][]*data.TransactionRecord
 }
 
 // Stat 存储引擎统计状态
@@ -46,7 +59,7 @@ type Stat struct {
 }
 
 // Stat 返回数据库的相关统计信息
-func (db *DB) Stat() *Stat {
+func (db *DB) Stat() (*Stat, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	var dataFiles = uint32(len(db.olderFile))
@@ -55,22 +68,18 @@ func (db *DB) Stat() *Stat {
 	}
 	dirSize, err := utils.DirSize(db.options.DirPath)
 	if err != nil {
-		panic(fmt.Sprintf("failed to get dir size : %v", err))
+		return nil, err
+	}
+	keyNum, err := db.index.Size()
+	if err != nil {
+		return nil, err
 	}
 	return &Stat{
-		KeyNum:          uint32(db.index.Size()),
+		KeyNum:          uint32(keyNum),
 		DataFileNum:     dataFiles,
 		ReclaimableSize: db.reclaimSize,
 		DiskSize:        dirSize,
-	}
-}
-
-// Backup 备份数据库，将数据文件拷贝到新的目录
-func (db *DB) Backup(dir string) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	// 排除文件锁文件
-	return utils.CopyDir(db.options.DirPath, dir, []string{fileLockName})
+	}, nil
 }
 
 // Open 打开kv存储引擎
@@ -78,6 +87,7 @@ func Open(option Options) (*DB, error) {
 	if err := checkOptions(option); err != nil {
 		return nil, err
 	}
+	start := time.Now()
 
 	var isInit bool
 	// 判断目录是否存在，如果不存在的话就创建这个目录
@@ -108,13 +118,30 @@ func Open(option Options) (*DB, error) {
 		isInit = true
 	}
 
+	indexer, err := index.NewIndexer(option.IndexType, option.DirPath, option.SyncWrites)
+	if err != nil {
+		_ = fileLock.Unlock()
+		return nil, err
+	}
+
 	db := &DB{
 		options:   option,
 		mu:        new(sync.RWMutex),
 		olderFile: make(map[uint32]*data.DataFile),
-		index:     index.NewIndexer(option.IndexType, option.DirPath, option.SyncWrites),
+		index:     indexer,
 		isInitial: isInit,
 		fileLock:  fileLock,
+		refMu:     new(sync.Mutex),
+		fileRefs:  make(map[uint32]int),
+		metrics:   newMetrics(),
+		listener:  option.EventListener,
+		logger:    option.Logger,
+	}
+	if db.listener == nil {
+		db.listener = NopEventListener{}
+	}
+	if db.logger == nil {
+		db.logger = nopLogger{}
 	}
 
 	// 加载merge数据目录
@@ -127,12 +154,13 @@ func Open(option Options) (*DB, error) {
 		return nil, err
 	}
 
+	// 加载关闭时保存的写入序列号，hint文件中的记录不会重新遍历，序列号需要从这里恢复
+	if err := db.loadSeqNo(); err != nil {
+		return nil, err
+	}
+
 	// 如果是B+树索引，就无需从数据文件中加载索引了
 	if option.IndexType == BPlusTree {
-		// 定位事务序列号
-		if err := db.loadSeqNo(); err != nil {
-			return nil, err
-		}
 		// 不会执行loadIndexerFromDataFile函数，故不会更新活跃文件的offset
 		// 此时要自己手动设置
 		if db.activeFile != nil {
@@ -160,6 +188,12 @@ func Open(option Options) (*DB, error) {
 			return nil, err
 		}
 	}
+	keyNum, err := db.index.Size()
+	if err != nil {
+		return nil, err
+	}
+	db.logger.Log(LogInfo, "database opened", "dir", option.DirPath, "keys", keyNum,
+		"data_files", len(db.fileIDs), "seq", db.seqNo, "duration", time.Since(start))
 	return db, nil
 }
 
@@ -215,7 +249,7 @@ func (db *DB) loadIndexerFromDataFile() error {
 	hasMerge, nonMergeFileID := false, uint32(0)
 	mergeFinishedFileName := filepath.Join(db.options.DirPath, data.MergeFinishedFileName)
 	if _, err := os.Stat(mergeFinishedFileName); err == nil {
-		fileID, err := db.getNonMergeFileID(db.options.DirPath)
+		fileID, err := getNonMergeFileID(db.options.DirPath)
 		if err != nil {
 			return err
 		}
@@ -223,29 +257,22 @@ func (db *DB) loadIndexerFromDataFile() error {
 		nonMergeFileID = fileID
 	}
 
-	// 更新内存索引函数
-	updateIndex := func(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) {
-		var (
-			oldPos *data.LogRecordPos
-		)
-		// 如果当前的记录是被删除的
-		if typ == data.LogRecordDeleted {
-			oldPos, _ = db.index.Delete(key)
-			db.reclaimSize += int64(pos.Size)
-		} else {
-			oldPos = db.index.Put(key, pos)
-		}
-		if oldPos != nil {
-			db.reclaimSize += int64(oldPos.Size)
-		}
-	}
-
 	//暂存事务的数据
 	transactionRecords := make(map[uint64][]*data.TransactionRecord)
-	var currentSeqNo = nonTransactionSeqNo
+
+	// 需要遍历的数据文件数量，用于通知加载进度
+	total, loaded := len(db.fileIDs), 0
+	if hasMerge {
+		total = 0
+		for _, fid := range db.fileIDs {
+			if uint32(fid) >= nonMergeFileID {
+				total++
+			}
+		}
+	}
 
 	// 遍历所有的dataFile
-	for i, fid := range db.fileIDs {
+	for _, fid := range db.fileIDs {
 		fileID := uint32(fid)
 
 		// 当前fileID比nonMergeFileID，此时索引已经从hint文件加载过了
@@ -261,78 +288,170 @@ func (db *DB) loadIndexerFromDataFile() error {
 		}
 
 		// 通过索引从头开始遍历
-		var offset int64 = 0
-		for {
-			logRecord, size, err := dataFile.ReadLogRecord(offset)
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				return err
+		offset, err := db.applyDataFile(dataFile, 0, transactionRecords)
+		if err != nil {
+			return err
+		}
+
+		// 当前如果是活跃文件，需要重新修改活跃文件的写入指针
+		if fileID == db.activeFile.FileID {
+			db.activeFile.WriteOff = offset
+		}
+		loaded++
+		db.listener.OnRecoveryProgress(RecoveryProgressInfo{FileID: fileID, Loaded: loaded, Total: total, RecordSize: offset})
+	}
+	if len(transactionRecords) > 0 {
+		db.pendingTxnRecords = transactionRecords
+	}
+	return nil
+}
+
+// applyDataFile 从offset开始依次读取数据文件中的记录并更新内存索引，返回读取结束的位置
+// 未完成的事务暂存在transactionRecords中，加载数据文件和复制共用这一解码流程
+func (db *DB) applyDataFile(dataFile *data.DataFile, offset int64, transactionRecords map[uint64][]*data.TransactionRecord) (int64, error) {
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
 			}
-			//构建内存索引并保存
-			logRecordPos := &data.LogRecordPos{Fid: fileID, Offset: offset, Size: uint32(size)}
-
-			// 解析当前key的事务序列号
-			realKey, seqNo := parseLogRecordKey(logRecord.Key)
-
-			if seqNo == nonTransactionSeqNo { // 如果不是事务提交的数据
-				updateIndex(realKey, logRecord.Type, logRecordPos)
-			} else { // 事务提交的数据
-				// 事务完成，更新所有数据
-				if logRecord.Type == data.LogRecordTxnFinished {
-					// tips: 索引的key里面不保存事务信息，此时的key都是去除seqNo的realKey
-					for _, txnRecord := range transactionRecords[seqNo] {
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
-					}
-					delete(transactionRecords, seqNo)
-				} else { // 提交到缓存区里
-					logRecord.Key = realKey
-					transactionRecords[seqNo] = append(transactionRecords[seqNo], &data.TransactionRecord{
-						Record: logRecord,
-						Pos:    logRecordPos,
-					})
-				}
+			if err == data.ErrInvalidCRC {
+				db.reportCorruption(dataFile.FileID, offset, err)
 			}
+			return 0, err
+		}
+		//构建内存索引并保存
+		logRecordPos := &data.LogRecordPos{Fid: dataFile.FileID, Offset: offset, Size: uint32(size)}
 
-			// 更新事务序列号
-			if seqNo > currentSeqNo {
-				currentSeqNo = seqNo
+		// 解析当前key的事务序列号
+		realKey, seqNo := parseLogRecordKey(logRecord.Key)
+
+		if seqNo == nonTransactionSeqNo || logRecord.AutoCommit { // 如果不是事务提交的数据
+			if err := db.updateIndex(realKey, logRecord.Type, logRecordPos); err != nil {
+				return 0, err
 			}
+		} else { // 事务提交的数据
+			// 事务完成，更新所有数据
+			if logRecord.Type == data.LogRecordTxnFinished {
+				// tips: 索引的key里面不保存事务信息，此时的key都是去除seqNo的realKey
+				for _, txnRecord := range transactionRecords[seqNo] {
+					if err := db.updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos); err != nil {
+						return 0, err
+					}
+				}
+				delete(transactionRecords, seqNo)
+			} else { // 提交到缓存区里
+				logRecord.Key = realKey
+				transactionRecords[seqNo] = append(transactionRecords[seqNo], &data.TransactionRecord{
+					Record: logRecord,
+					Pos:    logRecordPos,
+				})
+			}
+		}
 
-			offset += size
+		// 更新序列号
+		if seqNo > atomic.LoadUint64(&db.seqNo) {
+			atomic.StoreUint64(&db.seqNo, seqNo)
 		}
 
-		// 当前如果是活跃文件，需要重新修改活跃文件的写入指针
-		if uint32(i) == db.activeFile.FileID {
-			db.activeFile.WriteOff = offset
+		offset += size
+	}
+	return offset, nil
+}
+
+// 更新内存索引
+func (db *DB) updateIndex(key []byte, typ data.LogRecordType, pos *data.LogRecordPos) error {
+	var (
+		oldPos *data.LogRecordPos
+		err    error
+	)
+	// 如果当前的记录是被删除的
+	if typ == data.LogRecordDeleted {
+		if oldPos, _, err = db.index.Delete(key); err != nil {
+			return err
+		}
+		db.reclaimSize += int64(pos.Size)
+	} else if typ == data.LogRecordMerge {
+		// merge操作数不会让之前的记录失效，链表的大小累加到最新的位置上
+		prev, err := db.index.Get(key)
+		if err != nil {
+			return err
+		}
+		if prev != nil {
+			pos.Size += prev.Size
+		}
+		if _, err := db.index.Put(key, pos); err != nil {
+			return err
 		}
+	} else if oldPos, err = db.index.Put(key, pos); err != nil {
+		return err
+	}
+	if oldPos != nil {
+		db.reclaimSize += int64(oldPos.Size)
 	}
-	db.seqNo = currentSeqNo
 	return nil
 }
 
-// 在B+树索引模式下加载事务序列号
+// 加载写入序列号
 func (db *DB) loadSeqNo() error {
-	fileName := filepath.Join(db.options.DirPath, data.SeqNoFileName)
+	seqNo, ok, err := readSeqNoFile(db.options.DirPath)
+	if err != nil || !ok {
+		return err
+	}
+	db.seqNo = seqNo
+	db.seqNoFileExists = true
+	return nil
+}
+
+// 读取dirPath中seq-no文件保存的序列号，文件不存在或者为空时返回false
+func readSeqNoFile(dirPath string) (uint64, bool, error) {
+	fileName := filepath.Join(dirPath, data.SeqNoFileName)
 	if _, err := os.Stat(fileName); os.IsNotExist(err) {
-		return nil
+		return 0, false, nil
 	}
-	seqNoFile, err := data.OpenSeqNodFile(db.options.DirPath)
+	seqNoFile, err := data.OpenSeqNodFile(dirPath)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
+	defer func() {
+		_ = seqNoFile.Close()
+	}()
 	record, _, err := seqNoFile.ReadLogRecord(0)
 	if err != nil {
-		return err
+		// 文件为空，上次关闭时没有写入成功
+		if err == io.EOF {
+			return 0, false, nil
+		}
+		return 0, false, err
 	}
 	seqNo, err := strconv.ParseUint(string(record.Value), 10, 64)
 	if err != nil {
+		return 0, false, err
+	}
+	return seqNo, true, nil
+}
+
+// 将序列号写入dirPath中的seq-no文件，文件是追加写入的，需要先删除旧的文件
+func writeSeqNoFile(dirPath string, seqNo uint64) error {
+	if err := os.Remove(filepath.Join(dirPath, data.SeqNoFileName)); err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	db.seqNo = seqNo
-	db.seqNoFileExists = true
-	return nil
+	seqNoFile, err := data.OpenSeqNodFile(dirPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = seqNoFile.Close()
+	}()
+	record := &data.LogRecord{
+		Key:   []byte(seqNoKey),
+		Value: []byte(strconv.FormatUint(seqNo, 10)),
+	}
+	encRecord, _ := data.EncodeLogRecord(record)
+	if err := seqNoFile.Write(encRecord); err != nil {
+		return err
+	}
+	return seqNoFile.Sync()
 }
 
 func checkOptions(option Options) error {
@@ -345,49 +464,54 @@ func checkOptions(option Options) error {
 	if option.DataFileMergeRatio < 0 || option.DataFileMergeRatio > 1 {
 		return ErrMergeRatioIsInvalid
 	}
+	if option.WatchPendingLimit <= 0 {
+		return ErrWatchPendingLimitInvalid
+	}
 	return nil
 }
 
-func (db *DB) Close() error {
+func (db *DB) Close() (err error) {
 	defer func() {
-		if err := db.fileLock.Unlock(); err != nil {
-			panic(fmt.Sprintf("failed to unlock the directory, %v", err))
+		// 解锁失败时返回错误，不影响已经完成的关闭
+		if unlockErr := db.fileLock.Unlock(); unlockErr != nil {
+			db.logger.Log(LogError, "failed to unlock the directory", "dir", db.options.DirPath, "err", unlockErr)
+			if err == nil {
+				err = unlockErr
+			}
 		}
+		db.listener.OnClosed()
 	}()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closeWatchers()
 	if db.activeFile == nil {
 		return nil
 	}
-	db.mu.Lock()
-	defer db.mu.Unlock()
 
 	// 关闭索引（主要是在b+树模式下关闭，art和b树吴影响）
 	if err := db.index.Close(); err != nil {
 		return err
 	}
 
-	// 在B+树索引模式下保存当前事务的序列号
-	seqNoFile, err := data.OpenSeqNodFile(db.options.DirPath)
-	if err != nil {
-		return err
-	}
-	record := &data.LogRecord{
-		Key:   []byte(seqNoKey),
-		Value: []byte(strconv.FormatUint(db.seqNo, 10)),
-	}
-	encRecord, _ := data.EncodeLogRecord(record)
-	if err := seqNoFile.Write(encRecord); err != nil {
-		return err
-	}
-	if err := seqNoFile.Sync(); err != nil {
+	// 保存当前的写入序列号
+	if err := writeSeqNoFile(db.options.DirPath, db.seqNo); err != nil {
 		return err
 	}
 
+	db.refMu.Lock()
+	defer db.refMu.Unlock()
+	db.isClosed = true
 	// 关闭当前活跃文件
-	if err := db.activeFile.Close(); err != nil {
-		return err
+	if db.fileRefs[db.activeFile.FileID] == 0 {
+		if err := db.activeFile.Close(); err != nil {
+			return err
+		}
 	}
-	// 关闭旧的数据文件
+	// 关闭旧的数据文件，仍被迭代器引用的文件等迭代器关闭时再关闭
 	for _, file := range db.olderFile {
+		if db.fileRefs[file.FileID] > 0 {
+			continue
+		}
 		if err := file.Close(); err != nil {
 			return err
 		}
@@ -401,44 +525,110 @@ func (db *DB) Sync() error {
 	}
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.activeFile.Sync()
+	return db.syncActiveFile()
+}
+
+// syncActiveFile 持久化活跃文件并记录fsync的耗时，调用方需要持有db.mu
+func (db *DB) syncActiveFile() error {
+	start := time.Now()
+	err := db.activeFile.Sync()
+	duration := time.Since(start)
+	db.metrics.syncLatency.observe(duration)
+	db.listener.OnSyncCompleted(SyncInfo{FileID: db.activeFile.FileID, Duration: duration, Err: err})
+	return err
 }
 
 // Put DB写入Key、Value
 func (db *DB) Put(key []byte, value []byte) error {
+	_, err := db.PutWithSeq(key, value)
+	return err
+}
+
+// PutWithSeq 写入Key、Value，返回本次写入的序列号
+func (db *DB) PutWithSeq(key []byte, value []byte) (uint64, error) {
 	// key为空时
 	if len(key) == 0 {
-		return ErrKeyIsEmpty
+		return 0, ErrKeyIsEmpty
+	}
+	defer func(start time.Time) {
+		db.metrics.putLatency.observe(time.Since(start))
+	}(time.Now())
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.put(key, value)
+}
+
+// Get 获取对应的key的数据
+func (db *DB) Get(key []byte) ([]byte, error) {
+	defer func(start time.Time) {
+		db.metrics.getLatency.observe(time.Since(start))
+	}(time.Now())
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	return db.get(key)
+}
+
+func (db *DB) Delete(key []byte) error {
+	_, err := db.DeleteWithSeq(key)
+	return err
+}
+
+// DeleteWithSeq 删除数据，返回本次写入的序列号，key不存在时不会写入，返回0
+func (db *DB) DeleteWithSeq(key []byte) (uint64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
 	}
+	defer func(start time.Time) {
+		db.metrics.deleteLatency.observe(time.Since(start))
+	}(time.Now())
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.delete(key)
+}
+
+// LastSeq 返回最近一次提交的写入的序列号
+func (db *DB) LastSeq() uint64 {
+	return atomic.LoadUint64(&db.seqNo)
+}
+
+// put 写入数据并更新索引，调用方需要持有db.mu，保证写日志和更新索引之间不会插入其他写操作
+func (db *DB) put(key []byte, value []byte) (uint64, error) {
+	seqNo := atomic.AddUint64(&db.seqNo, 1)
 	// 构造LogRecord
 	logRecord := &data.LogRecord{
-		Key:   logRecordKeyWithSeq(key, nonTransactionSeqNo),
-		Value: value,
-		Type:  data.LogRecordNormal,
+		Key:        logRecordKeyWithSeq(key, seqNo),
+		Value:      value,
+		Type:       data.LogRecordNormal,
+		AutoCommit: true,
+		Timestamp:  time.Now().UnixNano(),
 	}
 
 	// 追加写入到当前活跃数据文件中
-	pos, err := db.appendLogRecordWithLock(logRecord)
+	pos, err := db.appendLogRecord(logRecord)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	// 更新索引
-	if oldPos := db.index.Put(key, pos); oldPos != nil {
-		db.mu.Lock()
+	oldPos, err := db.index.Put(key, pos)
+	if err != nil {
+		return 0, err
+	}
+	if oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
-		db.mu.Unlock()
 	}
-	return nil
+	db.publish(seqNo, &Change{Type: ChangePut, Key: key, Value: value})
+	return seqNo, nil
 }
 
-// Get 获取对应的key的数据
-func (db *DB) Get(key []byte) ([]byte, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	if len(key) == 0 {
-		return nil, ErrKeyIsEmpty
+// get 读取数据，调用方需要持有db.mu
+func (db *DB) get(key []byte) ([]byte, error) {
+	logRecordPos, err := db.index.Get(key)
+	if err != nil {
+		return nil, err
 	}
-	logRecordPos := db.index.Get(key)
 	// key不存在
 	if logRecordPos == nil {
 		return nil, ErrKeyNotFound
@@ -447,44 +637,47 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	return db.getValueByPosition(logRecordPos)
 }
 
-func (db *DB) Delete(key []byte) error {
-	if len(key) == 0 {
-		return ErrKeyIsEmpty
-	}
-	if pos := db.index.Get(key); pos == nil {
-		return nil
+// delete 删除数据并更新索引，调用方需要持有db.mu
+func (db *DB) delete(key []byte) (uint64, error) {
+	if pos, err := db.index.Get(key); err != nil || pos == nil {
+		return 0, err
 	}
+	seqNo := atomic.AddUint64(&db.seqNo, 1)
 	logRecord := &data.LogRecord{
-		Key:  logRecordKeyWithSeq(key, nonTransactionSeqNo),
-		Type: data.LogRecordDeleted,
+		Key:        logRecordKeyWithSeq(key, seqNo),
+		Type:       data.LogRecordDeleted,
+		AutoCommit: true,
+		Timestamp:  time.Now().UnixNano(),
 	}
 
-	pos, err := db.appendLogRecordWithLock(logRecord)
+	pos, err := db.appendLogRecord(logRecord)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// 当前记录本身是可删除的，也需要计算
 	db.reclaimSize += int64(pos.Size)
 	// 从内存索引中将对应的key删除
-	oldPos, ok := db.index.Delete(key)
+	oldPos, ok, err := db.index.Delete(key)
+	if err != nil {
+		return 0, err
+	}
 	if !ok {
-		return ErrIndexUpdateFailed
+		return 0, ErrIndexUpdateFailed
 	}
 	if oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
 	}
-	return nil
-}
-
-func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	return db.appendLogRecord(logRecord)
+	db.publish(seqNo, &Change{Type: ChangeDelete, Key: key})
+	return seqNo, nil
 }
 
 // appendLogRecord 追加写入到活跃文件中
 func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	// 从节点的数据只能通过复制写入
+	if db.readOnly {
+		return nil, ErrDatabaseIsReadOnly
+	}
 	// 判断活跃文件是否存在
 	// 如果为空初始化活跃文件
 	if db.activeFile == nil {
@@ -497,7 +690,7 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 	// 如果当前写入数据大小+活跃文件大小 超过了 活跃文件的上限值，关闭活跃文件，打开新的活跃文件
 	if db.activeFile.WriteOff+size > db.options.DataFileSize {
 		// 持久化活跃文件
-		if err := db.activeFile.Sync(); err != nil {
+		if err := db.syncActiveFile(); err != nil {
 			return nil, err
 		}
 		// 将活跃文件转换为旧的活跃文件
@@ -512,6 +705,7 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 	}
 
 	db.bytesWrite += uint(size)
+	atomic.AddUint64(&db.metrics.bytesWritten, uint64(size))
 	// 根据用户配置决定是否持久化写入
 	var needSync = db.options.SyncWrites
 	// 判断根据字节数同步是否需要持久化
@@ -519,13 +713,15 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 		needSync = true
 	}
 	if needSync {
-		if err := db.activeFile.Sync(); err != nil {
+		if err := db.syncActiveFile(); err != nil {
 			return nil, err
 		}
 		if db.bytesWrite > 0 {
 			db.bytesWrite = 0
 		}
 	}
+	// 通知等待新数据的复制连接
+	db.notifyAppend()
 	// 构造内存索引信息
 	pos := &data.LogRecordPos{Fid: db.activeFile.FileID, Offset: writeOff, Size: uint32(size)}
 	return pos, nil
@@ -543,53 +739,122 @@ func (db *DB) setActiveDataFile() error {
 	if err != nil {
 		return err
 	}
+	if db.activeFile != nil {
+		db.listener.OnFileRotated(FileRotatedInfo{
+			OldFileID: db.activeFile.FileID,
+			OldSize:   db.activeFile.WriteOff,
+			NewFileID: dataFile.FileID,
+		})
+	}
 	db.activeFile = dataFile
 	return nil
 }
 
 func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
-	fileID := pos.Fid
-	offset := pos.Offset
-	var dataFile *data.DataFile
-	if db.activeFile.FileID == fileID {
-		dataFile = db.activeFile
-	} else {
-		dataFile = db.olderFile[fileID]
+	return db.readValue(pos, db.getDataFile)
+}
+
+// 根据文件ID找到对应的数据文件，调用方需要持有db.mu
+func (db *DB) getDataFile(fileID uint32) *data.DataFile {
+	if db.activeFile != nil && db.activeFile.FileID == fileID {
+		return db.activeFile
+	}
+	return db.olderFile[fileID]
+}
+
+// readValue 从getFile给出的数据文件中读取pos位置的value，如果是merge操作数会沿着链表合并出最终的值
+func (db *DB) readValue(pos *data.LogRecordPos, getFile func(fileID uint32) *data.DataFile) ([]byte, error) {
+	logRecord, err := readLogRecordAt(getFile(pos.Fid), pos)
+	if err != nil {
+		if err == data.ErrInvalidCRC {
+			db.reportCorruption(pos.Fid, pos.Offset, err)
+		}
+		return nil, err
 	}
+	switch logRecord.Type {
+	case data.LogRecordDeleted: // 已经被删除了
+		return nil, ErrKeyNotFound
+	case data.LogRecordMerge:
+		return db.foldMergeOperands(logRecord, getFile)
+	}
+	return logRecord.Value, nil
+}
+
+// reportCorruption 记录读到的损坏记录并通知事件回调
+func (db *DB) reportCorruption(fileID uint32, offset int64, err error) {
+	db.logger.Log(LogError, "corrupted log record", "file", fileID, "offset", offset, "err", err)
+	db.listener.OnCorruption(CorruptionInfo{FileID: fileID, Offset: offset, Err: err})
+}
+
+// 从指定的数据文件中读取pos位置的记录
+func readLogRecordAt(dataFile *data.DataFile, pos *data.LogRecordPos) (*data.LogRecord, error) {
 	// dataFile不存在
 	if dataFile == nil {
 		return nil, ErrDataFileNotFound
 	}
 	// 读取对应的文件
-	logRecord, _, err := dataFile.ReadLogRecord(offset)
+	logRecord, _, err := dataFile.ReadLogRecord(pos.Offset)
 	if err != nil {
 		return nil, err
 	}
-	// 已经被删除了
-	if logRecord.Type == data.LogRecordDeleted {
-		return nil, ErrKeyNotFound
+	return logRecord, nil
+}
+
+// pinDataFiles 引用当前所有的数据文件，返回文件快照，调用方需要持有db.mu
+func (db *DB) pinDataFiles() map[uint32]*data.DataFile {
+	db.refMu.Lock()
+	defer db.refMu.Unlock()
+	files := make(map[uint32]*data.DataFile, len(db.olderFile)+1)
+	for fid, file := range db.olderFile {
+		files[fid] = file
+	}
+	if db.activeFile != nil {
+		files[db.activeFile.FileID] = db.activeFile
+	}
+	for fid := range files {
+		db.fileRefs[fid]++
+	}
+	return files
+}
+
+// unpinDataFiles 释放对数据文件的引用，数据库已经关闭时由最后一个引用者关闭文件
+func (db *DB) unpinDataFiles(files map[uint32]*data.DataFile) {
+	db.refMu.Lock()
+	defer db.refMu.Unlock()
+	for fid, file := range files {
+		db.fileRefs[fid]--
+		if db.fileRefs[fid] > 0 {
+			continue
+		}
+		delete(db.fileRefs, fid)
+		if db.isClosed {
+			_ = file.Close()
+		}
 	}
-	return logRecord.Value, nil
 }
 
 // ListKeys 获取数据库中的所有key
-func (db *DB) ListKeys() [][]byte {
-	iterator := db.index.Iterator(false)
+func (db *DB) ListKeys() ([][]byte, error) {
+	iterator, err := db.index.Iterator(false)
+	if err != nil {
+		return nil, err
+	}
 	defer iterator.Close()
-	keys := make([][]byte, db.index.Size())
-	var idx int
+	keys := make([][]byte, 0)
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
-		keys[idx] = iterator.Key()
-		idx++
+		keys = append(keys, iterator.Key())
 	}
-	return keys
+	return keys, nil
 }
 
 // Fold 获取所有的数据，根据用户自定义的函数进行操作
 func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	iter := db.index.Iterator(false)
+	iter, err := db.index.Iterator(false)
+	if err != nil {
+		return err
+	}
 	defer iter.Close()
 	for iter.Rewind(); iter.Valid(); iter.Next() {
 		value, err := db.getValueByPosition(iter.Value())
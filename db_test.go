@@ -2,12 +2,14 @@ package tiny_kvDB
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"strconv"
 	"testing"
 	"time"
+	"tiny-kvDB/index"
 	"tiny-kvDB/utils"
 )
 
@@ -230,13 +232,15 @@ func TestDB_ListKeys(t *testing.T) {
 	assert.NotNil(t, db)
 
 	// 为空
-	keys := db.ListKeys()
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 0, len(keys))
 
 	// 只有一条数据
 	err = db.Put(utils.GetTestKey(1), utils.RandomValue(1))
 	assert.Nil(t, err)
-	key2 := db.ListKeys()
+	key2, err := db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 1, len(key2))
 
 	// 多条数据
@@ -244,7 +248,7 @@ func TestDB_ListKeys(t *testing.T) {
 	assert.Nil(t, err)
 	err = db.Put(utils.GetTestKey(13), utils.RandomValue(13))
 	assert.Nil(t, err)
-	key3 := db.ListKeys()
+	key3, err := db.ListKeys()
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(key3))
 }
@@ -304,6 +308,21 @@ func TestDB_FileLock(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestOpen_UnsupportedIndexType(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-index")
+	opts.DirPath = dir
+	opts.IndexType = IndexType(100)
+	_, err := Open(opts)
+	assert.True(t, errors.Is(err, index.ErrUnsupportedIndexType))
+
+	// 打开失败时释放了目录锁
+	opts.IndexType = Btree
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+}
+
 func TestDB_Stat(t *testing.T) {
 	opts := DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-close")
@@ -329,7 +348,8 @@ func TestDB_Stat(t *testing.T) {
 		assert.Nil(t, err)
 	}
 
-	stat := db.Stat()
+	stat, err := db.Stat()
+	assert.Nil(t, err)
 	assert.NotNil(t, stat)
 }
 func TestBack(t *testing.T) {
@@ -364,3 +384,57 @@ func TestBack(t *testing.T) {
 	}
 
 }
+
+func TestDB_LastSeq(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-seq")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), db.LastSeq())
+
+	// 所有写入的序列号单调递增
+	var lastSeq uint64
+	for i := 0; i < 1000; i++ {
+		seq, err := db.PutWithSeq(utils.GetTestKey(i), utils.RandomValue(32))
+		assert.Nil(t, err)
+		assert.Equal(t, lastSeq+1, seq)
+		lastSeq = seq
+	}
+	seq, err := db.DeleteWithSeq(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, lastSeq+1, seq)
+	// key不存在时不写入
+	seq, err = db.DeleteWithSeq(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), seq)
+
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.GetTestKey(1), utils.RandomValue(32)))
+	assert.Nil(t, wb.Put(utils.GetTestKey(2), utils.RandomValue(32)))
+	seq, err = wb.CommitWithSeq()
+	assert.Nil(t, err)
+	assert.Equal(t, lastSeq+2, seq)
+	assert.Equal(t, seq, db.LastSeq())
+	lastSeq = seq
+
+	// 重启后序列号不回退
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, lastSeq, db.LastSeq())
+
+	// merge之后重启，序列号也不回退
+	assert.Nil(t, db.Merge())
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, lastSeq, db.LastSeq())
+	seq, err = db.PutWithSeq(utils.GetTestKey(1), utils.RandomValue(32))
+	assert.Nil(t, err)
+	assert.Equal(t, lastSeq+1, seq)
+}
@@ -3,17 +3,33 @@ package tiny_kvDB
 import "errors"
 
 var (
-	ErrKeyIsEmpty             = errors.New("key is empty")
-	ErrIndexUpdateFailed      = errors.New("fail to update index")
-	ErrKeyNotFound            = errors.New("key is not found")
-	ErrDataFileNotFound       = errors.New("data file is not found ")
-	ErrDatabaseDirIsEmpty     = errors.New("database dir is empty")
-	ErrDataSizeIsInvalid      = errors.New("data size is not valid")
-	ErrMergeRatioIsInvalid    = errors.New("data file merge ratio is not valid")
-	ErrDataDirectoryCorrupted = errors.New("the database directory maybe corrupted")
-	ErrExceedMaxBatchNum      = errors.New("exceed the max batch number")
-	ErrMergeIsProgress        = errors.New("merge is in progress, try again later")
-	ErrDataBaseIsUsing        = errors.New("the database directory is used by another process")
-	ErrMergeRatioUnreached    = errors.New("the merge ratio do not reach the option")
-	ErrNoEnoughSpaceForMerge  = errors.New("no enough disk space for merge")
+	ErrKeyIsEmpty               = errors.New("key is empty")
+	ErrIndexUpdateFailed        = errors.New("fail to update index")
+	ErrKeyNotFound              = errors.New("key is not found")
+	ErrDataFileNotFound         = errors.New("data file is not found ")
+	ErrDatabaseDirIsEmpty       = errors.New("database dir is empty")
+	ErrDataSizeIsInvalid        = errors.New("data size is not valid")
+	ErrMergeRatioIsInvalid      = errors.New("data file merge ratio is not valid")
+	ErrDataDirectoryCorrupted   = errors.New("the database directory maybe corrupted")
+	ErrExceedMaxBatchNum        = errors.New("exceed the max batch number")
+	ErrMergeIsProgress          = errors.New("merge is in progress, try again later")
+	ErrDataBaseIsUsing          = errors.New("the database directory is used by another process")
+	ErrMergeRatioUnreached      = errors.New("the merge ratio do not reach the option")
+	ErrNoEnoughSpaceForMerge    = errors.New("no enough disk space for merge")
+	ErrValueIsNotInteger        = errors.New("value is not an integer")
+	ErrIncrOverflow             = errors.New("increment or decrement would overflow")
+	ErrMergeOperatorNotSet      = errors.New("merge operator is not set in options")
+	ErrDatabaseIsClosed         = errors.New("database is closed")
+	ErrDatabaseIsReadOnly       = errors.New("database is read only")
+	ErrReplicationPosition      = errors.New("replication position is not available on the primary")
+	ErrBackupDirIsNotEmpty      = errors.New("backup directory is not empty")
+	ErrBackupManifestNotFound   = errors.New("backup manifest is not found")
+	ErrRestorePointBeforeBackup = errors.New("restore point is earlier than the backup")
+	ErrRestoreLogNotContinuous  = errors.New("data files after the backup are missing, can not restore to the point")
+	ErrDumpFormatInvalid        = errors.New("dump format is not valid")
+	ErrWriteBatchUnavailable    = errors.New("can not use write batch, seq-no file not exists")
+	ErrMergeTxnPending          = errors.New("a replicated transaction is not committed yet, try merge again later")
+	ErrWatchPendingLimitInvalid = errors.New("watch pending limit is not valid")
+	ErrWatchPendingOverflow     = errors.New("watcher can not keep up, pending events exceed the limit")
+	ErrMergeOutputOverflow      = errors.New("merge output would overwrite data files that were not merged")
 )
@@ -0,0 +1,80 @@
+package tiny_kvDB
+
+import "time"
+
+// EventListener 数据库生命周期事件的回调，通过Options.EventListener设置
+// 回调在触发事件的协程中同步执行，大多在持有数据库锁时调用，不能再调用数据库的方法，耗时的处理需要自己异步进行
+// 只关心部分事件时可以内嵌NopEventListener
+type EventListener interface {
+	OnFileRotated(info FileRotatedInfo)           // 活跃文件写满或者被封存，切换到新的活跃文件
+	OnMergeStarted(info MergeStartedInfo)         // merge开始重写数据文件
+	OnMergeFinished(info MergeFinishedInfo)       // merge结束，成功或者失败
+	OnMergeInstalled(info MergeInstalledInfo)     // 打开数据库时用merge的结果替换了旧的数据文件
+	OnRecoveryProgress(info RecoveryProgressInfo) // 打开数据库时每加载完一个数据文件
+	OnCorruption(info CorruptionInfo)             // 读到了损坏的记录
+	OnSyncCompleted(info SyncInfo)                // 活跃文件完成一次fsync
+	OnClosed()                                    // 数据库已经关闭
+}
+
+// FileRotatedInfo 切换活跃文件
+type FileRotatedInfo struct {
+	OldFileID uint32 // 被封存的文件
+	OldSize   int64  // 被封存文件的大小
+	NewFileID uint32 // 新的活跃文件
+}
+
+// MergeStartedInfo merge开始
+type MergeStartedInfo struct {
+	FileNum        int    // 参与merge的数据文件数量
+	NonMergeFileID uint32 // 小于该ID的数据文件会被重写
+}
+
+// MergeFinishedInfo merge结束
+type MergeFinishedInfo struct {
+	FileNum    int           // 参与merge的数据文件数量
+	InputSize  int64         // 读取的数据量
+	OutputSize int64         // 重写后的数据量
+	KeyNum     int           // 重写的key数量
+	Duration   time.Duration // 耗时
+	Err        error         // merge失败的原因，成功时为nil
+}
+
+// MergeInstalledInfo 打开时安装merge的结果
+type MergeInstalledInfo struct {
+	NonMergeFileID uint32 // 小于该ID的旧数据文件已经删除
+	FileNum        int    // 移入数据目录的文件数量
+}
+
+// RecoveryProgressInfo 加载数据文件的进度
+type RecoveryProgressInfo struct {
+	FileID     uint32 // 刚加载完的数据文件
+	Loaded     int    // 已经加载的数据文件数量
+	Total      int    // 需要加载的数据文件总数，hint文件覆盖的文件不需要加载
+	RecordSize int64  // 当前文件加载的数据量
+}
+
+// CorruptionInfo 损坏的记录
+type CorruptionInfo struct {
+	FileID uint32
+	Offset int64
+	Err    error
+}
+
+// SyncInfo 一次fsync
+type SyncInfo struct {
+	FileID   uint32
+	Duration time.Duration
+	Err      error
+}
+
+// NopEventListener 忽略所有事件，可以内嵌到只关心部分事件的实现中
+type NopEventListener struct{}
+
+func (NopEventListener) OnFileRotated(FileRotatedInfo)           {}
+func (NopEventListener) OnMergeStarted(MergeStartedInfo)         {}
+func (NopEventListener) OnMergeFinished(MergeFinishedInfo)       {}
+func (NopEventListener) OnMergeInstalled(MergeInstalledInfo)     {}
+func (NopEventListener) OnRecoveryProgress(RecoveryProgressInfo) {}
+func (NopEventListener) OnCorruption(CorruptionInfo)             {}
+func (NopEventListener) OnSyncCompleted(SyncInfo)                {}
+func (NopEventListener) OnClosed()                               {}
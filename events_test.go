@@ -0,0 +1,151 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"tiny-kvDB/data"
+	"tiny-kvDB/utils"
+)
+
+type recordingListener struct {
+	NopEventListener
+	mu             sync.Mutex
+	rotated        []FileRotatedInfo
+	mergeStarted   []MergeStartedInfo
+	mergeFinished  []MergeFinishedInfo
+	mergeInstalled []MergeInstalledInfo
+	recovery       []RecoveryProgressInfo
+	corruption     []CorruptionInfo
+	syncs          int
+	closed         int
+}
+
+func (l *recordingListener) OnFileRotated(info FileRotatedInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotated = append(l.rotated, info)
+}
+
+func (l *recordingListener) OnMergeStarted(info MergeStartedInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeStarted = append(l.mergeStarted, info)
+}
+
+func (l *recordingListener) OnMergeFinished(info MergeFinishedInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeFinished = append(l.mergeFinished, info)
+}
+
+func (l *recordingListener) OnMergeInstalled(info MergeInstalledInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeInstalled = append(l.mergeInstalled, info)
+}
+
+func (l *recordingListener) OnRecoveryProgress(info RecoveryProgressInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recovery = append(l.recovery, info)
+}
+
+func (l *recordingListener) OnCorruption(info CorruptionInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.corruption = append(l.corruption, info)
+}
+
+func (l *recordingListener) OnSyncCompleted(info SyncInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.syncs++
+}
+
+func (l *recordingListener) OnClosed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed++
+}
+
+func TestDB_EventListener(t *testing.T) {
+	listener := &recordingListener{}
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-events")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.EventListener = listener
+	db, err := Open(opts)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.True(t, len(listener.rotated) > 1)
+	for i, info := range listener.rotated {
+		assert.Equal(t, uint32(i), info.OldFileID)
+		assert.Equal(t, uint32(i+1), info.NewFileID)
+		assert.True(t, info.OldSize > 0 && info.OldSize <= opts.DataFileSize)
+	}
+	assert.True(t, listener.syncs > 0)
+
+	// merge开始和结束
+	assert.Nil(t, db.Merge())
+	assert.Equal(t, 1, len(listener.mergeStarted))
+	assert.Equal(t, 1, len(listener.mergeFinished))
+	finished := listener.mergeFinished[0]
+	assert.Nil(t, finished.Err)
+	assert.Equal(t, listener.mergeStarted[0].FileNum, finished.FileNum)
+	assert.Equal(t, 500, finished.KeyNum)
+	assert.True(t, finished.InputSize > finished.OutputSize)
+	assert.Nil(t, db.Close())
+	assert.Equal(t, 1, listener.closed)
+
+	// 重新打开时安装merge的结果，并通知加载进度
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listener.mergeInstalled))
+	assert.Equal(t, listener.mergeStarted[0].NonMergeFileID, listener.mergeInstalled[0].NonMergeFileID)
+	assert.True(t, len(listener.recovery) > 0)
+	last := listener.recovery[len(listener.recovery)-1]
+	assert.Equal(t, last.Total, last.Loaded)
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 500, len(keys))
+	destroyDB(db)
+	assert.Equal(t, 2, listener.closed)
+}
+
+func TestDB_EventListenerCorruption(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-events")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	assert.Nil(t, db.Close())
+
+	// 修改数据文件中间的一个字节
+	fileName := data.GetDataFileName(dir, 0)
+	buf, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[len(buf)/2] ^= 0xff
+	assert.Nil(t, os.WriteFile(fileName, buf, 0644))
+
+	listener := &recordingListener{}
+	opts.EventListener = listener
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+	assert.Equal(t, 1, len(listener.corruption))
+	assert.Equal(t, uint32(0), listener.corruption[0].FileID)
+	assert.True(t, listener.corruption[0].Offset > 0)
+	_ = os.RemoveAll(dir)
+}
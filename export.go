@@ -0,0 +1,150 @@
+package tiny_kvDB
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+/*
+	导出格式（JSON Lines），每行一个JSON对象，UTF-8编码
+	第一行是头部：{"format":"tiny-kvdb-dump","version":1}
+	之后每行一条数据：{"key":"<base64>","value":"<base64>","expire_at":<毫秒时间戳>}
+	  key和value使用标准base64编码（encoding/json对[]byte的默认编码）
+	  expire_at是可选字段，表示数据的过期时间（Unix毫秒），没有过期时间时省略
+	数据按key的字节序排列，导入时按顺序写入
+*/
+
+const (
+	dumpFormatName    = "tiny-kvdb-dump"
+	dumpFormatVersion = 1
+	importBatchNum    = 1000 // 导入时每个批次写入的数据量
+)
+
+type dumpHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// DumpEntry 导出格式中的一条数据
+type DumpEntry struct {
+	Key      []byte `json:"key"`
+	Value    []byte `json:"value"`
+	ExpireAt int64  `json:"expire_at,omitempty"`
+}
+
+// ExportOptions 导出配置
+type ExportOptions struct {
+	Prefix []byte // 只导出前缀为Prefix的key
+	Start  []byte // 只导出不小于Start的key，为空表示不限制
+	End    []byte // 只导出小于End的key，为空表示不限制
+	// 返回key的过期时间，零值表示不过期，用于导出上层数据结构（例如redis）记录的TTL
+	ExpireAt func(key, value []byte) time.Time
+}
+
+// Export 将数据库中的数据按导出格式写入w，返回导出的数据量
+// 导出基于迭代器，看到的是开始导出时的快照，不会阻塞写入
+func (db *DB) Export(w io.Writer, options ExportOptions) (int, error) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(&dumpHeader{Format: dumpFormatName, Version: dumpFormatVersion}); err != nil {
+		return 0, err
+	}
+
+	iterator, err := db.NewIterator(IteratorOptions{Prefix: options.Prefix})
+	if err != nil {
+		return 0, err
+	}
+	defer iterator.Close()
+	if len(options.Start) > 0 {
+		iterator.Seek(options.Start)
+	} else {
+		iterator.Rewind()
+	}
+
+	var count int
+	for ; iterator.Valid(); iterator.Next() {
+		key := iterator.Key()
+		if len(options.End) > 0 && bytes.Compare(key, options.End) >= 0 {
+			break
+		}
+		value, err := iterator.Value()
+		if err != nil {
+			return count, err
+		}
+		entry := &DumpEntry{Key: key, Value: value}
+		if options.ExpireAt != nil {
+			if expireAt := options.ExpireAt(key, value); !expireAt.IsZero() {
+				entry.ExpireAt = expireAt.UnixMilli()
+			}
+		}
+		if err := encoder.Encode(entry); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Import 从r中读取导出格式的数据写入数据库，返回导入的数据量
+// 已经过期的数据不会导入，数据分批写入，每个批次是原子的
+// expire_at只用来跳过已经过期的数据，value原样写入，过期时间保存在value中的数据（例如redis的key）导入后过期时间不变
+func (db *DB) Import(r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	header := &dumpHeader{}
+	if err := decoder.Decode(header); err != nil {
+		if err == io.EOF {
+			return 0, ErrDumpFormatInvalid
+		}
+		return 0, err
+	}
+	if header.Format != dumpFormatName || header.Version != dumpFormatVersion {
+		return 0, ErrDumpFormatInvalid
+	}
+
+	options := DefaultWriteBatchOptions
+	options.SyncWrite = false
+	wb, err := db.NewWriteBatch(options)
+	if err != nil {
+		return 0, err
+	}
+	var count, pending int
+	now := time.Now().UnixMilli()
+	for {
+		entry := &DumpEntry{}
+		if err := decoder.Decode(entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return count, err
+		}
+		if len(entry.Key) == 0 {
+			return count, ErrDumpFormatInvalid
+		}
+		if entry.ExpireAt > 0 && entry.ExpireAt <= now {
+			continue
+		}
+		if err := wb.Put(entry.Key, entry.Value); err != nil {
+			return count, err
+		}
+		pending++
+		if pending == importBatchNum {
+			if err := wb.Commit(); err != nil {
+				return count, err
+			}
+			count += pending
+			pending = 0
+			if wb, err = db.NewWriteBatch(options); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		return count, err
+	}
+	count += pending
+	if err := db.Sync(); err != nil {
+		return count, err
+	}
+	return count, nil
+}
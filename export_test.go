@@ -0,0 +1,118 @@
+package tiny_kvDB
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"tiny-kvDB/utils"
+)
+
+func TestDB_ExportImport(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(32)))
+	}
+	assert.Nil(t, db.Put([]byte("user:1"), []byte("alice")))
+	assert.Nil(t, db.Put([]byte("user:2"), []byte{}))
+	assert.Nil(t, db.Put([]byte("user:3"), []byte{0, 255, '\n'}))
+
+	buf := new(bytes.Buffer)
+	count, err := db.Export(buf, ExportOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3003, count)
+	assert.True(t, strings.HasPrefix(buf.String(), `{"format":"tiny-kvdb-dump","version":1}`+"\n"))
+
+	dir2, _ := os.MkdirTemp("", "bitcask-go-import")
+	opts.DirPath = dir2
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	count, err = db2.Import(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 3003, count)
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
+	importedKeys, err := db2.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, keys, importedKeys)
+	for _, key := range keys {
+		want, _ := db.Get(key)
+		got, err := db2.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, len(want), len(got))
+		assert.True(t, bytes.Equal(want, got))
+	}
+}
+
+func TestDB_ExportFilter(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for _, key := range []string{"a:1", "a:2", "a:3", "b:1", "b:2", "c:1"} {
+		assert.Nil(t, db.Put([]byte(key), []byte(key)))
+	}
+
+	exportKeys := func(options ExportOptions) []string {
+		buf := new(bytes.Buffer)
+		_, err := db.Export(buf, options)
+		assert.Nil(t, err)
+		dir, _ := os.MkdirTemp("", "bitcask-go-import")
+		importOpts := DefaultOptions
+		importOpts.DirPath = dir
+		target, err := Open(importOpts)
+		assert.Nil(t, err)
+		defer destroyDB(target)
+		_, err = target.Import(buf)
+		assert.Nil(t, err)
+		targetKeys, err := target.ListKeys()
+		assert.Nil(t, err)
+		var keys []string
+		for _, key := range targetKeys {
+			keys = append(keys, string(key))
+		}
+		return keys
+	}
+
+	assert.Equal(t, []string{"b:1", "b:2"}, exportKeys(ExportOptions{Prefix: []byte("b:")}))
+	assert.Equal(t, []string{"a:2", "a:3", "b:1"}, exportKeys(ExportOptions{Start: []byte("a:2"), End: []byte("b:2")}))
+	assert.Equal(t, []string{"b:2", "c:1"}, exportKeys(ExportOptions{Start: []byte("b:2")}))
+
+	// 过期时间随数据一起导出，已经过期的数据不会导入
+	buf := new(bytes.Buffer)
+	_, err = db.Export(buf, ExportOptions{ExpireAt: func(key, value []byte) time.Time {
+		switch key[0] {
+		case 'a':
+			return time.Now().Add(-time.Hour)
+		case 'b':
+			return time.Now().Add(time.Hour)
+		}
+		return time.Time{}
+	}})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `"expire_at":`)
+	dir2, _ := os.MkdirTemp("", "bitcask-go-import")
+	opts.DirPath = dir2
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	count, err := db2.Import(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	_, err = db2.Import(strings.NewReader(`{"format":"other","version":1}`))
+	assert.Equal(t, ErrDumpFormatInvalid, err)
+	_, err = db2.Import(strings.NewReader(""))
+	assert.Equal(t, ErrDumpFormatInvalid, err)
+}
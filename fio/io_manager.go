@@ -1,7 +1,14 @@
 package fio
 
+import "errors"
+
 const DataFilePerm = 0644
 
+var (
+	ErrUnsupportedIOType = errors.New("unsupported io type")
+	ErrMMapIsReadOnly    = errors.New("mmap io manager is read only")
+)
+
 type FileIOTye = byte
 
 const (
@@ -33,6 +40,6 @@ func NewIOManager(fileName string, ioType FileIOTye) (IOManager, error) {
 	case MemoryFileMap:
 		return NewMMapIOManage(fileName)
 	default:
-		panic("unsupported io type")
+		return nil, ErrUnsupportedIOType
 	}
 }
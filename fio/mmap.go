@@ -21,14 +21,14 @@ func (mmap *MMap) Read(b []byte, n int64) (int, error) {
 	return mmap.readerAt.ReadAt(b, n)
 }
 
-// Write 写入字节数组到文件中
+// Write mmap只用于启动时读取数据，不支持写入
 func (mmap *MMap) Write([]byte) (int, error) {
-	panic("not implemented")
+	return 0, ErrMMapIsReadOnly
 }
 
-// Sync 将内存缓冲区数据持久化到磁盘中
+// Sync 只读的映射没有需要持久化的数据
 func (mmap *MMap) Sync() error {
-	panic("not implemented")
+	return nil
 }
 
 // Close 关闭文件
@@ -88,7 +88,12 @@ func handleListKeys(writer http.ResponseWriter, request *http.Request) {
 	}
 
 	// 对传递的参数进行解析，传递是getUrl
-	keys := db.ListKeys()
+	keys, err := db.ListKeys()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		log.Printf("failed to list keys: %v\n", err)
+		return
+	}
 	writer.Header().Set("Content-Type", "application/json")
 	var res []string
 	for _, key := range keys {
@@ -104,7 +109,12 @@ func handleStat(writer http.ResponseWriter, request *http.Request) {
 	}
 
 	// 对传递的参数进行解析，传递是getUrl
-	stat := db.Stat()
+	stat, err := db.Stat()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		log.Printf("failed to get stat of db: %v\n", err)
+		return
+	}
 	writer.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(writer).Encode(stat)
 }
@@ -117,5 +127,6 @@ func main() {
 	http.HandleFunc("/bitcask/delete", handleDel)
 	http.HandleFunc("/bitcask/listkeys", handleListKeys)
 	http.HandleFunc("/bitcask/stat", handleStat)
+	http.Handle("/metrics", db.MetricsHandler())
 	http.ListenAndServe("localhost:8080", nil)
 }
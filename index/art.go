@@ -20,44 +20,44 @@ func NewART() *AdaptiveRadixTree {
 	}
 }
 
-func (art *AdaptiveRadixTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+func (art *AdaptiveRadixTree) Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error) {
 	art.lock.Lock()
 	olderIt, _ := art.tree.Insert(key, pos)
 	art.lock.Unlock()
 	if olderIt == nil {
-		return nil
+		return nil, nil
 	}
-	return olderIt.(*data.LogRecordPos)
+	return olderIt.(*data.LogRecordPos), nil
 }
-func (art *AdaptiveRadixTree) Get(key []byte) *data.LogRecordPos {
+func (art *AdaptiveRadixTree) Get(key []byte) (*data.LogRecordPos, error) {
 	art.lock.RLock()
 	defer art.lock.RUnlock()
 	value, ok := art.tree.Search(key)
 	if !ok {
-		return nil
+		return nil, nil
 	}
-	return value.(*data.LogRecordPos)
+	return value.(*data.LogRecordPos), nil
 }
-func (art *AdaptiveRadixTree) Delete(key []byte) (*data.LogRecordPos, bool) {
+func (art *AdaptiveRadixTree) Delete(key []byte) (*data.LogRecordPos, bool, error) {
 	art.lock.Lock()
 	olderIt, del := art.tree.Delete(key)
 	art.lock.Unlock()
 	if olderIt == nil {
-		return nil, false
+		return nil, false, nil
 	}
-	return olderIt.(*data.LogRecordPos), del
+	return olderIt.(*data.LogRecordPos), del, nil
 }
 
-func (art *AdaptiveRadixTree) Size() int {
+func (art *AdaptiveRadixTree) Size() (int, error) {
 	art.lock.RLock()
 	size := art.tree.Size()
 	art.lock.RUnlock()
-	return size
+	return size, nil
 }
-func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
+func (art *AdaptiveRadixTree) Iterator(reverse bool) (Iterator, error) {
 	art.lock.RLock()
 	defer art.lock.RUnlock()
-	return newArtIterator(art.tree, reverse)
+	return newArtIterator(art.tree, reverse), nil
 }
 
 func (art *AdaptiveRadixTree) Close() error {
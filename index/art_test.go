@@ -8,13 +8,16 @@ import (
 
 func TestAdaptiveRadixTree_Put(t *testing.T) {
 	art := NewART()
-	res1 := art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	res1, err := art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	res2 := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	res2, err := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.Nil(t, err)
 	assert.Nil(t, res2)
 
-	res3 := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 2, Offset: 13})
+	res3, err := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 2, Offset: 13})
+	assert.Nil(t, err)
 	assert.NotNil(t, res3)
 	assert.Equal(t, uint32(1), res3.Fid)
 	assert.Equal(t, int64(12), res3.Offset)
@@ -23,30 +26,36 @@ func TestAdaptiveRadixTree_Put(t *testing.T) {
 func TestAdaptiveRadixTree_Get(t *testing.T) {
 	art := NewART()
 	art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
-	logPos := art.Get([]byte("key-1"))
+	logPos, err := art.Get([]byte("key-1"))
+	assert.Nil(t, err)
 	assert.NotNil(t, logPos)
 
-	pos1 := art.Get([]byte("not exist"))
+	pos1, err := art.Get([]byte("not exist"))
+	assert.Nil(t, err)
 	assert.Nil(t, pos1)
 
-	pos2 := art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 2, Offset: 12})
+	pos2, err := art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 2, Offset: 12})
+	assert.Nil(t, err)
 	assert.NotNil(t, pos2)
 }
 
 func TestAdaptiveRadixTree_Delete(t *testing.T) {
 	art := NewART()
-	res1, ok := art.Delete([]byte("not exist"))
+	res1, ok, err := art.Delete([]byte("not exist"))
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 	assert.False(t, ok)
 
 	art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
-	res2, ok := art.Delete([]byte("key-1"))
+	res2, ok, err := art.Delete([]byte("key-1"))
+	assert.Nil(t, err)
 	assert.NotNil(t, res2)
 	assert.True(t, ok)
 	assert.Equal(t, uint32(1), res2.Fid)
 	assert.Equal(t, int64(12), res2.Offset)
 
-	pos := art.Get([]byte("key-1"))
+	pos, err := art.Get([]byte("key-1"))
+	assert.Nil(t, err)
 	assert.Nil(t, pos)
 
 }
@@ -56,7 +65,9 @@ func TestAdaptiveRadixTree_Size(t *testing.T) {
 	art.Put([]byte("k1"), &data.LogRecordPos{Fid: 1, Offset: 1})
 	art.Put([]byte("k2"), &data.LogRecordPos{Fid: 2, Offset: 2})
 	art.Put([]byte("k1"), &data.LogRecordPos{Fid: 1, Offset: 1})
-	assert.Equal(t, 2, art.Size())
+	size, err := art.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, size)
 }
 
 func TestAdaptiveRadixTree_Iterator(t *testing.T) {
@@ -65,7 +76,8 @@ func TestAdaptiveRadixTree_Iterator(t *testing.T) {
 	art.Put([]byte("k2"), &data.LogRecordPos{Fid: 2, Offset: 2})
 	art.Put([]byte("k3"), &data.LogRecordPos{Fid: 1, Offset: 1})
 	art.Put([]byte("k4"), &data.LogRecordPos{Fid: 2, Offset: 2})
-	iter := art.Iterator(false)
+	iter, err := art.Iterator(false)
+	assert.Nil(t, err)
 	for iter.Rewind(); iter.Valid(); iter.Next() {
 		assert.NotNil(t, iter.Key())
 		assert.NotNil(t, iter.Value())
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"fmt"
 	"go.etcd.io/bbolt"
 	"path/filepath"
 	"tiny-kvDB/data"
@@ -15,12 +16,13 @@ type BPlusTree struct {
 	tree *bbolt.DB
 }
 
-func NewBPlusTree(dirPath string, syncWrite bool) *BPlusTree {
+// NewBPlusTree 打开dirPath中的B+树索引，失败时返回的错误包装了ErrIndexOpenFailed
+func NewBPlusTree(dirPath string, syncWrite bool) (*BPlusTree, error) {
 	opts := bbolt.DefaultOptions
 	opts.NoSync = !syncWrite
 	bptree, err := bbolt.Open(filepath.Join(dirPath, bptreeIndexFileName), 0644, opts)
 	if err != nil {
-		panic("failed to open bptree")
+		return nil, fmt.Errorf("%w: %w", ErrIndexOpenFailed, err)
 	}
 
 	// 创建对应的bucket
@@ -28,31 +30,36 @@ func NewBPlusTree(dirPath string, syncWrite bool) *BPlusTree {
 		_, err := tx.CreateBucketIfNotExists(indexBucketName)
 		return err
 	}); err != nil {
-		panic("failed to open bptree")
+		_ = bptree.Close()
+		return nil, fmt.Errorf("%w: %w", ErrIndexOpenFailed, err)
 	}
 
 	return &BPlusTree{
 		tree: bptree,
-	}
+	}, nil
 }
 
-func (bpt *BPlusTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+// Put 向索引中存储key对应的数据位置信息，返回原来的位置信息
+func (bpt *BPlusTree) Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error) {
 	var olderIt []byte
 	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
-		olderIt = bucket.Get(key)
+		// bbolt返回的value只在事务内有效
+		if value := bucket.Get(key); len(value) != 0 {
+			olderIt = append([]byte(nil), value...)
+		}
 		return bucket.Put(key, data.EncodeLogRecordPos(pos))
 	}); err != nil {
-		panic("failed to put value in bptree")
+		return nil, err
 	}
 	if len(olderIt) == 0 {
-		return nil
+		return nil, nil
 	}
-	return data.DecodeLogRecordPos(olderIt)
+	return data.DecodeLogRecordPos(olderIt), nil
 }
 
 // Get 根据key存储索引位置信息
-func (bpt *BPlusTree) Get(key []byte) *data.LogRecordPos {
+func (bpt *BPlusTree) Get(key []byte) (*data.LogRecordPos, error) {
 	var pos *data.LogRecordPos
 	if err := bpt.tree.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
@@ -62,49 +69,44 @@ func (bpt *BPlusTree) Get(key []byte) *data.LogRecordPos {
 		}
 		return nil
 	}); err != nil {
-		panic("failed to get value in bptree")
+		return nil, err
 	}
-	return pos
+	return pos, nil
 }
 
 // Delete 根据key删除对应的索引位置信息
-func (bpt *BPlusTree) Delete(key []byte) (*data.LogRecordPos, bool) {
-	var (
-		olderIt []byte
-	)
+func (bpt *BPlusTree) Delete(key []byte) (*data.LogRecordPos, bool, error) {
+	var pos *data.LogRecordPos
 	if err := bpt.tree.Update(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
-
-		if olderIt = bucket.Get(key); len(olderIt) != 0 {
+		if value := bucket.Get(key); len(value) != 0 {
+			pos = data.DecodeLogRecordPos(value)
 			return bucket.Delete(key)
 		}
 		return nil
 	}); err != nil {
-		panic("failed to delete value in bptree")
-	}
-	if len(olderIt) == 0 {
-		return nil, false
+		return nil, false, err
 	}
-	return data.DecodeLogRecordPos(olderIt), true
+	return pos, pos != nil, nil
 }
 
-func (bpt *BPlusTree) Size() int {
+func (bpt *BPlusTree) Size() (int, error) {
 	var size int
 	if err := bpt.tree.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket(indexBucketName)
 		size = bucket.Stats().KeyN
 		return nil
 	}); err != nil {
-		panic("failed to get value in bptree")
+		return 0, err
 	}
-	return size
+	return size, nil
 }
 
 func (bpt *BPlusTree) Close() error {
 	return bpt.tree.Close()
 }
 
-func (bpt *BPlusTree) Iterator(reverse bool) Iterator {
+func (bpt *BPlusTree) Iterator(reverse bool) (Iterator, error) {
 	return newBptreeIterator(bpt.tree, reverse)
 }
 
@@ -117,10 +119,10 @@ type bptreeIterator struct {
 	curValue []byte
 }
 
-func newBptreeIterator(tree *bbolt.DB, reverse bool) *bptreeIterator {
+func newBptreeIterator(tree *bbolt.DB, reverse bool) (*bptreeIterator, error) {
 	tx, err := tree.Begin(false)
 	if err != nil {
-		panic("failed to begin a transaction")
+		return nil, err
 	}
 	bpi := &bptreeIterator{
 		tx:      tx,
@@ -128,7 +130,7 @@ func newBptreeIterator(tree *bbolt.DB, reverse bool) *bptreeIterator {
 		reverse: reverse,
 	}
 	bpi.Rewind()
-	return bpi
+	return bpi, nil
 }
 
 func (bpi *bptreeIterator) Rewind() {
@@ -11,22 +11,29 @@ import (
 
 func TestNew(t *testing.T) {
 	path := filepath.Join("/tmp")
-	tree := NewBPlusTree(path, false)
+	tree, err := NewBPlusTree(path, false)
+	assert.Nil(t, err)
 	defer func() {
 		_ = os.RemoveAll(path)
 	}()
 	tree.Put(utils.GetTestKey(1), &data.LogRecordPos{Fid: 1, Offset: 12})
 	tree.Put(utils.GetTestKey(2), &data.LogRecordPos{Fid: 2, Offset: 12})
 	tree.Put(utils.GetTestKey(3), &data.LogRecordPos{Fid: 3, Offset: 12})
-	val := tree.Get(utils.GetTestKey(2))
+	val, err := tree.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
 	t.Log(val)
 
-	tree.Delete(utils.GetTestKey(2))
-	val = tree.Get(utils.GetTestKey(2))
+	_, _, err = tree.Delete(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	val, err = tree.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
 	t.Log(val)
-	t.Log(tree.Size())
+	size, err := tree.Size()
+	assert.Nil(t, err)
+	t.Log(size)
 
-	iter := tree.Iterator(false)
+	iter, err := tree.Iterator(false)
+	assert.Nil(t, err)
 	for iter.Rewind(); iter.Valid(); iter.Next() {
 		t.Log(string(iter.Key()))
 	}
@@ -35,14 +42,37 @@ func TestNew(t *testing.T) {
 
 func TestBPlussTree_Put(t *testing.T) {
 	art := NewBTree()
-	res1 := art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	res1, err := art.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	res2 := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	res2, err := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.Nil(t, err)
 	assert.Nil(t, res2)
 
-	res3 := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 2, Offset: 13})
+	res3, err := art.Put([]byte("key-2"), &data.LogRecordPos{Fid: 2, Offset: 13})
+	assert.Nil(t, err)
 	assert.NotNil(t, res3)
 	assert.Equal(t, uint32(1), res3.Fid)
 	assert.Equal(t, int64(12), res3.Offset)
 }
+
+func TestBPlusTree_ClosedError(t *testing.T) {
+	tree, err := NewBPlusTree(t.TempDir(), false)
+	assert.Nil(t, err)
+	_, err = tree.Put(utils.GetTestKey(1), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Close())
+
+	// 底层的bbolt出错时返回错误，不会panic
+	_, err = tree.Put(utils.GetTestKey(2), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.NotNil(t, err)
+	_, err = tree.Get(utils.GetTestKey(1))
+	assert.NotNil(t, err)
+	_, _, err = tree.Delete(utils.GetTestKey(1))
+	assert.NotNil(t, err)
+	_, err = tree.Size()
+	assert.NotNil(t, err)
+	_, err = tree.Iterator(false)
+	assert.NotNil(t, err)
+}
@@ -3,7 +3,6 @@ package index
 import (
 	"bytes"
 	"github.com/google/btree"
-	"sort"
 	"sync"
 	"tiny-kvDB/data"
 )
@@ -19,99 +18,114 @@ func NewBTree() *BTree {
 		lock: new(sync.RWMutex),
 	}
 }
-func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+func (bt *BTree) Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error) {
 	it := &Item{key: key, pos: pos}
 	bt.lock.Lock()
 	olderIt := bt.tree.ReplaceOrInsert(it)
 	bt.lock.Unlock()
 	if olderIt == nil {
-		return nil
+		return nil, nil
 	}
-	return olderIt.(*Item).pos
+	return olderIt.(*Item).pos, nil
 }
-func (bt *BTree) Get(key []byte) *data.LogRecordPos {
+func (bt *BTree) Get(key []byte) (*data.LogRecordPos, error) {
 	it := &Item{key: key}
 	bt.lock.Lock()
 	btreeItem := bt.tree.Get(it)
 	bt.lock.Unlock()
 	if btreeItem == nil {
-		return nil
+		return nil, nil
 	}
-	return btreeItem.(*Item).pos
+	return btreeItem.(*Item).pos, nil
 }
-func (bt *BTree) Delete(key []byte) (*data.LogRecordPos, bool) {
+func (bt *BTree) Delete(key []byte) (*data.LogRecordPos, bool, error) {
 	it := &Item{key: key}
 	bt.lock.Lock()
 	defer bt.lock.Unlock()
 	oldItem := bt.tree.Delete(it)
 	if oldItem == nil {
-		return nil, false
+		return nil, false, nil
 	}
-	return oldItem.(*Item).pos, true
+	return oldItem.(*Item).pos, true, nil
 }
 
-func (bt *BTree) Size() int {
-	return bt.tree.Len()
+func (bt *BTree) Size() (int, error) {
+	return bt.tree.Len(), nil
 }
-func (bt *BTree) Iterator(reverse bool) Iterator {
+func (bt *BTree) Iterator(reverse bool) (Iterator, error) {
 	if bt.tree == nil {
-		return nil
+		return nil, nil
 	}
 	bt.lock.Lock()
 	defer bt.lock.Unlock()
-	return newBTreeIterator(bt.tree, reverse)
+	return newBTreeIterator(bt.tree, reverse), nil
 }
 
 func (bt *BTree) Close() error {
 	return nil
 }
 
+// btreeIteratorBatch 迭代器每次从快照中取出的索引项数量
+const btreeIteratorBatch = 64
+
 // Btree索引迭代器
+// 创建时用Clone得到索引的写时复制快照，不需要拷贝整个索引，遍历时按批次从快照中取出索引项，
+// 所以Seek之后只遍历一小段范围的开销和索引的大小无关
 type btreeIterator struct {
-	curIndex int     // 当前遍历的下标位置
-	reverse  bool    // 是否是反向遍历
-	values   []*Item // 对应key的索引值
+	tree     *btree.BTree // 创建迭代器时的索引快照
+	reverse  bool         // 是否是反向遍历
+	curIndex int          // 当前遍历的下标位置
+	values   []*Item      // 当前批次的索引项
+	hasMore  bool         // 快照中当前批次之后是否可能还有索引项
 }
 
+// newBTreeIterator 调用方需要持有索引的写锁，Clone会修改原来的树
 func newBTreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
-	var idx int
-	values := make([]*Item, tree.Len())
-
-	// 将数组放到数组中
-	saveValues := func(it btree.Item) bool {
-		values[idx] = it.(*Item)
-		idx++
-		return true
+	bti := &btreeIterator{
+		tree:    tree.Clone(),
+		reverse: reverse,
 	}
-	// 逆序放置
-	if reverse {
-		tree.Descend(saveValues)
-	} else {
-		tree.Ascend(saveValues)
+	bti.Rewind()
+	return bti
+}
+
+// fill 从pivot开始取出下一批索引项，pivot为nil时从头开始，exclusive为true时跳过等于pivot的索引项
+func (bti *btreeIterator) fill(pivot *Item, exclusive bool) {
+	bti.curIndex = 0
+	bti.values = bti.values[:0]
+	collect := func(it btree.Item) bool {
+		item := it.(*Item)
+		if exclusive && bytes.Equal(item.key, pivot.key) {
+			return true
+		}
+		bti.values = append(bti.values, item)
+		return len(bti.values) < btreeIteratorBatch
 	}
-	return &btreeIterator{
-		curIndex: 0,
-		reverse:  reverse,
-		values:   values,
+	switch {
+	case pivot == nil && bti.reverse:
+		bti.tree.Descend(collect)
+	case pivot == nil:
+		bti.tree.Ascend(collect)
+	case bti.reverse:
+		bti.tree.DescendLessOrEqual(pivot, collect)
+	default:
+		bti.tree.AscendGreaterOrEqual(pivot, collect)
 	}
+	bti.hasMore = len(bti.values) == btreeIteratorBatch
 }
 
 func (bti *btreeIterator) Rewind() {
-	bti.curIndex = 0
+	bti.fill(nil, false)
 }
 func (bti *btreeIterator) Seek(key []byte) {
-	if bti.reverse {
-		bti.curIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) <= 0
-		})
-	} else {
-		bti.curIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) >= 0
-		})
-	}
+	// 正向遍历时定位到第一个大于等于key的位置，反向遍历时定位到第一个小于等于key的位置
+	bti.fill(&Item{key: key}, false)
 }
 func (bti *btreeIterator) Next() {
 	bti.curIndex++
+	if bti.curIndex == len(bti.values) && bti.hasMore {
+		bti.fill(bti.values[len(bti.values)-1], true)
+	}
 }
 func (bti *btreeIterator) Valid() bool {
 	return bti.curIndex < len(bti.values)
@@ -123,5 +137,6 @@ func (bti *btreeIterator) Value() *data.LogRecordPos {
 	return bti.values[bti.curIndex].pos
 }
 func (bti *btreeIterator) Close() {
+	bti.tree = nil
 	bti.values = nil
 }
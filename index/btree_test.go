@@ -0,0 +1,77 @@
+package index
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"tiny-kvDB/data"
+)
+
+func TestBTree_Iterator(t *testing.T) {
+	bt := NewBTree()
+	// 数量超过一个批次，遍历时需要多次从快照中取出
+	n := btreeIteratorBatch*3 + 5
+	for i := 0; i < n; i++ {
+		bt.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	iter, err := bt.Iterator(false)
+	assert.Nil(t, err)
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, []byte(fmt.Sprintf("key-%04d", count)), iter.Key())
+		assert.Equal(t, int64(count), iter.Value().Offset)
+		count++
+	}
+	assert.Equal(t, n, count)
+
+	// 正向Seek定位到第一个大于等于key的位置
+	iter.Seek([]byte("key-0100x"))
+	assert.True(t, iter.Valid())
+	assert.Equal(t, []byte("key-0101"), iter.Key())
+	iter.Seek([]byte("zzz"))
+	assert.False(t, iter.Valid())
+	iter.Close()
+
+	// 反向Seek定位到第一个小于等于key的位置
+	iter, err = bt.Iterator(true)
+	assert.Nil(t, err)
+	iter.Seek([]byte("key-0100x"))
+	count = 0
+	for ; iter.Valid(); iter.Next() {
+		assert.Equal(t, []byte(fmt.Sprintf("key-%04d", 100-count)), iter.Key())
+		count++
+	}
+	assert.Equal(t, 101, count)
+	iter.Seek([]byte("a"))
+	assert.False(t, iter.Valid())
+	iter.Close()
+}
+
+func TestBTree_IteratorSnapshot(t *testing.T) {
+	bt := NewBTree()
+	for i := 0; i < btreeIteratorBatch*2; i++ {
+		bt.Put([]byte(fmt.Sprintf("key-%04d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	iter, err := bt.Iterator(false)
+	assert.Nil(t, err)
+	defer iter.Close()
+
+	// 创建迭代器之后的写入不影响遍历结果
+	for i := 0; i < btreeIteratorBatch*2; i += 2 {
+		bt.Delete([]byte(fmt.Sprintf("key-%04d", i)))
+	}
+	bt.Put([]byte("key-0000a"), &data.LogRecordPos{Fid: 2})
+	bt.Put([]byte("key-0001"), &data.LogRecordPos{Fid: 2})
+
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, []byte(fmt.Sprintf("key-%04d", count)), iter.Key())
+		assert.Equal(t, uint32(1), iter.Value().Fid)
+		count++
+	}
+	assert.Equal(t, btreeIteratorBatch*2, count)
+	size, err := bt.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, btreeIteratorBatch+1, size)
+}
@@ -2,22 +2,29 @@ package index
 
 import (
 	"bytes"
+	"errors"
 	"github.com/google/btree"
 	"tiny-kvDB/data"
 )
 
+var (
+	ErrUnsupportedIndexType = errors.New("unsupported index type")
+	ErrIndexOpenFailed      = errors.New("failed to open index")
+)
+
 // Indexer 抽象索引接口，后续想加入数据结构实现当前接口
+// 内存索引不会返回错误，B+树索引读写磁盘失败时返回错误
 type Indexer interface {
-	// Put 向索引中存储key对应的数据位置信息
-	Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos
+	// Put 向索引中存储key对应的数据位置信息，返回原来的位置信息
+	Put(key []byte, pos *data.LogRecordPos) (*data.LogRecordPos, error)
 	// Get 根据key存储索引位置信息
-	Get(key []byte) *data.LogRecordPos
+	Get(key []byte) (*data.LogRecordPos, error)
 	// Delete 根据key删除对应的索引位置信息
-	Delete(key []byte) (*data.LogRecordPos, bool)
+	Delete(key []byte) (*data.LogRecordPos, bool, error)
 
-	Size() int
-	Close() error                   // 关闭索引
-	Iterator(reverse bool) Iterator // 返回迭代器
+	Size() (int, error)                      // 索引中key的数量
+	Close() error                            // 关闭索引
+	Iterator(reverse bool) (Iterator, error) // 返回迭代器
 }
 
 type Iterator interface {
@@ -51,15 +58,16 @@ const (
 	BPTree
 )
 
-func NewIndexer(indexType IndexType, dirPath string, sync bool) Indexer {
+// NewIndexer 根据索引类型创建索引，不支持的类型返回ErrUnsupportedIndexType
+func NewIndexer(indexType IndexType, dirPath string, sync bool) (Indexer, error) {
 	switch indexType {
 	case Btree:
-		return NewBTree()
+		return NewBTree(), nil
 	//case ART:
-	//	return NewART()
+	//	return NewART(), nil
 	//case BPTree:
 	//	return NewBPlusTree(dirPath, sync)
 	default:
-		panic("unsupported index type")
+		return nil, ErrUnsupportedIndexType
 	}
 }
@@ -0,0 +1,22 @@
+package index
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewIndexer(t *testing.T) {
+	indexer, err := NewIndexer(Btree, "", false)
+	assert.Nil(t, err)
+	assert.NotNil(t, indexer)
+
+	_, err = NewIndexer(IndexType(100), "", false)
+	assert.Equal(t, ErrUnsupportedIndexType, err)
+}
+
+func TestNewBPlusTree_OpenFailed(t *testing.T) {
+	_, err := NewBPlusTree(filepath.Join(t.TempDir(), "not-exist"), false)
+	assert.True(t, errors.Is(err, ErrIndexOpenFailed))
+}
@@ -2,22 +2,35 @@ package tiny_kvDB
 
 import (
 	"bytes"
+	"tiny-kvDB/data"
 	"tiny-kvDB/index"
 )
 
+// Iterator 数据库迭代器
+// 创建时固定索引快照和当时所有的数据文件，迭代期间的写入、merge和关闭数据库都不会影响迭代结果
+// BTree索引的快照是写时复制的，创建迭代器不会拷贝整个索引
 type Iterator struct {
 	indexIter index.Iterator // 索引迭代器
 	db        *DB
 	options   IteratorOptions
+	dataFiles map[uint32]*data.DataFile // 迭代器引用的数据文件，关闭迭代器前不会被关闭或删除
 }
 
-func (db *DB) NewIterator(options IteratorOptions) *Iterator {
-	indexIter := db.index.Iterator(options.Reverse)
+// NewIterator 创建迭代器，索引无法创建迭代器时返回错误
+func (db *DB) NewIterator(options IteratorOptions) (*Iterator, error) {
+	// 加读锁，保证索引快照中不会出现只提交了一半的事务
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	indexIter, err := db.index.Iterator(options.Reverse)
+	if err != nil {
+		return nil, err
+	}
 	return &Iterator{
 		db:        db,
 		indexIter: indexIter,
 		options:   options,
-	}
+		dataFiles: db.pinDataFiles(),
+	}, nil
 }
 func (it *Iterator) Rewind() {
 	it.indexIter.Rewind()
@@ -39,12 +52,17 @@ func (it *Iterator) Key() []byte {
 }
 func (it *Iterator) Value() ([]byte, error) { // 拿到对应的value
 	logRecordPos := it.indexIter.Value()
-	it.db.mu.RLock()
-	defer it.db.mu.RUnlock()
-	return it.db.getValueByPosition(logRecordPos)
+	// 只从迭代器引用的数据文件中读取，不受活跃文件切换和merge的影响
+	return it.db.readValue(logRecordPos, func(fileID uint32) *data.DataFile {
+		return it.dataFiles[fileID]
+	})
 }
 func (it *Iterator) Close() {
 	it.indexIter.Close()
+	if it.dataFiles != nil {
+		it.db.unpinDataFiles(it.dataFiles)
+		it.dataFiles = nil
+	}
 }
 
 // 跳过所有不满足options中prefix的key
@@ -16,7 +16,8 @@ func TestDB_NewIterator(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 
-	iterator := db.NewIterator(DefaultIteratorOptions)
+	iterator, err := db.NewIterator(DefaultIteratorOptions)
+	assert.Nil(t, err)
 	assert.NotNil(t, iterator)
 	assert.Equal(t, false, iterator.Valid())
 }
@@ -35,7 +36,8 @@ func TestDB_NewIterator_OneValue(t *testing.T) {
 	err = db.Put(key, value)
 	assert.Nil(t, err)
 
-	iterator := db.NewIterator(DefaultIteratorOptions)
+	iterator, err := db.NewIterator(DefaultIteratorOptions)
+	assert.Nil(t, err)
 	assert.NotNil(t, iterator)
 	assert.Equal(t, true, iterator.Valid())
 	iterValue, err := iterator.Value()
@@ -60,7 +62,8 @@ func TestDB_NewIterator_MultiValue(t *testing.T) {
 	assert.Nil(t, err)
 	err = db.Put([]byte("cc"), utils.RandomValue(1))
 	assert.Nil(t, err)
-	iter := db.NewIterator(DefaultIteratorOptions)
+	iter, err := db.NewIterator(DefaultIteratorOptions)
+	assert.Nil(t, err)
 	assert.NotNil(t, iter)
 
 	// 正向遍历
@@ -76,7 +79,8 @@ func TestDB_NewIterator_MultiValue(t *testing.T) {
 	// 反向迭代
 	opt2 := DefaultIteratorOptions
 	opt2.Reverse = true
-	iter2 := db.NewIterator(opt2)
+	iter2, err := db.NewIterator(opt2)
+	assert.Nil(t, err)
 	assert.NotNil(t, iter2)
 	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
 		assert.NotNil(t, iter2.Key())
@@ -89,9 +93,82 @@ func TestDB_NewIterator_MultiValue(t *testing.T) {
 	// 测试prefix
 	opt3 := DefaultIteratorOptions
 	opt3.Prefix = []byte("b")
-	iter3 := db.NewIterator(opt3)
+	iter3, err := db.NewIterator(opt3)
+	assert.Nil(t, err)
 	assert.NotNil(t, iter3)
 	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
 		assert.NotNil(t, iter3.Key())
 	}
 }
+
+// 迭代器创建后的写入、删除不影响迭代结果
+func TestDB_NewIterator_Snapshot(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	values := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		values[string(utils.GetTestKey(i))] = utils.RandomValue(128)
+		err := db.Put(utils.GetTestKey(i), values[string(utils.GetTestKey(i))])
+		assert.Nil(t, err)
+	}
+
+	iter, err := db.NewIterator(DefaultIteratorOptions)
+	assert.Nil(t, err)
+	defer iter.Close()
+
+	// 覆盖、删除、新增数据，并切换多个活跃文件
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+		} else {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+		}
+	}
+	for i := 100; i < 500; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		value, err := iter.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, values[string(iter.Key())], value)
+		count++
+	}
+	assert.Equal(t, 100, count)
+}
+
+// 数据库关闭后，未关闭的迭代器依然可以读取数据
+func TestDB_NewIterator_AfterClose(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	key, value := utils.GetTestKey(1), utils.RandomValue(10)
+	assert.Nil(t, db.Put(key, value))
+
+	iter, err := db.NewIterator(DefaultIteratorOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	iter.Rewind()
+	assert.True(t, iter.Valid())
+	iterValue, err := iter.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, value, iterValue)
+	iter.Close()
+	assert.Equal(t, 0, len(db.fileRefs))
+}
@@ -0,0 +1,96 @@
+package tiny_kvDB
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel 日志级别
+type LogLevel int8
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "debug"
+	case LogInfo:
+		return "info"
+	case LogWarn:
+		return "warn"
+	case LogError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Logger 数据库输出日志的接口，通过Options.Logger设置
+// keyvals是成对出现的字段名和字段值，例如Log(LogWarn, "failed to remove merge directory", "path", path, "err", err)
+// 适配其他日志库时只需要实现这一个方法
+type Logger interface {
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+// nopLogger 不输出任何日志，没有设置Options.Logger时使用
+type nopLogger struct{}
+
+func (nopLogger) Log(LogLevel, string, ...interface{}) {}
+
+// textLogger 以key=value的文本格式输出日志
+type textLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level LogLevel
+}
+
+// NewTextLogger 创建一个输出到w的Logger，只输出不低于level的日志，每条日志一行
+//
+//	time=2024-01-02T15:04:05.000Z07:00 level=warn msg="failed to remove merge directory" path=/tmp/db-merge err="..."
+func NewTextLogger(w io.Writer, level LogLevel) Logger {
+	return &textLogger{w: w, level: level}
+}
+
+func (l *textLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	if level < l.level {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString("time=")
+	sb.WriteString(time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	sb.WriteString(" level=")
+	sb.WriteString(level.String())
+	sb.WriteString(" msg=")
+	sb.WriteString(quoteLogValue(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		sb.WriteByte(' ')
+		sb.WriteString(fmt.Sprint(keyvals[i]))
+		sb.WriteByte('=')
+		if i+1 < len(keyvals) {
+			sb.WriteString(quoteLogValue(fmt.Sprint(keyvals[i+1])))
+		} else {
+			sb.WriteString(`"(missing)"`)
+		}
+	}
+	sb.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.w, sb.String())
+}
+
+// 值中有空白、引号或者等号时加上引号
+func quoteLogValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
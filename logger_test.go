@@ -0,0 +1,63 @@
+package tiny_kvDB
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"tiny-kvDB/utils"
+)
+
+func TestTextLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewTextLogger(buf, LogInfo)
+	logger.Log(LogDebug, "ignored")
+	logger.Log(LogWarn, "failed to remove merge directory", "path", "/tmp/a b", "err", errors.New("busy"), "file", 3)
+	logger.Log(LogError, "odd", "key")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "time="))
+	assert.True(t, strings.HasSuffix(lines[0], ` level=warn msg="failed to remove merge directory" path="/tmp/a b" err=busy file=3`))
+	assert.True(t, strings.HasSuffix(lines[1], ` level=error msg=odd key="(missing)"`))
+}
+
+func TestDB_Logger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-logger")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	opts.Logger = NewTextLogger(buf, LogInfo)
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `msg="database opened"`)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	assert.Nil(t, db.Merge())
+	assert.Contains(t, buf.String(), `msg="merge started"`)
+	assert.Contains(t, buf.String(), `msg="merge finished" keys=100`)
+}
+
+func TestDB_StatError(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-stat")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("value")))
+	stat, err := db.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), stat.KeyNum)
+
+	// 数据目录不存在时返回错误，不会panic
+	assert.Nil(t, os.RemoveAll(dir))
+	_, err = db.Stat()
+	assert.NotNil(t, err)
+	_ = db.Close()
+}
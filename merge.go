@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"sync/atomic"
+	"time"
 	"tiny-kvDB/data"
 	"tiny-kvDB/utils"
 )
@@ -18,6 +20,17 @@ const (
 
 // Merge 清理无效文件生成Hint文件
 func (db *DB) Merge() error {
+	// 从节点的数据文件需要和主节点保持一致，通过Follower.Merge执行
+	db.mu.RLock()
+	readOnly := db.readOnly
+	db.mu.RUnlock()
+	if readOnly {
+		return ErrDatabaseIsReadOnly
+	}
+	return db.merge()
+}
+
+func (db *DB) merge() (err error) {
 	// 数据库为空
 	if db.activeFile == nil {
 		return nil
@@ -31,9 +44,11 @@ func (db *DB) Merge() error {
 	}
 	db.isMerging = true
 	defer func() { db.isMerging = false }()
+	start := time.Now()
 
 	totalSize, err := utils.DirSize(db.options.DirPath)
 	if err != nil {
+		db.mu.Unlock()
 		return err
 	}
 	// 查看当前merge的数据是否达到了阈值
@@ -53,26 +68,62 @@ func (db *DB) Merge() error {
 		return ErrNoEnoughSpaceForMerge
 	}
 
-	// 持久化活跃文件
-	if err := db.activeFile.Sync(); err != nil {
-		db.mu.Unlock()
-		return err
-	}
-	db.olderFile[db.activeFile.FileID] = db.activeFile
-	if err := db.setActiveDataFile(); err != nil {
-		db.mu.Unlock()
-		return nil
+	if db.readOnly {
+		// 从节点的活跃文件和主节点的同名文件保持一致，不能切换，只merge已经封存的文件
+		// 还没有收到提交记录的事务，已经收到的部分会被merge丢掉
+		if len(db.pendingTxnRecords) > 0 {
+			db.mu.Unlock()
+			return ErrMergeTxnPending
+		}
+	} else {
+		// 持久化活跃文件
+		if err := db.syncActiveFile(); err != nil {
+			db.mu.Unlock()
+			return err
+		}
+		db.olderFile[db.activeFile.FileID] = db.activeFile
+		if err := db.setActiveDataFile(); err != nil {
+			db.mu.Unlock()
+			return err
+		}
 	}
 	// 记录最近没有参与的merge文件的ID，用后续的merge完成标识
 	nonMergeFileID := db.activeFile.FileID
+	db.mergeBoundary = nonMergeFileID
+	// 参与merge的记录的序列号都不超过当前的序列号
+	mergeSeqNo := atomic.LoadUint64(&db.seqNo)
 
 	// 取出所有需要的merge文件
 	var mergeFile []*data.DataFile
 	for _, file := range db.olderFile {
 		mergeFile = append(mergeFile, file)
 	}
+	db.logger.Log(LogInfo, "merge started", "files", len(mergeFile), "non_merge_file", nonMergeFileID)
+	db.listener.OnMergeStarted(MergeStartedInfo{FileNum: len(mergeFile), NonMergeFileID: nonMergeFileID})
 	db.mu.Unlock()
 
+	// 统计merge前后的数据量
+	var (
+		inputSize, outputSize int64
+		keyNum                int
+	)
+	defer func() {
+		duration := time.Since(start)
+		if err != nil {
+			db.logger.Log(LogError, "merge failed", "duration", duration, "err", err)
+		} else {
+			db.logger.Log(LogInfo, "merge finished", "keys", keyNum, "input_bytes", inputSize, "output_bytes", outputSize, "duration", duration)
+		}
+		db.listener.OnMergeFinished(MergeFinishedInfo{
+			FileNum:    len(mergeFile),
+			InputSize:  inputSize,
+			OutputSize: outputSize,
+			KeyNum:     keyNum,
+			Duration:   duration,
+			Err:        err,
+		})
+	}()
+
 	// 将merge文件从小到大进行排序，一次merge
 	sort.Slice(mergeFile, func(i, j int) bool {
 		return mergeFile[i].FileID < mergeFile[j].FileID
@@ -95,6 +146,7 @@ func (db *DB) Merge() error {
 	mergeOptions := db.options
 	mergeOptions.DirPath = mergePath
 	mergeOptions.SyncWrites = false
+	mergeOptions.EventListener = nil
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
@@ -115,21 +167,42 @@ func (db *DB) Merge() error {
 				if err == io.EOF {
 					break
 				}
+				if err == data.ErrInvalidCRC {
+					db.reportCorruption(dataFile.FileID, offset, err)
+				}
 				return err
 			}
 			// 解析拿到的key
-			realKey, _ := parseLogRecordKey(logRecord.Key)
-			logRecordPos := db.index.Get(realKey)
+			realKey, seqNo := parseLogRecordKey(logRecord.Key)
+			logRecordPos, err := db.index.Get(realKey)
+			if err != nil {
+				return err
+			}
 
 			// 此时内存索引的数据和当前数据文件的数据是一样的，表示当前数据是有效的
 			if logRecordPos != nil && logRecordPos.Offset == offset && logRecordPos.Fid == dataFile.FileID {
-				// 清除事务标记
-				logRecord.Key = logRecordKeyWithSeq(realKey, nonTransactionSeqNo)
+				// 有效的记录都已经提交，保留序列号，标记为非事务写入
+				logRecord.Key = logRecordKeyWithSeq(realKey, seqNo)
+				logRecord.AutoCommit = true
+				// merge操作数链表合并成一条普通记录
+				if logRecord.Type == data.LogRecordMerge {
+					db.mu.RLock()
+					value, err := db.getValueByPosition(logRecordPos)
+					db.mu.RUnlock()
+					if err != nil {
+						return err
+					}
+					logRecord.Value = value
+					logRecord.Type = data.LogRecordNormal
+				}
 				pos, err := mergeDB.appendLogRecord(logRecord)
 				if err != nil {
 					return err
 				}
 
+				outputSize += int64(pos.Size)
+				keyNum++
+
 				// 将位置索引写到hint文件中
 				if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
 					return err
@@ -137,6 +210,7 @@ func (db *DB) Merge() error {
 			}
 			offset += size
 		}
+		inputSize += offset
 	}
 
 	// 保证持久化
@@ -146,9 +220,31 @@ func (db *DB) Merge() error {
 	if err := mergeDB.Sync(); err != nil {
 		return err
 	}
+	// 从节点的数据文件大小由主节点决定，merge后的文件可能更多，不能覆盖没有参与merge的文件
+	if mergeDB.activeFile != nil && mergeDB.activeFile.FileID >= nonMergeFileID {
+		return ErrMergeOutputOverflow
+	}
+
+	// hint文件中的记录在重启时不会重新遍历，序列号随merge结果一起保存，
+	// 避免没有正常关闭时重启后的序列号回退
+	if err := writeSeqNoFile(mergePath, mergeSeqNo); err != nil {
+		return err
+	}
 
 	// 写标识merge过程完成的文件
-	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
+	if err := writeMergeFinishedFile(mergePath, nonMergeFileID); err != nil {
+		return err
+	}
+	db.metrics.mergeDuration.observe(time.Since(start))
+	if inputSize > outputSize {
+		atomic.AddUint64(&db.metrics.mergeReclaimedBytes, uint64(inputSize-outputSize))
+	}
+	return nil
+}
+
+// 写标识merge完成的文件，小于nonMergeFileID的数据文件的索引都在hint文件中
+func writeMergeFinishedFile(dirPath string, nonMergeFileID uint32) error {
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
 	if err != nil {
 		return err
 	}
@@ -158,10 +254,14 @@ func (db *DB) Merge() error {
 	}
 	encRecord, _ := data.EncodeLogRecord(mergeFinRecord)
 	if err := mergeFinishedFile.Write(encRecord); err != nil {
+		_ = mergeFinishedFile.Close()
 		return err
 	}
-
-	return nil
+	if err := mergeFinishedFile.Sync(); err != nil {
+		_ = mergeFinishedFile.Close()
+		return err
+	}
+	return mergeFinishedFile.Close()
 }
 
 // 获取merge路径
@@ -180,7 +280,9 @@ func (db *DB) loadMergeFile() error {
 	}
 
 	defer func() {
-		_ = os.RemoveAll(mergePath)
+		if err := os.RemoveAll(mergePath); err != nil {
+			db.logger.Log(LogWarn, "failed to remove merge directory", "path", mergePath, "err", err)
+		}
 	}()
 
 	// 读取merge中所有文件
@@ -214,10 +316,17 @@ func (db *DB) loadMergeFile() error {
 		return nil
 	}
 
-	nonMergeFileID, err := db.getNonMergeFileID(mergePath)
+	nonMergeFileID, err := getNonMergeFileID(mergePath)
 	if err != nil {
 		return err
 	}
+	// 复制时小于该ID的文件已经被merge重写，从节点不能从中间位置继续复制
+	db.mergeBoundary = nonMergeFileID
+
+	// 数据目录中的序列号不能小于merge时保存的序列号
+	if err := db.installMergeSeqNo(mergePath); err != nil {
+		return err
+	}
 
 	// 删除旧的标识文件
 	var fileID uint32 = 0
@@ -238,16 +347,37 @@ func (db *DB) loadMergeFile() error {
 			return err
 		}
 	}
+	db.logger.Log(LogInfo, "merge files installed", "non_merge_file", nonMergeFileID, "files", len(mergeFileNames))
+	db.listener.OnMergeInstalled(MergeInstalledInfo{NonMergeFileID: nonMergeFileID, FileNum: len(mergeFileNames)})
 
 	return nil
 }
 
+// 把merge目录中保存的序列号写入数据目录，数据目录中已有更大的序列号时保留原来的
+func (db *DB) installMergeSeqNo(mergePath string) error {
+	mergeSeqNo, ok, err := readSeqNoFile(mergePath)
+	if err != nil || !ok {
+		return err
+	}
+	seqNo, _, err := readSeqNoFile(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	if seqNo >= mergeSeqNo {
+		return nil
+	}
+	return writeSeqNoFile(db.options.DirPath, mergeSeqNo)
+}
+
 // 获取最近没有参数merge的文件ID
-func (db *DB) getNonMergeFileID(dirPath string) (uint32, error) {
+func getNonMergeFileID(dirPath string) (uint32, error) {
 	mergeFinishedFile, err := data.OpenMergeFinishedFile(dirPath)
 	if err != nil {
 		return 0, err
 	}
+	defer func() {
+		_ = mergeFinishedFile.Close()
+	}()
 	record, _, err := mergeFinishedFile.ReadLogRecord(0)
 	if err != nil {
 		return 0, err
@@ -286,7 +416,9 @@ func (db *DB) loadIndexFromHintFile() error {
 
 		// 解码拿到索引信息
 		pos := data.DecodeLogRecordPos(logRecord.Value)
-		db.index.Put(logRecord.Key, pos)
+		if _, err := db.index.Put(logRecord.Key, pos); err != nil {
+			return err
+		}
 		offset += size
 	}
 
@@ -0,0 +1,104 @@
+package tiny_kvDB
+
+import (
+	"sync/atomic"
+	"time"
+	"tiny-kvDB/data"
+)
+
+// MergeOperator 合并操作符，用于在不读取旧值的情况下完成读-改-写
+// 例如计数器、集合求并集、追加列表等
+type MergeOperator interface {
+	// FullMerge 将key已有的值和按写入顺序排列的操作数合并成新的值
+	// existing为nil表示key之前不存在
+	FullMerge(key, existing []byte, operands [][]byte) ([]byte, error)
+}
+
+// MergeValue 写入一个merge操作数，不读取旧值，读取时再通过Options.MergeOperator合并
+func (db *DB) MergeValue(key, operand []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if db.options.MergeOperator == nil {
+		return ErrMergeOperatorNotSet
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	prev, err := db.index.Get(key)
+	if err != nil {
+		return err
+	}
+	// 上一条记录所在的文件会被正在进行（或尚未生效）的merge重写，不能再引用它的位置
+	// 此时直接合并出新值，写一条普通记录
+	if prev != nil && prev.Fid < db.mergeBoundary {
+		existing, err := db.getValueByPosition(prev)
+		if err != nil {
+			return err
+		}
+		value, err := db.options.MergeOperator.FullMerge(key, existing, [][]byte{operand})
+		if err != nil {
+			return err
+		}
+		_, err = db.put(key, value)
+		return err
+	}
+
+	seqNo := atomic.AddUint64(&db.seqNo, 1)
+	logRecord := &data.LogRecord{
+		Key:        logRecordKeyWithSeq(key, seqNo),
+		Value:      data.EncodeMergeOperand(prev, operand),
+		Type:       data.LogRecordMerge,
+		AutoCommit: true,
+		Timestamp:  time.Now().UnixNano(),
+	}
+	pos, err := db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+	// 操作数链表上的记录都是有效的，覆盖或删除时整条链表一起失效
+	if prev != nil {
+		pos.Size += prev.Size
+	}
+	if _, err := db.index.Put(key, pos); err != nil {
+		return err
+	}
+	db.publish(seqNo, &Change{Type: ChangeMerge, Key: key, Value: operand})
+	return nil
+}
+
+// foldMergeOperands 从链表头部的操作数开始向前找到基础值，再将所有操作数合并
+func (db *DB) foldMergeOperands(head *data.LogRecord, getFile func(fileID uint32) *data.DataFile) ([]byte, error) {
+	if db.options.MergeOperator == nil {
+		return nil, ErrMergeOperatorNotSet
+	}
+	var (
+		existing []byte
+		operands [][]byte
+	)
+	logRecord := head
+	for logRecord != nil {
+		if logRecord.Type != data.LogRecordMerge {
+			if logRecord.Type != data.LogRecordDeleted {
+				existing = logRecord.Value
+			}
+			break
+		}
+		prev, operand := data.DecodeMergeOperand(logRecord.Value)
+		operands = append(operands, operand)
+		if prev == nil {
+			break
+		}
+		var err error
+		if logRecord, err = readLogRecordAt(getFile(prev.Fid), prev); err != nil {
+			return nil, err
+		}
+	}
+
+	// 链表是从新到旧的，合并时需要按写入顺序
+	for i, j := 0, len(operands)-1; i < j; i, j = i+1, j-1 {
+		operands[i], operands[j] = operands[j], operands[i]
+	}
+	key, _ := parseLogRecordKey(head.Key)
+	return db.options.MergeOperator.FullMerge(key, existing, operands)
+}
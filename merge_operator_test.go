@@ -0,0 +1,139 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"testing"
+	"tiny-kvDB/utils"
+)
+
+// 计数器合并操作符，操作数是十进制整数的增量
+type counterMergeOperator struct{}
+
+func (counterMergeOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, error) {
+	var sum int64
+	if existing != nil {
+		num, err := strconv.ParseInt(string(existing), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sum = num
+	}
+	for _, operand := range operands {
+		num, err := strconv.ParseInt(string(operand), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sum += num
+	}
+	return []byte(strconv.FormatInt(sum, 10)), nil
+}
+
+// 追加合并操作符，按写入顺序拼接
+type appendMergeOperator struct{}
+
+func (appendMergeOperator) FullMerge(key, existing []byte, operands [][]byte) ([]byte, error) {
+	value := append([]byte{}, existing...)
+	for _, operand := range operands {
+		value = append(value, operand...)
+	}
+	return value, nil
+}
+
+func TestDB_MergeValue(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-operator")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 未设置合并操作符
+	err = db.MergeValue(utils.GetTestKey(1), []byte("1"))
+	assert.Equal(t, ErrMergeOperatorNotSet, err)
+	assert.Nil(t, db.Close())
+
+	opts.MergeOperator = appendMergeOperator{}
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	// key不存在时从空值开始合并
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(1), []byte("a")))
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(1), []byte("b")))
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ab"), val)
+
+	// 在已有值上合并
+	assert.Nil(t, db.Put(utils.GetTestKey(2), []byte("x")))
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(2), []byte("y")))
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(2), []byte("z")))
+	val, err = db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("xyz"), val)
+
+	// 覆盖后链表失效
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("c")))
+	val, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+
+	// 删除后重新开始
+	assert.Nil(t, db.Delete(utils.GetTestKey(2)))
+	assert.Nil(t, db.MergeValue(utils.GetTestKey(2), []byte("w")))
+	val, err = db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("w"), val)
+
+	// 迭代器读取合并后的值
+	iter, err := db.NewIterator(DefaultIteratorOptions)
+	assert.Nil(t, err)
+	iter.Seek(utils.GetTestKey(2))
+	assert.True(t, iter.Valid())
+	iterVal, err := iter.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("w"), iterVal)
+	iter.Close()
+
+	// 重启后重新加载操作数链表
+	assert.Nil(t, db.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	val, err = db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("w"), val)
+}
+
+// merge后操作数链表合并成普通记录
+func TestDB_MergeValueWithMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-operator")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.MergeOperator = counterMergeOperator{}
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.MergeValue(utils.GetTestKey(i%10), []byte("1")))
+	}
+	assert.Nil(t, db.Merge())
+
+	// merge之后写入的操作数不能再引用被merge的文件
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.MergeValue(utils.GetTestKey(i), []byte("-1")))
+		assert.Nil(t, db.MergeValue(utils.GetTestKey(i), []byte("2")))
+	}
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("101"), val)
+	}
+}
@@ -3,6 +3,7 @@ package tiny_kvDB
 import (
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
@@ -47,7 +48,8 @@ func TestWriteWhileMerge(t *testing.T) {
 	assert.Nil(t, err)
 	wg.Wait()
 
-	keys := db.ListKeys()
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 10000, len(keys))
 
 	err = db.Close()
@@ -58,7 +60,8 @@ func TestWriteWhileMerge(t *testing.T) {
 		_ = db2.Close()
 	}()
 	assert.Nil(t, err)
-	keys = db2.ListKeys()
+	keys, err = db2.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 10000, len(keys))
 
 	for i := 60000; i < 70000; i++ {
@@ -125,3 +128,46 @@ func TestMerge2(t *testing.T) {
 	}
 
 }
+
+// 测试merge之后没有正常关闭，重启时序列号不会回退
+func TestMerge_SeqNoAfterCrash(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-merge-seq")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	opts.DirPath = filepath.Join(dir, "db")
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	// 删除的记录在merge之后不再保留，剩下的记录中最大的序列号小于当前的序列号
+	for i := 1000; i < 2000; i++ {
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Merge())
+	lastSeq := db.LastSeq()
+
+	// 不调用Close，直接拷贝数据目录和merge目录，模拟进程崩溃后重启
+	crashOpts := opts
+	crashOpts.DirPath = filepath.Join(dir, "crash")
+	assert.Nil(t, utils.CopyDir(opts.DirPath, crashOpts.DirPath, []string{fileLockName}))
+	assert.Nil(t, utils.CopyDir(db.getMergePath(), crashOpts.DirPath+mergePathName, []string{fileLockName}))
+
+	db2, err := Open(crashOpts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	assert.Equal(t, lastSeq, db2.LastSeq())
+	// 安装merge结果时恢复merge边界，复制时拒绝从被重写的文件中间继续
+	assert.Equal(t, db.mergeBoundary, db2.mergeBoundary)
+	seqNo, err := db2.PutWithSeq([]byte("new-key"), []byte("value"))
+	assert.Nil(t, err)
+	assert.Equal(t, lastSeq+1, seqNo)
+}
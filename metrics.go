@@ -0,0 +1,162 @@
+package tiny_kvDB
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// 读写和fsync耗时的桶，单位秒
+	latencyBuckets = []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	// merge耗时的桶，单位秒
+	mergeDurationBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 1800}
+)
+
+// histogram 固定桶的直方图，所有字段都通过原子操作更新，记录时不需要加锁
+type histogram struct {
+	buckets []float64 // 每个桶的上界，单位秒
+	counts  []uint64  // 落在每个桶中的次数，最后一个是超出所有上界的次数
+	sum     uint64    // 累计耗时，单位纳秒
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := 0
+	for ; i < len(h.buckets); i++ {
+		if seconds <= h.buckets[i] {
+			break
+		}
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	snapshot := Histogram{Buckets: h.buckets, Counts: make([]uint64, len(h.buckets))}
+	var cumulative uint64
+	for i := range h.buckets {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		snapshot.Counts[i] = cumulative
+	}
+	snapshot.Count = cumulative + atomic.LoadUint64(&h.counts[len(h.buckets)])
+	snapshot.Sum = time.Duration(atomic.LoadUint64(&h.sum)).Seconds()
+	return snapshot
+}
+
+// metrics 数据库运行期间累计的指标
+type metrics struct {
+	putLatency          *histogram
+	getLatency          *histogram
+	deleteLatency       *histogram
+	syncLatency         *histogram
+	mergeDuration       *histogram
+	bytesWritten        uint64
+	mergeReclaimedBytes uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		putLatency:    newHistogram(latencyBuckets),
+		getLatency:    newHistogram(latencyBuckets),
+		deleteLatency: newHistogram(latencyBuckets),
+		syncLatency:   newHistogram(latencyBuckets),
+		mergeDuration: newHistogram(mergeDurationBuckets),
+	}
+}
+
+// Histogram 直方图的快照
+type Histogram struct {
+	Buckets []float64 // 每个桶的上界，单位秒
+	Counts  []uint64  // 小于等于对应上界的累计次数
+	Count   uint64    // 总次数
+	Sum     float64   // 总耗时，单位秒
+}
+
+// Metrics 数据库指标的快照
+type Metrics struct {
+	PutLatency          Histogram // Put的耗时
+	GetLatency          Histogram // Get的耗时
+	DeleteLatency       Histogram // Delete的耗时
+	SyncLatency         Histogram // 数据文件fsync的耗时，Count就是fsync的次数
+	MergeDuration       Histogram // merge的耗时，Count就是完成merge的次数
+	BytesWritten        uint64    // 写入数据文件的字节数
+	MergeReclaimedBytes uint64    // merge回收的字节数
+	KeyNum              int       // 索引中key的数量
+	DataFileNum         int       // 打开的数据文件数量
+	ReclaimableSize     int64     // 可以回收的数据量
+}
+
+// Metrics 返回数据库指标的快照
+// 和Stat不同，不会遍历数据目录，只短暂持有读锁，适合频繁采集
+func (db *DB) Metrics() *Metrics {
+	m := &Metrics{
+		PutLatency:          db.metrics.putLatency.snapshot(),
+		GetLatency:          db.metrics.getLatency.snapshot(),
+		DeleteLatency:       db.metrics.deleteLatency.snapshot(),
+		SyncLatency:         db.metrics.syncLatency.snapshot(),
+		MergeDuration:       db.metrics.mergeDuration.snapshot(),
+		BytesWritten:        atomic.LoadUint64(&db.metrics.bytesWritten),
+		MergeReclaimedBytes: atomic.LoadUint64(&db.metrics.mergeReclaimedBytes),
+	}
+	// 索引的写入都持有db.mu，在读锁中读取key的数量
+	db.mu.RLock()
+	keyNum, err := db.index.Size()
+	if err != nil {
+		db.logger.Log(LogWarn, "failed to get the number of keys", "err", err)
+	}
+	m.KeyNum = keyNum
+	m.DataFileNum = len(db.olderFile)
+	if db.activeFile != nil {
+		m.DataFileNum++
+	}
+	m.ReclaimableSize = db.reclaimSize
+	db.mu.RUnlock()
+	return m
+}
+
+// MetricsHandler 返回以Prometheus文本格式输出数据库指标的http.Handler
+func (db *DB) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = db.Metrics().WriteText(writer)
+	})
+}
+
+// WriteText 以Prometheus文本格式写出指标
+func (m *Metrics) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	writeHistogram(bw, "tinykv_put_duration_seconds", "Latency of Put.", m.PutLatency)
+	writeHistogram(bw, "tinykv_get_duration_seconds", "Latency of Get.", m.GetLatency)
+	writeHistogram(bw, "tinykv_delete_duration_seconds", "Latency of Delete.", m.DeleteLatency)
+	writeHistogram(bw, "tinykv_fsync_duration_seconds", "Latency of data file fsync.", m.SyncLatency)
+	writeHistogram(bw, "tinykv_merge_duration_seconds", "Duration of completed merges.", m.MergeDuration)
+	writeMetric(bw, "tinykv_written_bytes_total", "counter", "Bytes appended to data files.", strconv.FormatUint(m.BytesWritten, 10))
+	writeMetric(bw, "tinykv_merge_reclaimed_bytes_total", "counter", "Bytes reclaimed by merges.", strconv.FormatUint(m.MergeReclaimedBytes, 10))
+	writeMetric(bw, "tinykv_keys", "gauge", "Number of keys in the index.", strconv.Itoa(m.KeyNum))
+	writeMetric(bw, "tinykv_data_files", "gauge", "Number of open data files.", strconv.Itoa(m.DataFileNum))
+	writeMetric(bw, "tinykv_reclaimable_bytes", "gauge", "Bytes of stale data that a merge can reclaim.", strconv.FormatInt(m.ReclaimableSize, 10))
+	return bw.Flush()
+}
+
+func writeMetric(w io.Writer, name, typ, help, value string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, typ, name, value)
+}
+
+func writeHistogram(w io.Writer, name, help string, h Histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bucket := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bucket, 'g', -1, 64), h.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.Count)
+}
@@ -0,0 +1,100 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"tiny-kvDB/utils"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{0.001, 0.01})
+	h.observe(500 * time.Microsecond)
+	h.observe(5 * time.Millisecond)
+	h.observe(5 * time.Millisecond)
+	h.observe(time.Second)
+
+	snapshot := h.snapshot()
+	assert.Equal(t, []uint64{1, 3}, snapshot.Counts)
+	assert.Equal(t, uint64(4), snapshot.Count)
+	assert.InDelta(t, 1.0105, snapshot.Sum, 1e-9)
+}
+
+func TestDB_Metrics(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-metrics")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	for i := 0; i < 500; i++ {
+		_, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Sync())
+
+	m := db.Metrics()
+	assert.Equal(t, uint64(1000), m.PutLatency.Count)
+	assert.Equal(t, uint64(500), m.GetLatency.Count)
+	assert.Equal(t, uint64(500), m.DeleteLatency.Count)
+	assert.True(t, m.SyncLatency.Count > 0)
+	assert.True(t, m.BytesWritten > 1000*64)
+	assert.Equal(t, 500, m.KeyNum)
+	assert.True(t, m.DataFileNum > 1)
+	assert.True(t, m.ReclaimableSize > 0)
+	assert.Equal(t, uint64(0), m.MergeDuration.Count)
+
+	assert.Nil(t, db.Merge())
+	m = db.Metrics()
+	assert.Equal(t, uint64(1), m.MergeDuration.Count)
+	assert.True(t, m.MergeReclaimedBytes > 0)
+
+	recorder := httptest.NewRecorder()
+	db.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	text := string(body)
+	assert.True(t, strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, text, "# TYPE tinykv_put_duration_seconds histogram\n")
+	assert.Contains(t, text, "tinykv_put_duration_seconds_count 1000\n")
+	assert.Contains(t, text, "tinykv_put_duration_seconds_bucket{le=\"+Inf\"} 1000\n")
+	assert.Contains(t, text, "tinykv_merge_duration_seconds_count 1\n")
+	assert.Contains(t, text, "tinykv_keys 500\n")
+}
+
+// 写入期间采集指标，配合-race检查读取索引大小时的数据竞争
+func TestDB_MetricsConcurrentWrites(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-metrics-concurrent")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(16)))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			assert.Equal(t, 1000, db.Metrics().KeyNum)
+			return
+		default:
+			_ = db.Metrics()
+		}
+	}
+}
@@ -4,13 +4,18 @@ import "os"
 
 // Options db配置
 type Options struct {
-	DirPath            string    // 数据库数据目录
-	DataFileSize       int64     // 数据文件的大小
-	SyncWrites         bool      // 每次写入数据是持久化
-	BytePerSync        uint      // 累计写入到多少字节进行持久化
-	IndexType          IndexType // 索引类型
-	MMapAtStartup      bool      // 启动的时候是否加载MMap
-	DataFileMergeRatio float32   // 数据merge时的比例
+	DirPath            string        // 数据库数据目录
+	DataFileSize       int64         // 数据文件的大小
+	SyncWrites         bool          // 每次写入数据是持久化
+	BytePerSync        uint          // 累计写入到多少字节进行持久化
+	IndexType          IndexType     // 索引类型
+	MMapAtStartup      bool          // 启动的时候是否加载MMap
+	DataFileMergeRatio float32       // 数据merge时的比例
+	MergeOperator      MergeOperator // 合并操作符，使用MergeValue时必须设置
+	EventListener      EventListener // 生命周期事件的回调，为空时不回调
+	Logger             Logger        // 日志输出，为空时不输出日志
+	WatchPendingLimit  int           // 每个订阅暂存的实时事件数量上限
+	WatchBlockOnFull   bool          // 暂存的事件达到上限时阻塞写入，否则关闭订阅并通过Err返回ErrWatchPendingOverflow
 }
 
 // IteratorOptions 迭代器配置
@@ -41,6 +46,8 @@ var DefaultOptions = Options{
 	IndexType:          Btree,
 	MMapAtStartup:      true,
 	DataFileMergeRatio: 0.5,
+	WatchPendingLimit:  10000,
+	WatchBlockOnFull:   false,
 }
 var DefaultIteratorOptions = IteratorOptions{
 	Prefix:  nil,
@@ -0,0 +1,233 @@
+package raft
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	tiny_kvDB "tiny-kvDB"
+)
+
+var (
+	// reservedKeyPrefix 状态机中raft自己使用的key的前缀，用户的命令不能读写这个前缀下的key
+	reservedKeyPrefix = []byte("!raft!")
+	// 状态机中保存已应用日志下标的key，和数据在同一个批次中提交
+	appliedIndexKey = append(append([]byte(nil), reservedKeyPrefix...), "applied-index"...)
+)
+
+func isReservedKey(key []byte) bool {
+	return bytes.HasPrefix(key, reservedKeyPrefix)
+}
+
+// stateMachine 以DB作为raft的状态机，快照就是DB中的全部数据
+type stateMachine struct {
+	db           *tiny_kvDB.DB
+	options      tiny_kvDB.Options
+	batchOptions tiny_kvDB.WriteBatchOptions
+	restoring    *snapshotRestore // 正在接收的快照，还没有接收完
+}
+
+// snapshotRestore 分块接收的快照先写入单独的目录，全部接收之后再替换状态机的目录
+type snapshotRestore struct {
+	db     *tiny_kvDB.DB
+	index  uint64 // 快照对应的日志下标
+	offset uint64 // 已经接收的数据条数
+}
+
+const (
+	// 正在接收的快照所在的目录，重启时直接删除
+	restoreDirSuffix = "-restore"
+	// 接收完成的快照所在的目录，重启时如果存在说明替换状态机的目录时中断了，继续完成替换
+	readyDirSuffix = "-ready"
+)
+
+func openStateMachine(dirPath string, syncWrites bool) (*stateMachine, error) {
+	if err := os.RemoveAll(dirPath + restoreDirSuffix); err != nil {
+		return nil, err
+	}
+	if err := replaceWithReady(dirPath); err != nil {
+		return nil, err
+	}
+	options := tiny_kvDB.DefaultOptions
+	options.DirPath = dirPath
+	options.SyncWrites = syncWrites
+	db, err := tiny_kvDB.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	batchOptions := tiny_kvDB.DefaultWriteBatchOptions
+	batchOptions.SyncWrite = syncWrites
+	// 安装快照时一块数据在一个批次中写入，数量由SnapshotChunkSize决定，不受默认配置的限制
+	batchOptions.MaxBatchNum = math.MaxUint32
+	return &stateMachine{db: db, options: options, batchOptions: batchOptions}, nil
+}
+
+// replaceWithReady 用接收完成的快照目录替换状态机的目录，没有接收完成的快照时不做任何事
+// 快照目录改名之前状态机的目录可以随时删除，中途崩溃之后重新执行即可
+func replaceWithReady(dirPath string) error {
+	readyDir := dirPath + readyDirSuffix
+	if _, err := os.Stat(readyDir); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.RemoveAll(dirPath); err != nil {
+		return err
+	}
+	return os.Rename(readyDir, dirPath)
+}
+
+func (sm *stateMachine) close() error {
+	sm.abortRestore()
+	return sm.db.Close()
+}
+
+// 返回已经应用到状态机的日志下标
+func (sm *stateMachine) appliedIndex() (uint64, error) {
+	value, err := sm.db.Get(appliedIndexKey)
+	if err == tiny_kvDB.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// 应用一条日志，写操作和已应用的下标原子地提交
+// 读写保留前缀的日志返回ErrKeyReserved，写操作只推进已应用的下标
+func (sm *stateMachine) apply(entry *LogEntry) ([]byte, error) {
+	switch entry.Type {
+	case CommandPut, CommandDelete:
+		if isReservedKey(entry.Key) {
+			if err := sm.db.Put(appliedIndexKey, encodeUint64(entry.Index)); err != nil {
+				return nil, err
+			}
+			return nil, ErrKeyReserved
+		}
+		wb, err := sm.db.NewWriteBatch(sm.batchOptions)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Type == CommandPut {
+			_ = wb.Put(entry.Key, entry.Value)
+		} else {
+			_ = wb.Delete(entry.Key)
+		}
+		_ = wb.Put(appliedIndexKey, encodeUint64(entry.Index))
+		return nil, wb.Commit()
+	case CommandGet:
+		if isReservedKey(entry.Key) {
+			return nil, ErrKeyReserved
+		}
+		return sm.db.Get(entry.Key)
+	}
+	return nil, nil
+}
+
+// snapshotIterator 固定状态机当前的数据作为快照，调用方需要保证期间没有日志被应用
+// 迭代器不受之后写入和关闭数据库的影响，可以在不持有锁的情况下分块读取
+func (sm *stateMachine) snapshotIterator() (*tiny_kvDB.Iterator, error) {
+	iter, err := sm.db.NewIterator(tiny_kvDB.DefaultIteratorOptions)
+	if err != nil {
+		return nil, err
+	}
+	iter.Rewind()
+	return iter, nil
+}
+
+// readSnapshotChunk 从快照迭代器中读取最多n条数据，跳过raft保留的key，迭代器不再Valid表示读完了
+func readSnapshotChunk(iter *tiny_kvDB.Iterator, n int) ([]*KeyValue, error) {
+	var data []*KeyValue
+	for ; iter.Valid() && len(data) < n; iter.Next() {
+		if isReservedKey(iter.Key()) {
+			continue
+		}
+		value, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, &KeyValue{Key: append([]byte(nil), iter.Key()...), Value: value})
+	}
+	return data, nil
+}
+
+// restoreChunk 接收快照的一块数据，offset为0时开始接收新的快照，丢弃之前没有接收完的快照
+// 全部接收之后用快照替换状态机中的全部数据，返回是否已经替换
+func (sm *stateMachine) restoreChunk(index, offset uint64, data []*KeyValue, done bool) (bool, error) {
+	if offset == 0 {
+		sm.abortRestore()
+		options := sm.options
+		options.DirPath = sm.options.DirPath + restoreDirSuffix
+		// 快照接收完之后统一持久化
+		options.SyncWrites = false
+		db, err := tiny_kvDB.Open(options)
+		if err != nil {
+			return false, err
+		}
+		sm.restoring = &snapshotRestore{db: db, index: index}
+	}
+	r := sm.restoring
+	if r == nil || r.index != index || r.offset != offset {
+		return false, ErrSnapshotOutOfOrder
+	}
+	wb, err := r.db.NewWriteBatch(sm.batchOptions)
+	if err != nil {
+		return false, err
+	}
+	for _, kv := range data {
+		_ = wb.Put(kv.Key, kv.Value)
+	}
+	if done {
+		_ = wb.Put(appliedIndexKey, encodeUint64(index))
+	}
+	if err := wb.Commit(); err != nil {
+		sm.abortRestore()
+		return false, err
+	}
+	r.offset += uint64(len(data))
+	if !done {
+		return false, nil
+	}
+	return true, sm.finishRestore()
+}
+
+// finishRestore 持久化接收完成的快照，用它的目录替换状态机的目录之后重新打开
+func (sm *stateMachine) finishRestore() error {
+	r := sm.restoring
+	sm.restoring = nil
+	restoreDir := sm.options.DirPath + restoreDirSuffix
+	if err := r.db.Sync(); err != nil {
+		_ = r.db.Close()
+		_ = os.RemoveAll(restoreDir)
+		return err
+	}
+	if err := r.db.Close(); err != nil {
+		_ = os.RemoveAll(restoreDir)
+		return err
+	}
+	if err := os.Rename(restoreDir, sm.options.DirPath+readyDirSuffix); err != nil {
+		return err
+	}
+	// 改名之后快照已经完整地保存下来，替换中途出错时重启会继续完成替换
+	if err := sm.db.Close(); err != nil {
+		return err
+	}
+	if err := replaceWithReady(sm.options.DirPath); err != nil {
+		return err
+	}
+	db, err := tiny_kvDB.Open(sm.options)
+	if err != nil {
+		return err
+	}
+	sm.db = db
+	return nil
+}
+
+// abortRestore 丢弃没有接收完的快照
+func (sm *stateMachine) abortRestore() {
+	if sm.restoring == nil {
+		return
+	}
+	_ = sm.restoring.db.Close()
+	_ = os.RemoveAll(sm.options.DirPath + restoreDirSuffix)
+	sm.restoring = nil
+}
@@ -0,0 +1,93 @@
+package raft
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateMachine_ReservedKey(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-raft-fsm")
+	defer os.RemoveAll(dir)
+	sm, err := openStateMachine(dir, false)
+	assert.Nil(t, err)
+	defer sm.close()
+
+	_, err = sm.apply(&LogEntry{Index: 1, Type: CommandPut, Key: []byte("key"), Value: []byte("value")})
+	assert.Nil(t, err)
+	// 保留前缀下的写入不会覆盖已应用的下标，只推进下标
+	_, err = sm.apply(&LogEntry{Index: 2, Type: CommandPut, Key: appliedIndexKey, Value: encodeUint64(100)})
+	assert.Equal(t, ErrKeyReserved, err)
+	_, err = sm.apply(&LogEntry{Index: 3, Type: CommandDelete, Key: appliedIndexKey})
+	assert.Equal(t, ErrKeyReserved, err)
+	applied, err := sm.appliedIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), applied)
+	_, err = sm.apply(&LogEntry{Index: 4, Type: CommandGet, Key: []byte("!raft!other")})
+	assert.Equal(t, ErrKeyReserved, err)
+
+	iter, err := sm.snapshotIterator()
+	assert.Nil(t, err)
+	defer iter.Close()
+	data, err := readSnapshotChunk(iter, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []*KeyValue{{Key: []byte("key"), Value: []byte("value")}}, data)
+	assert.False(t, iter.Valid())
+}
+
+func TestStateMachine_RestoreChunk(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-raft-fsm")
+	defer os.RemoveAll(dir)
+	stateDir := filepath.Join(dir, stateDirName)
+	sm, err := openStateMachine(stateDir, false)
+	assert.Nil(t, err)
+	_, err = sm.apply(&LogEntry{Index: 1, Type: CommandPut, Key: []byte("old"), Value: []byte("value")})
+	assert.Nil(t, err)
+
+	chunk := func(keys ...string) []*KeyValue {
+		var data []*KeyValue
+		for _, key := range keys {
+			data = append(data, &KeyValue{Key: []byte(key), Value: []byte("v-" + key)})
+		}
+		return data
+	}
+	// 快照块必须连续，没有接收完之前状态机不变
+	installed, err := sm.restoreChunk(10, 0, chunk("a", "b"), false)
+	assert.Nil(t, err)
+	assert.False(t, installed)
+	_, err = sm.restoreChunk(10, 3, chunk("c"), false)
+	assert.Equal(t, ErrSnapshotOutOfOrder, err)
+	value, err := sm.db.Get([]byte("old"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	// offset为0时丢弃没有接收完的快照，从头开始接收
+	_, err = sm.restoreChunk(20, 0, chunk("c", "d"), false)
+	assert.Nil(t, err)
+	installed, err = sm.restoreChunk(20, 2, chunk("e"), true)
+	assert.Nil(t, err)
+	assert.True(t, installed)
+	keys, err := sm.db.ListKeys()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, [][]byte{[]byte("c"), []byte("d"), []byte("e"), appliedIndexKey}, keys)
+	applied, err := sm.appliedIndex()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), applied)
+	assert.Nil(t, sm.close())
+
+	// 替换目录时中断，重新打开时继续完成替换
+	sm, err = openStateMachine(stateDir+readyDirSuffix, false)
+	assert.Nil(t, err)
+	_, err = sm.apply(&LogEntry{Index: 30, Type: CommandPut, Key: []byte("ready"), Value: []byte("value")})
+	assert.Nil(t, err)
+	assert.Nil(t, sm.close())
+	sm, err = openStateMachine(stateDir, false)
+	assert.Nil(t, err)
+	defer sm.close()
+	keys, err = sm.db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{appliedIndexKey, []byte("ready")}, keys)
+	_, err = os.Stat(stateDir + readyDirSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
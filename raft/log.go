@@ -0,0 +1,280 @@
+package raft
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	tiny_kvDB "tiny-kvDB"
+)
+
+type CommandType = byte
+
+const (
+	// CommandNoop 新leader上任时写入的空日志，用于提交之前任期的日志
+	CommandNoop CommandType = iota
+	CommandPut
+	CommandDelete
+	// CommandGet 读请求也通过日志提交，保证线性一致
+	CommandGet
+)
+
+// LogEntry raft日志
+type LogEntry struct {
+	Index uint64
+	Term  uint64
+	Type  CommandType
+	Key   []byte
+	Value []byte
+}
+
+var (
+	logEntryPrefix      = []byte("e")
+	currentTermKey      = []byte("m-term")
+	votedForKey         = []byte("m-vote")
+	snapshotIndexKey    = []byte("m-snapshot-index")
+	snapshotTermKey     = []byte("m-snapshot-term")
+	errLogEntryNotFound = errors.New("raft log entry is not found")
+)
+
+/*
+	日志编码
+	+---------+----------+-------------+-----+-------+
+	|   type  |   term   | key size    | key | value |
+	+---------+----------+-------------+-----+-------+
+	    1B      变长(最大10)  变长(最大5)
+*/
+
+func encodeLogEntry(entry *LogEntry) []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen64+binary.MaxVarintLen32+len(entry.Key)+len(entry.Value))
+	buf[0] = entry.Type
+	var index = 1
+	index += binary.PutUvarint(buf[index:], entry.Term)
+	index += binary.PutUvarint(buf[index:], uint64(len(entry.Key)))
+	index += copy(buf[index:], entry.Key)
+	index += copy(buf[index:], entry.Value)
+	return buf[:index]
+}
+
+func decodeLogEntry(index uint64, buf []byte) *LogEntry {
+	entry := &LogEntry{Index: index, Type: buf[0]}
+	var offset = 1
+	term, n := binary.Uvarint(buf[offset:])
+	offset += n
+	keySize, n := binary.Uvarint(buf[offset:])
+	offset += n
+	entry.Term = term
+	entry.Key = buf[offset : offset+int(keySize)]
+	offset += int(keySize)
+	entry.Value = buf[offset:]
+	return entry
+}
+
+func logEntryKey(index uint64) []byte {
+	key := make([]byte, len(logEntryPrefix)+8)
+	copy(key, logEntryPrefix)
+	// 大端序保证key的顺序和日志的顺序一致
+	binary.BigEndian.PutUint64(key[len(logEntryPrefix):], index)
+	return key
+}
+
+// raftLog 持久化的raft日志，存放在单独的bitcask实例中
+// 快照之前的日志会被删除，entries[0]的下标是snapshotIndex+1
+type raftLog struct {
+	db            *tiny_kvDB.DB
+	entries       []*LogEntry
+	snapshotIndex uint64 // 最后一条被快照覆盖的日志
+	snapshotTerm  uint64
+	batchOptions  tiny_kvDB.WriteBatchOptions
+}
+
+func openRaftLog(dirPath string, syncWrites bool) (*raftLog, error) {
+	options := tiny_kvDB.DefaultOptions
+	options.DirPath = dirPath
+	options.SyncWrites = syncWrites
+	db, err := tiny_kvDB.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	batchOptions := tiny_kvDB.DefaultWriteBatchOptions
+	batchOptions.SyncWrite = syncWrites
+	// 截断和快照时一个批次中的日志数量不受限制
+	batchOptions.MaxBatchNum = math.MaxUint32
+	l := &raftLog{db: db, batchOptions: batchOptions}
+
+	if l.snapshotIndex, err = l.getUint64(snapshotIndexKey); err != nil {
+		return nil, err
+	}
+	if l.snapshotTerm, err = l.getUint64(snapshotTermKey); err != nil {
+		return nil, err
+	}
+
+	// 按顺序加载快照之后的日志
+	iterOptions := tiny_kvDB.DefaultIteratorOptions
+	iterOptions.Prefix = logEntryPrefix
+	iter, err := db.NewIterator(iterOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		index := binary.BigEndian.Uint64(iter.Key()[len(logEntryPrefix):])
+		if index <= l.snapshotIndex {
+			continue
+		}
+		if index != l.lastIndex()+1 {
+			return nil, tiny_kvDB.ErrDataDirectoryCorrupted
+		}
+		value, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		l.entries = append(l.entries, decodeLogEntry(index, value))
+	}
+	return l, nil
+}
+
+func (l *raftLog) close() error {
+	return l.db.Close()
+}
+
+func (l *raftLog) getUint64(key []byte) (uint64, error) {
+	value, err := l.db.Get(key)
+	if err == tiny_kvDB.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+func encodeUint64(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+// 加载持久化的任期和投票
+func (l *raftLog) loadState() (uint64, string, error) {
+	term, err := l.getUint64(currentTermKey)
+	if err != nil {
+		return 0, "", err
+	}
+	votedFor, err := l.db.Get(votedForKey)
+	if err != nil && err != tiny_kvDB.ErrKeyNotFound {
+		return 0, "", err
+	}
+	return term, string(votedFor), nil
+}
+
+// 持久化当前任期和投票，响应RPC之前必须完成
+func (l *raftLog) saveState(term uint64, votedFor string) error {
+	wb, err := l.db.NewWriteBatch(l.batchOptions)
+	if err != nil {
+		return err
+	}
+	_ = wb.Put(currentTermKey, encodeUint64(term))
+	if votedFor == "" {
+		_ = wb.Delete(votedForKey)
+	} else {
+		_ = wb.Put(votedForKey, []byte(votedFor))
+	}
+	return wb.Commit()
+}
+
+func (l *raftLog) lastIndex() uint64 {
+	return l.snapshotIndex + uint64(len(l.entries))
+}
+
+func (l *raftLog) lastTerm() uint64 {
+	if len(l.entries) == 0 {
+		return l.snapshotTerm
+	}
+	return l.entries[len(l.entries)-1].Term
+}
+
+// 返回index处日志的任期，日志已经被快照删除或者还不存在时返回false
+func (l *raftLog) term(index uint64) (uint64, bool) {
+	if index == l.snapshotIndex {
+		return l.snapshotTerm, true
+	}
+	if index < l.snapshotIndex || index > l.lastIndex() {
+		return 0, false
+	}
+	return l.entries[index-l.snapshotIndex-1].Term, true
+}
+
+func (l *raftLog) entry(index uint64) (*LogEntry, error) {
+	if index <= l.snapshotIndex || index > l.lastIndex() {
+		return nil, errLogEntryNotFound
+	}
+	return l.entries[index-l.snapshotIndex-1], nil
+}
+
+// 返回[from, to)之间的日志
+func (l *raftLog) slice(from, to uint64) []*LogEntry {
+	if to > l.lastIndex()+1 {
+		to = l.lastIndex() + 1
+	}
+	if from <= l.snapshotIndex || from >= to {
+		return nil
+	}
+	// 返回拷贝，之后截断日志时不会影响正在发送的日志
+	return append([]*LogEntry{}, l.entries[from-l.snapshotIndex-1:to-l.snapshotIndex-1]...)
+}
+
+// 删除from及之后的日志，再追加新的日志，两步在同一个批次中提交
+func (l *raftLog) truncateAndAppend(from uint64, entries []*LogEntry) error {
+	wb, err := l.db.NewWriteBatch(l.batchOptions)
+	if err != nil {
+		return err
+	}
+	for index := from; index <= l.lastIndex(); index++ {
+		_ = wb.Delete(logEntryKey(index))
+	}
+	for i, entry := range entries {
+		entry.Index = from + uint64(i)
+		_ = wb.Put(logEntryKey(entry.Index), encodeLogEntry(entry))
+	}
+	if err := wb.Commit(); err != nil {
+		return err
+	}
+	l.entries = append(l.entries[:from-l.snapshotIndex-1], entries...)
+	return nil
+}
+
+func (l *raftLog) append(entries ...*LogEntry) error {
+	return l.truncateAndAppend(l.lastIndex()+1, entries)
+}
+
+// 快照已经覆盖了index及之前的日志，删除这部分日志
+// 如果index之后的日志与快照不一致，需要全部丢弃
+func (l *raftLog) compact(index, term uint64) error {
+	if index <= l.snapshotIndex {
+		return nil
+	}
+	var remain []*LogEntry
+	t, ok := l.term(index)
+	keepSuffix := ok && t == term
+	if keepSuffix {
+		remain = l.entries[index-l.snapshotIndex:]
+	}
+
+	wb, err := l.db.NewWriteBatch(l.batchOptions)
+	if err != nil {
+		return err
+	}
+	for i := l.snapshotIndex + 1; i <= l.lastIndex(); i++ {
+		if i <= index || !keepSuffix {
+			_ = wb.Delete(logEntryKey(i))
+		}
+	}
+	_ = wb.Put(snapshotIndexKey, encodeUint64(index))
+	_ = wb.Put(snapshotTermKey, encodeUint64(term))
+	if err := wb.Commit(); err != nil {
+		return err
+	}
+	l.entries = append([]*LogEntry{}, remain...)
+	l.snapshotIndex, l.snapshotTerm = index, term
+	return nil
+}
@@ -0,0 +1,58 @@
+package raft
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestRaftLog(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-raft-log")
+	defer os.RemoveAll(dir)
+	l, err := openRaftLog(dir, false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), l.lastIndex())
+
+	for i := 1; i <= 10; i++ {
+		assert.Nil(t, l.append(&LogEntry{Term: 1, Type: CommandPut, Key: []byte("key"), Value: []byte{byte(i)}}))
+	}
+	assert.Equal(t, uint64(10), l.lastIndex())
+	assert.Len(t, l.slice(3, 6), 3)
+
+	// 覆盖冲突的日志
+	assert.Nil(t, l.truncateAndAppend(8, []*LogEntry{{Term: 2, Type: CommandDelete, Key: []byte("key")}}))
+	assert.Equal(t, uint64(8), l.lastIndex())
+	assert.Equal(t, uint64(2), l.lastTerm())
+
+	// 快照删除之前的日志
+	assert.Nil(t, l.compact(5, 1))
+	_, err = l.entry(5)
+	assert.Equal(t, errLogEntryNotFound, err)
+	term, ok := l.term(5)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), term)
+
+	assert.Nil(t, l.saveState(2, "node-1"))
+	assert.Nil(t, l.close())
+
+	// 重启后恢复
+	l, err = openRaftLog(dir, false)
+	assert.Nil(t, err)
+	defer l.close()
+	assert.Equal(t, uint64(5), l.snapshotIndex)
+	assert.Equal(t, uint64(8), l.lastIndex())
+	entry, err := l.entry(6)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{6}, entry.Value)
+	entry, err = l.entry(8)
+	assert.Nil(t, err)
+	assert.Equal(t, CommandDelete, entry.Type)
+	term, votedFor, err := l.loadState()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), term)
+	assert.Equal(t, "node-1", votedFor)
+
+	// 快照和日志不一致时丢弃全部日志
+	assert.Nil(t, l.compact(7, 3))
+	assert.Equal(t, uint64(7), l.lastIndex())
+}
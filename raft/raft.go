@@ -0,0 +1,765 @@
+package raft
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+)
+
+var (
+	ErrNotLeader          = errors.New("raft node is not the leader")
+	ErrLeadershipLost     = errors.New("raft leadership lost before the command was committed")
+	ErrTimeout            = errors.New("raft command timed out")
+	ErrNodeClosed         = errors.New("raft node is closed")
+	ErrConfigInvalid      = errors.New("raft config is not valid")
+	ErrKeyReserved        = errors.New("keys starting with !raft! are reserved by raft")
+	ErrSnapshotOutOfOrder = errors.New("raft snapshot chunk is out of order")
+)
+
+type State = byte
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+const (
+	logDirName   = "log"
+	stateDirName = "state"
+	maxAppendNum = 512 // 一次AppendEntries最多携带的日志数量
+)
+
+// Config raft节点配置
+type Config struct {
+	ID                string        // 节点ID
+	Peers             []string      // 集群中所有节点的ID，包括自己
+	DirPath           string        // 数据目录，日志和状态机分别存放在log和state子目录中
+	Transport         Transport     // 节点之间的通信
+	HeartbeatInterval time.Duration // leader发送心跳的间隔
+	ElectionTimeout   time.Duration // 选举超时，实际超时在[ElectionTimeout, 2*ElectionTimeout)之间随机
+	CommandTimeout    time.Duration // 等待命令提交的超时时间
+	SnapshotThreshold uint64        // 快照之后累计应用了多少条日志时生成新的快照
+	SnapshotChunkSize int           // 发送快照时每一块包含的数据条数
+	SyncWrites        bool          // 日志和状态机每次写入是否持久化
+}
+
+var DefaultConfig = Config{
+	HeartbeatInterval: 50 * time.Millisecond,
+	ElectionTimeout:   300 * time.Millisecond,
+	CommandTimeout:    3 * time.Second,
+	SnapshotThreshold: 10000,
+	SnapshotChunkSize: 1024,
+	SyncWrites:        true,
+}
+
+type result struct {
+	value []byte
+	err   error
+}
+
+// 等待日志被应用的客户端请求
+type waiter struct {
+	term uint64
+	ch   chan result
+}
+
+// Node raft节点，使用DB作为状态机，提供线性一致的Put/Get/Delete
+type Node struct {
+	config    Config
+	peers     []string // 除自己之外的节点
+	transport Transport
+	mu        *sync.Mutex
+
+	state       State
+	currentTerm uint64
+	votedFor    string
+	leader      string
+	log         *raftLog
+	fsm         *stateMachine
+	commitIndex uint64
+	lastApplied uint64
+
+	nextIndex  map[string]uint64
+	matchIndex map[string]uint64
+	inflight   map[string]bool // 正在向该节点复制日志
+
+	electionDeadline time.Time
+	lastHeartbeat    time.Time
+	waiters          map[uint64]*waiter
+
+	applyCh chan struct{}
+	done    chan struct{}
+	closed  bool
+	wg      *sync.WaitGroup
+}
+
+// NewNode 打开或者创建一个raft节点，重启后从持久化的日志和状态机恢复
+func NewNode(config Config) (*Node, error) {
+	if config.ID == "" || config.Transport == nil || config.HeartbeatInterval <= 0 ||
+		config.ElectionTimeout <= config.HeartbeatInterval || config.CommandTimeout <= 0 ||
+		config.SnapshotChunkSize <= 0 {
+		return nil, ErrConfigInvalid
+	}
+	var peers []string
+	var member bool
+	for _, peer := range config.Peers {
+		if peer == config.ID {
+			member = true
+		} else {
+			peers = append(peers, peer)
+		}
+	}
+	if !member {
+		return nil, ErrConfigInvalid
+	}
+
+	log, err := openRaftLog(filepath.Join(config.DirPath, logDirName), config.SyncWrites)
+	if err != nil {
+		return nil, err
+	}
+	fsm, err := openStateMachine(filepath.Join(config.DirPath, stateDirName), config.SyncWrites)
+	if err != nil {
+		_ = log.close()
+		return nil, err
+	}
+	n := &Node{
+		config:    config,
+		peers:     peers,
+		transport: config.Transport,
+		mu:        new(sync.Mutex),
+		log:       log,
+		fsm:       fsm,
+		waiters:   make(map[uint64]*waiter),
+		applyCh:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		wg:        new(sync.WaitGroup),
+	}
+	if err := n.recover(); err != nil {
+		_ = log.close()
+		_ = fsm.close()
+		return nil, err
+	}
+
+	n.resetElectionDeadline()
+	n.transport.SetHandler(n)
+	n.wg.Add(2)
+	go n.tickLoop()
+	go n.applyLoop()
+	return n, nil
+}
+
+// 从持久化的数据恢复任期、投票和应用进度
+func (n *Node) recover() error {
+	var err error
+	if n.currentTerm, n.votedFor, err = n.log.loadState(); err != nil {
+		return err
+	}
+	applied, err := n.fsm.appliedIndex()
+	if err != nil {
+		return err
+	}
+	// 状态机中只记录了写操作的下标，快照点之前的读操作和空日志不需要重新应用
+	if applied < n.log.snapshotIndex {
+		applied = n.log.snapshotIndex
+	}
+	n.lastApplied, n.commitIndex = applied, applied
+	return nil
+}
+
+// ID 节点ID
+func (n *Node) ID() string {
+	return n.config.ID
+}
+
+// State 返回节点当前的角色和任期
+func (n *Node) State() (State, uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.state, n.currentTerm
+}
+
+// IsLeader 是否是leader
+func (n *Node) IsLeader() bool {
+	state, _ := n.State()
+	return state == Leader
+}
+
+// Leader 返回当前已知的leader，未知时返回空
+func (n *Node) Leader() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.leader
+}
+
+// Put 写入数据，提交并应用到状态机之后返回
+func (n *Node) Put(key []byte, value []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := n.propose(&LogEntry{Type: CommandPut, Key: key, Value: value})
+	return err
+}
+
+// Get 读取数据，读请求同样写入日志，保证读到所有已经提交的写入
+func (n *Node) Get(key []byte) ([]byte, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return n.propose(&LogEntry{Type: CommandGet, Key: key})
+}
+
+// Delete 删除数据
+func (n *Node) Delete(key []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := n.propose(&LogEntry{Type: CommandDelete, Key: key})
+	return err
+}
+
+// checkKey 用户命令的key不能为空，也不能使用状态机中raft保留的前缀
+func checkKey(key []byte) error {
+	if len(key) == 0 {
+		return tiny_kvDB.ErrKeyIsEmpty
+	}
+	if isReservedKey(key) {
+		return ErrKeyReserved
+	}
+	return nil
+}
+
+// Close 停止节点，关闭日志和状态机
+func (n *Node) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.done)
+	n.mu.Unlock()
+	n.wg.Wait()
+
+	// 还在等待的请求不会再被应用
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for index, w := range n.waiters {
+		w.ch <- result{err: ErrNodeClosed}
+		delete(n.waiters, index)
+	}
+	if err := n.log.close(); err != nil {
+		_ = n.fsm.close()
+		return err
+	}
+	return n.fsm.close()
+}
+
+// 写入一条日志，等待它被应用
+func (n *Node) propose(entry *LogEntry) ([]byte, error) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil, ErrNodeClosed
+	}
+	if n.state != Leader {
+		n.mu.Unlock()
+		return nil, ErrNotLeader
+	}
+	entry.Term = n.currentTerm
+	if err := n.log.append(entry); err != nil {
+		n.mu.Unlock()
+		return nil, err
+	}
+	w := &waiter{term: entry.Term, ch: make(chan result, 1)}
+	n.waiters[entry.Index] = w
+	n.advanceCommitIndex()
+	n.broadcastAppendEntries()
+	n.mu.Unlock()
+
+	timer := time.NewTimer(n.config.CommandTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-w.ch:
+		return r.value, r.err
+	case <-timer.C:
+		n.mu.Lock()
+		if n.waiters[entry.Index] == w {
+			delete(n.waiters, entry.Index)
+		}
+		n.mu.Unlock()
+		return nil, ErrTimeout
+	}
+}
+
+func (n *Node) tickLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.config.HeartbeatInterval / 5)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.Lock()
+		now := time.Now()
+		if n.state == Leader {
+			if now.Sub(n.lastHeartbeat) >= n.config.HeartbeatInterval {
+				n.broadcastAppendEntries()
+			}
+		} else if now.After(n.electionDeadline) {
+			n.startElection()
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *Node) resetElectionDeadline() {
+	timeout := n.config.ElectionTimeout + time.Duration(rand.Int63n(int64(n.config.ElectionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// 发现了更大的任期，转为follower，调用方需要持有n.mu
+func (n *Node) becomeFollower(term uint64) error {
+	n.state = Follower
+	if term > n.currentTerm {
+		n.currentTerm, n.votedFor, n.leader = term, "", ""
+		return n.log.saveState(n.currentTerm, n.votedFor)
+	}
+	return nil
+}
+
+// 发起选举，调用方需要持有n.mu
+func (n *Node) startElection() {
+	n.state = Candidate
+	n.currentTerm++
+	n.votedFor = n.config.ID
+	n.leader = ""
+	n.resetElectionDeadline()
+	if err := n.log.saveState(n.currentTerm, n.votedFor); err != nil {
+		n.state = Follower
+		return
+	}
+	if len(n.peers) == 0 {
+		n.becomeLeader()
+		return
+	}
+
+	term := n.currentTerm
+	args := &RequestVoteArgs{
+		Term:         term,
+		CandidateID:  n.config.ID,
+		LastLogIndex: n.log.lastIndex(),
+		LastLogTerm:  n.log.lastTerm(),
+	}
+	votes := 1
+	for _, peer := range n.peers {
+		n.wg.Add(1)
+		go func(peer string) {
+			defer n.wg.Done()
+			reply, err := n.transport.RequestVote(peer, args)
+			if err != nil {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if reply.Term > n.currentTerm {
+				_ = n.becomeFollower(reply.Term)
+				return
+			}
+			if n.state != Candidate || n.currentTerm != term || !reply.VoteGranted {
+				return
+			}
+			votes++
+			if votes > (len(n.peers)+1)/2 {
+				n.becomeLeader()
+			}
+		}(peer)
+	}
+}
+
+// 成为leader，调用方需要持有n.mu
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leader = n.config.ID
+	n.nextIndex = make(map[string]uint64)
+	n.matchIndex = make(map[string]uint64)
+	n.inflight = make(map[string]bool)
+	for _, peer := range n.peers {
+		n.nextIndex[peer] = n.log.lastIndex() + 1
+	}
+	// 只有当前任期的日志才能通过计数提交，写入一条空日志尽快提交之前任期的日志
+	if err := n.log.append(&LogEntry{Term: n.currentTerm, Type: CommandNoop}); err != nil {
+		n.state = Follower
+		n.leader = ""
+		return
+	}
+	n.advanceCommitIndex()
+	n.broadcastAppendEntries()
+}
+
+// 向所有节点复制日志，调用方需要持有n.mu
+func (n *Node) broadcastAppendEntries() {
+	if n.closed {
+		return
+	}
+	n.lastHeartbeat = time.Now()
+	for _, peer := range n.peers {
+		if n.inflight[peer] {
+			continue
+		}
+		n.inflight[peer] = true
+		n.wg.Add(1)
+		go n.replicateTo(peer, n.currentTerm)
+	}
+}
+
+// 向peer复制日志，直到peer追上leader或者出错
+func (n *Node) replicateTo(peer string, term uint64) {
+	defer n.wg.Done()
+	n.mu.Lock()
+	defer func() {
+		n.inflight[peer] = false
+		n.mu.Unlock()
+	}()
+
+	for !n.closed && n.state == Leader && n.currentTerm == term {
+		next := n.nextIndex[peer]
+		if next <= n.log.snapshotIndex {
+			// peer需要的日志已经被快照删除了，发送快照
+			if !n.sendSnapshot(peer, term) {
+				return
+			}
+		} else {
+			prevIndex := next - 1
+			prevTerm, _ := n.log.term(prevIndex)
+			args := &AppendEntriesArgs{
+				Term:         term,
+				LeaderID:     n.config.ID,
+				PrevLogIndex: prevIndex,
+				PrevLogTerm:  prevTerm,
+				Entries:      n.log.slice(next, next+maxAppendNum),
+				LeaderCommit: n.commitIndex,
+			}
+			n.mu.Unlock()
+			reply, err := n.transport.AppendEntries(peer, args)
+			n.mu.Lock()
+			if err != nil {
+				return
+			}
+			if reply.Term > n.currentTerm {
+				_ = n.becomeFollower(reply.Term)
+				return
+			}
+			if n.state != Leader || n.currentTerm != term {
+				return
+			}
+			if reply.Success {
+				match := prevIndex + uint64(len(args.Entries))
+				if match > n.matchIndex[peer] {
+					n.matchIndex[peer] = match
+				}
+				n.nextIndex[peer] = n.matchIndex[peer] + 1
+				n.advanceCommitIndex()
+			} else {
+				n.nextIndex[peer] = reply.ConflictIndex
+				if n.nextIndex[peer] < 1 {
+					n.nextIndex[peer] = 1
+				}
+				continue
+			}
+		}
+		if n.nextIndex[peer] > n.log.lastIndex() {
+			return
+		}
+	}
+}
+
+// 发送快照，调用方需要持有n.mu，返回false表示需要停止复制
+// 持有锁时只固定状态机当前的数据，读取和发送每一块数据时都不持有锁，不会阻塞日志的应用
+func (n *Node) sendSnapshot(peer string, term uint64) bool {
+	iter, err := n.fsm.snapshotIterator()
+	if err != nil {
+		return false
+	}
+	defer iter.Close()
+	// 状态机中的数据对应lastApplied处的状态，lastApplied不会早于快照点，它的任期一定可以找到
+	lastIncludedIndex := n.lastApplied
+	lastIncludedTerm, _ := n.log.term(lastIncludedIndex)
+	var offset uint64
+	for {
+		n.mu.Unlock()
+		data, err := readSnapshotChunk(iter, n.config.SnapshotChunkSize)
+		var reply *InstallSnapshotReply
+		if err == nil {
+			reply, err = n.transport.InstallSnapshot(peer, &InstallSnapshotArgs{
+				Term:              term,
+				LeaderID:          n.config.ID,
+				LastIncludedIndex: lastIncludedIndex,
+				LastIncludedTerm:  lastIncludedTerm,
+				Offset:            offset,
+				Data:              data,
+				Done:              !iter.Valid(),
+			})
+		}
+		n.mu.Lock()
+		if err != nil {
+			return false
+		}
+		if reply.Term > n.currentTerm {
+			_ = n.becomeFollower(reply.Term)
+			return false
+		}
+		if n.closed || n.state != Leader || n.currentTerm != term {
+			return false
+		}
+		if !iter.Valid() {
+			break
+		}
+		offset += uint64(len(data))
+	}
+	if lastIncludedIndex > n.matchIndex[peer] {
+		n.matchIndex[peer] = lastIncludedIndex
+	}
+	n.nextIndex[peer] = n.matchIndex[peer] + 1
+	n.advanceCommitIndex()
+	return true
+}
+
+// 多数节点都已经复制的当前任期的日志可以提交，调用方需要持有n.mu
+func (n *Node) advanceCommitIndex() {
+	for index := n.log.lastIndex(); index > n.commitIndex; index-- {
+		if term, _ := n.log.term(index); term != n.currentTerm {
+			break
+		}
+		count := 1
+		for _, peer := range n.peers {
+			if n.matchIndex[peer] >= index {
+				count++
+			}
+		}
+		if count > (len(n.peers)+1)/2 {
+			n.commitIndex = index
+			n.notifyApply()
+			break
+		}
+	}
+}
+
+func (n *Node) notifyApply() {
+	select {
+	case n.applyCh <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) applyLoop() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-n.applyCh:
+		}
+		n.mu.Lock()
+		n.applyCommitted()
+		n.mu.Unlock()
+	}
+}
+
+// 将已提交的日志应用到状态机，调用方需要持有n.mu
+func (n *Node) applyCommitted() {
+	for n.lastApplied < n.commitIndex {
+		entry, err := n.log.entry(n.lastApplied + 1)
+		if err != nil {
+			return
+		}
+		value, err := n.fsm.apply(entry)
+		if err != nil && err != tiny_kvDB.ErrKeyNotFound && err != ErrKeyReserved {
+			// 状态机写入失败，稍后重试
+			return
+		}
+		n.lastApplied = entry.Index
+
+		if w := n.waiters[entry.Index]; w != nil {
+			delete(n.waiters, entry.Index)
+			if w.term != entry.Term {
+				// 该位置的日志被新leader的日志覆盖了
+				w.ch <- result{err: ErrLeadershipLost}
+			} else {
+				w.ch <- result{value: value, err: err}
+			}
+		}
+	}
+	n.maybeSnapshot()
+}
+
+// 应用的日志足够多时生成快照，删除已经应用的日志，调用方需要持有n.mu
+func (n *Node) maybeSnapshot() {
+	if n.config.SnapshotThreshold == 0 || n.lastApplied-n.log.snapshotIndex < n.config.SnapshotThreshold {
+		return
+	}
+	// 状态机就是快照，删除日志之前需要先持久化
+	if err := n.fsm.db.Sync(); err != nil {
+		return
+	}
+	term, _ := n.log.term(n.lastApplied)
+	_ = n.log.compact(n.lastApplied, term)
+}
+
+// HandleRequestVote 处理投票请求
+func (n *Node) HandleRequestVote(args *RequestVoteArgs) (*RequestVoteReply, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrNodeClosed
+	}
+	if args.Term > n.currentTerm {
+		if err := n.becomeFollower(args.Term); err != nil {
+			return nil, err
+		}
+	}
+	reply := &RequestVoteReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm || (n.votedFor != "" && n.votedFor != args.CandidateID) {
+		return reply, nil
+	}
+	// 候选人的日志至少和自己一样新才能投票
+	lastTerm, lastIndex := n.log.lastTerm(), n.log.lastIndex()
+	if args.LastLogTerm < lastTerm || (args.LastLogTerm == lastTerm && args.LastLogIndex < lastIndex) {
+		return reply, nil
+	}
+	n.votedFor = args.CandidateID
+	if err := n.log.saveState(n.currentTerm, n.votedFor); err != nil {
+		return nil, err
+	}
+	n.resetElectionDeadline()
+	reply.VoteGranted = true
+	return reply, nil
+}
+
+// HandleAppendEntries 处理日志复制和心跳
+func (n *Node) HandleAppendEntries(args *AppendEntriesArgs) (*AppendEntriesReply, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrNodeClosed
+	}
+	reply := &AppendEntriesReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply, nil
+	}
+	if err := n.becomeFollower(args.Term); err != nil {
+		return nil, err
+	}
+	reply.Term = n.currentTerm
+	n.leader = args.LeaderID
+	n.resetElectionDeadline()
+
+	// 快照已经覆盖的日志一定是一致的，跳过这部分日志
+	prevIndex, prevTerm, entries := args.PrevLogIndex, args.PrevLogTerm, args.Entries
+	if prevIndex < n.log.snapshotIndex {
+		skip := n.log.snapshotIndex - prevIndex
+		if skip > uint64(len(entries)) {
+			skip = uint64(len(entries))
+		}
+		prevIndex += skip
+		entries = entries[skip:]
+		if prevIndex < n.log.snapshotIndex {
+			reply.Success = true
+			return reply, nil
+		}
+		prevTerm = n.log.snapshotTerm
+	}
+
+	if prevIndex > n.log.lastIndex() {
+		reply.ConflictIndex = n.log.lastIndex() + 1
+		return reply, nil
+	}
+	if term, _ := n.log.term(prevIndex); term != prevTerm {
+		// 跳过冲突任期的全部日志
+		conflict := prevIndex
+		for conflict > n.log.snapshotIndex+1 {
+			if t, _ := n.log.term(conflict - 1); t != term {
+				break
+			}
+			conflict--
+		}
+		reply.ConflictIndex = conflict
+		return reply, nil
+	}
+
+	for i, entry := range entries {
+		index := prevIndex + 1 + uint64(i)
+		if term, ok := n.log.term(index); ok && term == entry.Term {
+			continue
+		}
+		if err := n.log.truncateAndAppend(index, copyEntries(entries[i:])); err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	if lastNew := prevIndex + uint64(len(entries)); args.LeaderCommit > n.commitIndex {
+		n.commitIndex = args.LeaderCommit
+		if n.commitIndex > lastNew {
+			n.commitIndex = lastNew
+		}
+		n.notifyApply()
+	}
+	reply.Success = true
+	return reply, nil
+}
+
+// HandleInstallSnapshot 处理快照，用快照替换状态机中的全部数据
+func (n *Node) HandleInstallSnapshot(args *InstallSnapshotArgs) (*InstallSnapshotReply, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrNodeClosed
+	}
+	reply := &InstallSnapshotReply{Term: n.currentTerm}
+	if args.Term < n.currentTerm {
+		return reply, nil
+	}
+	if err := n.becomeFollower(args.Term); err != nil {
+		return nil, err
+	}
+	reply.Term = n.currentTerm
+	n.leader = args.LeaderID
+	n.resetElectionDeadline()
+
+	// 已经应用过的快照不需要再安装
+	if args.LastIncludedIndex <= n.lastApplied {
+		return reply, nil
+	}
+	installed, err := n.fsm.restoreChunk(args.LastIncludedIndex, args.Offset, args.Data, args.Done)
+	if err != nil {
+		return nil, err
+	}
+	if !installed {
+		return reply, nil
+	}
+	if err := n.log.compact(args.LastIncludedIndex, args.LastIncludedTerm); err != nil {
+		return nil, err
+	}
+	n.lastApplied = args.LastIncludedIndex
+	if n.commitIndex < n.lastApplied {
+		n.commitIndex = n.lastApplied
+	}
+	return reply, nil
+}
+
+// 日志来自其他节点，拷贝一份避免共享
+func copyEntries(entries []*LogEntry) []*LogEntry {
+	copied := make([]*LogEntry, len(entries))
+	for i, entry := range entries {
+		e := *entry
+		copied[i] = &e
+	}
+	return copied
+}
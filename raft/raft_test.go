@@ -0,0 +1,240 @@
+package raft
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+	"tiny-kvDB/utils"
+)
+
+type testCluster struct {
+	t       *testing.T
+	network *InmemNetwork
+	configs map[string]Config
+	nodes   map[string]*Node
+}
+
+func newTestCluster(t *testing.T, size int, snapshotThreshold uint64) *testCluster {
+	c := &testCluster{
+		t:       t,
+		network: NewInmemNetwork(),
+		configs: make(map[string]Config),
+		nodes:   make(map[string]*Node),
+	}
+	var peers []string
+	for i := 0; i < size; i++ {
+		peers = append(peers, fmt.Sprintf("node-%d", i))
+	}
+	for _, id := range peers {
+		dir, _ := os.MkdirTemp("", "bitcask-go-raft")
+		config := DefaultConfig
+		config.ID = id
+		config.Peers = peers
+		config.DirPath = dir
+		config.Transport = c.network.Transport(id)
+		config.HeartbeatInterval = 20 * time.Millisecond
+		config.ElectionTimeout = 100 * time.Millisecond
+		config.SnapshotThreshold = snapshotThreshold
+		// 快照分成多块发送
+		config.SnapshotChunkSize = 16
+		config.SyncWrites = false
+		c.configs[id] = config
+		c.start(id)
+	}
+	return c
+}
+
+func (c *testCluster) start(id string) {
+	node, err := NewNode(c.configs[id])
+	assert.Nil(c.t, err)
+	c.nodes[id] = node
+}
+
+func (c *testCluster) stop(id string) {
+	assert.Nil(c.t, c.nodes[id].Close())
+}
+
+func (c *testCluster) destroy() {
+	for id, node := range c.nodes {
+		_ = node.Close()
+		_ = os.RemoveAll(c.configs[id].DirPath)
+	}
+}
+
+// 等待选出leader，excluded中的节点不参与
+func (c *testCluster) waitLeader(excluded ...string) *Node {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for id, node := range c.nodes {
+			skip := false
+			for _, e := range excluded {
+				skip = skip || e == id
+			}
+			if !skip && node.IsLeader() {
+				return node
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+	return nil
+}
+
+// 等待所有节点都应用到index
+func (c *testCluster) waitApplied(index uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for _, node := range c.nodes {
+		for {
+			node.mu.Lock()
+			applied := node.lastApplied
+			node.mu.Unlock()
+			if applied >= index {
+				break
+			}
+			if time.Now().After(deadline) {
+				c.t.Fatalf("%s applied %d, want %d", node.ID(), applied, index)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func (c *testCluster) lastApplied(node *Node) uint64 {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.lastApplied
+}
+
+func TestNode_PutGetDelete(t *testing.T) {
+	c := newTestCluster(t, 3, 0)
+	defer c.destroy()
+	leader := c.waitLeader()
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, leader.Put(utils.GetTestKey(i), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	for i := 0; i < 100; i++ {
+		value, err := leader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%d", i)), value)
+	}
+	assert.Nil(t, leader.Delete(utils.GetTestKey(10)))
+	_, err := leader.Get(utils.GetTestKey(10))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+
+	// raft保留的前缀不能使用
+	assert.Equal(t, ErrKeyReserved, leader.Put(appliedIndexKey, encodeUint64(1)))
+	_, err = leader.Get(appliedIndexKey)
+	assert.Equal(t, ErrKeyReserved, err)
+
+	// follower不处理请求
+	for _, node := range c.nodes {
+		if node != leader {
+			assert.Equal(t, ErrNotLeader, node.Put([]byte("key"), []byte("value")))
+			_, err := node.Get(utils.GetTestKey(1))
+			assert.Equal(t, ErrNotLeader, err)
+			assert.Equal(t, leader.ID(), node.Leader())
+		}
+	}
+
+	// 所有节点的状态机一致
+	c.waitApplied(c.lastApplied(leader))
+	for _, node := range c.nodes {
+		value, err := node.fsm.db.Get(utils.GetTestKey(20))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("value-20"), value)
+		_, err = node.fsm.db.Get(utils.GetTestKey(10))
+		assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+	}
+}
+
+func TestNode_LeaderFailover(t *testing.T) {
+	c := newTestCluster(t, 3, 0)
+	defer c.destroy()
+	leader := c.waitLeader()
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, leader.Put(utils.GetTestKey(i), []byte("v1")))
+	}
+
+	// 旧leader被隔离后，剩下的多数节点选出新leader，已提交的数据不会丢失
+	c.network.Disconnect(leader.ID())
+	newLeader := c.waitLeader(leader.ID())
+	for i := 0; i < 50; i++ {
+		value, err := newLeader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), value)
+	}
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, newLeader.Put(utils.GetTestKey(i), []byte("v2")))
+	}
+
+	// 被隔离的旧leader无法提交
+	assert.NotNil(t, leader.Put([]byte("lost"), []byte("value")))
+
+	// 恢复连接后旧leader追上新leader，未提交的日志被覆盖
+	c.network.Reconnect(leader.ID())
+	assert.Nil(t, newLeader.Put([]byte("after"), []byte("value")))
+	c.waitApplied(c.lastApplied(newLeader))
+	for _, node := range c.nodes {
+		value, err := node.fsm.db.Get(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v2"), value)
+		_, err = node.fsm.db.Get([]byte("lost"))
+		assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+	}
+}
+
+func TestNode_Snapshot(t *testing.T) {
+	c := newTestCluster(t, 3, 50)
+	defer c.destroy()
+	leader := c.waitLeader()
+
+	// 落后的follower需要的日志已经被快照删除，通过快照追赶
+	var lagging *Node
+	for _, node := range c.nodes {
+		if node != leader {
+			lagging = node
+			break
+		}
+	}
+	c.network.Disconnect(lagging.ID())
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, leader.Put(utils.GetTestKey(i), utils.RandomValue(16)))
+	}
+	assert.Nil(t, leader.Delete(utils.GetTestKey(0)))
+	leader.mu.Lock()
+	assert.True(t, leader.log.snapshotIndex > 0)
+	leader.mu.Unlock()
+
+	c.network.Reconnect(lagging.ID())
+	assert.Nil(t, leader.Put([]byte("after"), []byte("value")))
+	c.waitApplied(c.lastApplied(leader))
+	for i := 1; i < 300; i++ {
+		want, err := leader.fsm.db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		got, err := lagging.fsm.db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := lagging.fsm.db.Get(utils.GetTestKey(0))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+
+	// 重启整个集群后从快照和日志恢复
+	for id := range c.nodes {
+		c.stop(id)
+	}
+	for id := range c.configs {
+		c.start(id)
+	}
+	leader = c.waitLeader()
+	value, err := leader.Get([]byte("after"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	for i := 1; i < 300; i++ {
+		_, err := leader.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+}
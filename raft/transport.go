@@ -0,0 +1,154 @@
+package raft
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrPeerUnreachable = errors.New("raft peer is unreachable")
+
+// RequestVoteArgs 请求投票
+type RequestVoteArgs struct {
+	Term         uint64
+	CandidateID  string
+	LastLogIndex uint64
+	LastLogTerm  uint64
+}
+
+type RequestVoteReply struct {
+	Term        uint64
+	VoteGranted bool
+}
+
+// AppendEntriesArgs 复制日志，没有日志时作为心跳
+type AppendEntriesArgs struct {
+	Term         uint64
+	LeaderID     string
+	PrevLogIndex uint64
+	PrevLogTerm  uint64
+	Entries      []*LogEntry
+	LeaderCommit uint64
+}
+
+type AppendEntriesReply struct {
+	Term    uint64
+	Success bool
+	// 日志不匹配时，leader下一次从ConflictIndex开始发送
+	ConflictIndex uint64
+}
+
+// KeyValue 快照中的一条数据
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// InstallSnapshotArgs 发送快照，快照是状态机在LastIncludedIndex处的全部数据，分成多块按顺序发送
+type InstallSnapshotArgs struct {
+	Term              uint64
+	LeaderID          string
+	LastIncludedIndex uint64
+	LastIncludedTerm  uint64
+	Offset            uint64 // 这一块之前已经发送的数据条数，为0表示一个新的快照
+	Data              []*KeyValue
+	Done              bool // 是否是最后一块
+}
+
+type InstallSnapshotReply struct {
+	Term uint64
+}
+
+// RPCHandler 处理其他节点发来的RPC，由Node实现
+type RPCHandler interface {
+	HandleRequestVote(args *RequestVoteArgs) (*RequestVoteReply, error)
+	HandleAppendEntries(args *AppendEntriesArgs) (*AppendEntriesReply, error)
+	HandleInstallSnapshot(args *InstallSnapshotArgs) (*InstallSnapshotReply, error)
+}
+
+// Transport 节点之间的通信
+type Transport interface {
+	// SetHandler 设置处理本节点收到的RPC的handler
+	SetHandler(handler RPCHandler)
+	RequestVote(target string, args *RequestVoteArgs) (*RequestVoteReply, error)
+	AppendEntries(target string, args *AppendEntriesArgs) (*AppendEntriesReply, error)
+	InstallSnapshot(target string, args *InstallSnapshotArgs) (*InstallSnapshotReply, error)
+}
+
+// InmemNetwork 进程内的网络，用于测试，可以断开和恢复节点的连接
+type InmemNetwork struct {
+	mu           *sync.RWMutex
+	handlers     map[string]RPCHandler
+	disconnected map[string]bool
+}
+
+func NewInmemNetwork() *InmemNetwork {
+	return &InmemNetwork{
+		mu:           new(sync.RWMutex),
+		handlers:     make(map[string]RPCHandler),
+		disconnected: make(map[string]bool),
+	}
+}
+
+// Transport 返回节点id在该网络中使用的Transport
+func (nw *InmemNetwork) Transport(id string) Transport {
+	return &inmemTransport{network: nw, id: id}
+}
+
+// Disconnect 断开节点和其他所有节点的连接
+func (nw *InmemNetwork) Disconnect(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	nw.disconnected[id] = true
+}
+
+// Reconnect 恢复节点的连接
+func (nw *InmemNetwork) Reconnect(id string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	delete(nw.disconnected, id)
+}
+
+func (nw *InmemNetwork) handler(from, to string) (RPCHandler, error) {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+	handler := nw.handlers[to]
+	if handler == nil || nw.disconnected[from] || nw.disconnected[to] {
+		return nil, ErrPeerUnreachable
+	}
+	return handler, nil
+}
+
+type inmemTransport struct {
+	network *InmemNetwork
+	id      string
+}
+
+func (t *inmemTransport) SetHandler(handler RPCHandler) {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	t.network.handlers[t.id] = handler
+}
+
+func (t *inmemTransport) RequestVote(target string, args *RequestVoteArgs) (*RequestVoteReply, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleRequestVote(args)
+}
+
+func (t *inmemTransport) AppendEntries(target string, args *AppendEntriesArgs) (*AppendEntriesReply, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleAppendEntries(args)
+}
+
+func (t *inmemTransport) InstallSnapshot(target string, args *InstallSnapshotArgs) (*InstallSnapshotReply, error) {
+	handler, err := t.network.handler(t.id, target)
+	if err != nil {
+		return nil, err
+	}
+	return handler.HandleInstallSnapshot(args)
+}
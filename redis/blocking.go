@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+)
+
+// ErrWaitCanceled 阻塞的调用在取到元素之前被取消，例如客户端断开了连接
+var ErrWaitCanceled = errors.New("blocking wait canceled")
+
+// listWaiter 一个阻塞在若干个列表上等待元素的调用
+type listWaiter struct {
+	keys   [][]byte
+	wakeup chan struct{} // 容量为1，有元素被push到keys中的某个列表时收到通知
+}
+
+// listWaiters 每个列表上按照到达顺序排队的等待者
+// push时只唤醒队列中第一个还没有被唤醒的等待者，它取到元素离开队列时再唤醒下一个，所以先等待的先取到元素
+// 被唤醒但没有取到元素的等待者保留原来的位置
+type listWaiters struct {
+	mu     sync.Mutex
+	queues map[string][]*listWaiter
+}
+
+func newListWaiters() *listWaiters {
+	return &listWaiters{queues: make(map[string][]*listWaiter)}
+}
+
+func (lw *listWaiters) register(w *listWaiter) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for _, key := range w.keys {
+		lw.queues[string(key)] = append(lw.queues[string(key)], w)
+	}
+}
+
+func (lw *listWaiters) unregister(w *listWaiter) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for _, key := range w.keys {
+		queue := lw.queues[string(key)]
+		for i, other := range queue {
+			if other == w {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(lw.queues, string(key))
+		} else {
+			lw.queues[string(key)] = queue
+		}
+	}
+}
+
+// notify 唤醒key上第一个还没有被唤醒的等待者
+func (lw *listWaiters) notify(key []byte) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for _, w := range lw.queues[string(key)] {
+		select {
+		case w.wakeup <- struct{}{}:
+			return
+		default:
+		}
+	}
+}
+
+// BLPop 依次检查keys，从第一个非空列表的头部取出元素，返回列表的key和元素
+// 所有列表都为空时阻塞，直到有元素被push或者超时，timeout为0表示一直等待，超时返回nil, nil, nil
+// cancel被关闭时返回ErrWaitCanceled，不会再取出元素，为nil表示不会被取消
+func (rds *RedisDataStructure) BLPop(keys [][]byte, timeout time.Duration, cancel <-chan struct{}) ([]byte, []byte, error) {
+	return rds.blockingPop(keys, timeout, cancel, func(key []byte) ([]byte, error) {
+		return rds.popInner(key, true)
+	})
+}
+
+// BRPop 和BLPop相同，但是从列表的尾部取出元素
+func (rds *RedisDataStructure) BRPop(keys [][]byte, timeout time.Duration, cancel <-chan struct{}) ([]byte, []byte, error) {
+	return rds.blockingPop(keys, timeout, cancel, func(key []byte) ([]byte, error) {
+		return rds.popInner(key, false)
+	})
+}
+
+// BLMove 和LMove相同，但是source为空时阻塞，超时返回nil, nil
+func (rds *RedisDataStructure) BLMove(source, destination []byte, fromLeft, toLeft bool,
+	timeout time.Duration, cancel <-chan struct{}) ([]byte, error) {
+	_, element, err := rds.blockingPop([][]byte{source}, timeout, cancel, func(key []byte) ([]byte, error) {
+		return rds.LMove(source, destination, fromLeft, toLeft)
+	})
+	return element, err
+}
+
+// blockingPop 先登记等待再尝试pop，保证登记之前push的元素一定能被看到
+func (rds *RedisDataStructure) blockingPop(keys [][]byte, timeout time.Duration, cancel <-chan struct{},
+	pop func(key []byte) ([]byte, error)) ([]byte, []byte, error) {
+	w := &listWaiter{keys: keys, wakeup: make(chan struct{}, 1)}
+	rds.waiters.register(w)
+	var woken bool
+	defer func() {
+		rds.waiters.unregister(w)
+		select {
+		case <-w.wakeup:
+			woken = true
+		default:
+		}
+		// 离开队列时唤醒后面的等待者，列表中可能还有元素，收到的通知也可能是给另一个key的
+		// 多余的唤醒只会让对方再检查一次
+		if woken {
+			for _, key := range keys {
+				rds.waiters.notify(key)
+			}
+		}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	for {
+		// 每次pop之前检查是否已经取消，取消之后取出的元素没有人接收，会丢失
+		select {
+		case <-cancel:
+			return nil, nil, ErrWaitCanceled
+		default:
+		}
+		for _, key := range keys {
+			element, err := pop(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			if element != nil {
+				return key, element, nil
+			}
+		}
+		select {
+		case <-w.wakeup:
+			woken = true
+		case <-expired:
+			return nil, nil, nil
+		case <-rds.closed:
+			return nil, nil, tiny_kvDB.ErrDatabaseIsClosed
+		case <-cancel:
+			return nil, nil, ErrWaitCanceled
+		}
+	}
+}
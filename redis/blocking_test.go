@@ -0,0 +1,245 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+)
+
+func openTestRedis(t *testing.T) (*RedisDataStructure, func()) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-blocking")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	return rds, func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestBLPop(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 已经有元素时直接返回，按keys的顺序检查
+	_, err := rds.RPush([]byte("q2"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	key, element, err := rds.BLPop([][]byte{[]byte("q1"), []byte("q2")}, time.Second, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("q2"), key)
+	assert.Equal(t, []byte("a"), element)
+	key, element, err = rds.BRPop([][]byte{[]byte("q1"), []byte("q2")}, time.Second, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("q2"), key)
+	assert.Equal(t, []byte("b"), element)
+
+	// 超时
+	start := time.Now()
+	key, element, err = rds.BLPop([][]byte{[]byte("q1")}, 100*time.Millisecond, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, key)
+	assert.Nil(t, element)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	// 阻塞直到push
+	done := make(chan []byte)
+	go func() {
+		_, element, err := rds.BLPop([][]byte{[]byte("q1"), []byte("q3")}, 0, nil)
+		assert.Nil(t, err)
+		done <- element
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_, err = rds.LPush([]byte("q3"), []byte("job"))
+	assert.Nil(t, err)
+	select {
+	case element := <-done:
+		assert.Equal(t, []byte("job"), element)
+	case <-time.After(time.Second):
+		t.Fatal("BLPop was not woken by LPush")
+	}
+
+	// 类型错误
+	assert.Nil(t, rds.Set([]byte("str"), []byte("v"), 0))
+	_, _, err = rds.BLPop([][]byte{[]byte("str")}, time.Second, nil)
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestBLPop_Fair(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 先阻塞的等待者先拿到元素
+	results := make([]chan []byte, 3)
+	for i := range results {
+		results[i] = make(chan []byte, 1)
+		go func(ch chan []byte) {
+			_, element, err := rds.BLPop([][]byte{[]byte("queue")}, 0, nil)
+			assert.Nil(t, err)
+			ch <- element
+		}(results[i])
+		time.Sleep(30 * time.Millisecond)
+	}
+	_, err := rds.RPush([]byte("queue"), []byte("0"), []byte("1"), []byte("2"))
+	assert.Nil(t, err)
+	for i, ch := range results {
+		select {
+		case element := <-ch:
+			assert.Equal(t, []byte(fmt.Sprint(i)), element)
+		case <-time.After(time.Second):
+			t.Fatal("waiter was not woken")
+		}
+	}
+}
+
+func TestBLPop_Concurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 多个消费者同时等待两个队列，每个元素只被取出一次
+	const consumers, jobs = 8, 200
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[string]int)
+	)
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, element, err := rds.BLPop([][]byte{[]byte("a"), []byte("b")}, 300*time.Millisecond, nil)
+				assert.Nil(t, err)
+				if element == nil {
+					return
+				}
+				mu.Lock()
+				seen[string(element)]++
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < jobs; i++ {
+		key := []byte("a")
+		if i%2 == 1 {
+			key = []byte("b")
+		}
+		_, err := rds.RPush(key, []byte(fmt.Sprint(i)))
+		assert.Nil(t, err)
+	}
+	wg.Wait()
+	assert.Equal(t, jobs, len(seen))
+	for element, n := range seen {
+		assert.Equal(t, 1, n, element)
+	}
+}
+
+func TestBLMove(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	_, err := rds.RPush([]byte("src"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	element, err := rds.LMove([]byte("src"), []byte("dst"), true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), element)
+	// 同一个列表，把尾部的元素移到头部
+	element, err = rds.LMove([]byte("src"), []byte("src"), false, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), element)
+	elements, err := rds.LRange([]byte("src"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("c", "b"), elements)
+
+	// 阻塞直到source有元素，移动的元素会唤醒destination上的等待者
+	moved := make(chan []byte, 1)
+	popped := make(chan []byte, 1)
+	go func() {
+		element, err := rds.BLMove([]byte("jobs"), []byte("processing"), false, true, 0, nil)
+		assert.Nil(t, err)
+		moved <- element
+	}()
+	go func() {
+		_, element, err := rds.BLPop([][]byte{[]byte("processing")}, 0, nil)
+		assert.Nil(t, err)
+		popped <- element
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_, err = rds.LPush([]byte("jobs"), []byte("job-1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("job-1"), <-moved)
+	assert.Equal(t, []byte("job-1"), <-popped)
+
+	element, err = rds.BLMove([]byte("jobs"), []byte("processing"), true, true, 50*time.Millisecond, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, element)
+}
+
+func TestBLPop_Close(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := rds.BLPop([][]byte{[]byte("queue")}, 0, nil)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, rds.Close())
+	select {
+	case err := <-done:
+		assert.Equal(t, tiny_kvDB.ErrDatabaseIsClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("BLPop was not woken by Close")
+	}
+}
+
+func TestBLPop_Cancel(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 取消的等待者离开队列，之后push的元素由后面的等待者取到，不会丢失
+	cancel := make(chan struct{})
+	canceled := make(chan error, 1)
+	go func() {
+		_, _, err := rds.BLPop([][]byte{[]byte("queue")}, 0, cancel)
+		canceled <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	received := make(chan []byte, 1)
+	go func() {
+		_, element, err := rds.BLPop([][]byte{[]byte("queue")}, 0, nil)
+		assert.Nil(t, err)
+		received <- element
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(cancel)
+	select {
+	case err := <-canceled:
+		assert.Equal(t, ErrWaitCanceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("BLPop was not woken by cancel")
+	}
+	_, err := rds.LPush([]byte("queue"), []byte("job"))
+	assert.Nil(t, err)
+	select {
+	case element := <-received:
+		assert.Equal(t, []byte("job"), element)
+	case <-time.After(time.Second):
+		t.Fatal("the remaining waiter did not receive the element")
+	}
+
+	// 已经取消时即使列表不为空也不会取出元素
+	_, err = rds.LPush([]byte("queue"), []byte("job"))
+	assert.Nil(t, err)
+	_, _, err = rds.BLPop([][]byte{[]byte("queue")}, 0, cancel)
+	assert.Equal(t, ErrWaitCanceled, err)
+	size, err := rds.LLen([]byte("queue"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), size)
+}
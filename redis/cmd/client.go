@@ -4,22 +4,138 @@ import (
 	"errors"
 	"fmt"
 	"github.com/tidwall/redcon"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 	tiny_kvDB "tiny-kvDB"
 	tiny_kvDB_redis "tiny-kvDB/redis"
-	"tiny-kvDB/utils"
 )
 
 type cmdHandler func(client *BitcaskClient, args [][]byte) (any, error)
 
 var supportedCommand = map[string]cmdHandler{
-	"set":    set,
-	"get":    get,
-	"sadd":   sadd,
-	"hset":   hset,
-	"lpush":  lpush,
-	"zadd":   zadd,
+	// 连接
+	"ping":   ping,
+	"echo":   echo,
+	"select": selectDB,
 	"config": config,
+	// 通用
+	"del":       del,
+	"type":      typ,
+	"exists":    exists,
+	"expire":    expire,
+	"pexpire":   pexpire,
+	"expireat":  expireat,
+	"pexpireat": pexpireat,
+	"ttl":       ttl,
+	"pttl":      pttl,
+	"persist":   persist,
+	"keys":      keys,
+	"scan":      scan,
+	"rename":    rename,
+	"renamenx":  renamenx,
+	// string
+	"set":         set,
+	"get":         get,
+	"setnx":       setnx,
+	"setex":       setex,
+	"psetex":      psetex,
+	"getset":      getset,
+	"getdel":      getdel,
+	"mget":        mget,
+	"mset":        mset,
+	"msetnx":      msetnx,
+	"incr":        incr,
+	"decr":        decr,
+	"incrby":      incrby,
+	"decrby":      decrby,
+	"incrbyfloat": incrbyfloat,
+	"append":      appendCommand,
+	"strlen":      strlen,
+	"getrange":    getrange,
+	"setrange":    setrange,
+	// hash
+	"hset":         hset,
+	"hget":         hget,
+	"hdel":         hdel,
+	"hlen":         hlen,
+	"hexists":      hexists,
+	"hgetall":      hgetall,
+	"hkeys":        hkeys,
+	"hvals":        hvals,
+	"hmset":        hmset,
+	"hmget":        hmget,
+	"hsetnx":       hsetnx,
+	"hincrby":      hincrby,
+	"hincrbyfloat": hincrbyfloat,
+	"hscan":        hscan,
+	// set
+	"sadd":        sadd,
+	"sismember":   sismember,
+	"srem":        srem,
+	"scard":       scard,
+	"smembers":    smembers,
+	"sscan":       sscan,
+	"sinter":      sinter,
+	"sunion":      sunion,
+	"sdiff":       sdiff,
+	"sinterstore": sinterstore,
+	"sunionstore": sunionstore,
+	"sdiffstore":  sdiffstore,
+	"srandmember": srandmember,
+	"spop":        spop,
+	"smove":       smove,
+	// list
+	"lpush":   lpush,
+	"rpush":   rpush,
+	"lpop":    lpop,
+	"rpop":    rpop,
+	"llen":    llen,
+	"lindex":  lindex,
+	"lrange":  lrange,
+	"lset":    lset,
+	"ltrim":   ltrim,
+	"lrem":    lrem,
+	"linsert": linsert,
+	"lmove":   lmove,
+	"blpop":   blpop,
+	"brpop":   brpop,
+	"blmove":  blmove,
+	// sorted set
+	"zadd":          zadd,
+	"zscore":        zscore,
+	"zincrby":       zincrby,
+	"zrem":          zrem,
+	"zcard":         zcard,
+	"zcount":        zcount,
+	"zrank":         zrank,
+	"zrevrank":      zrevrank,
+	"zrange":        zrange,
+	"zrevrange":     zrevrange,
+	"zrangebyscore": zrangebyscore,
+}
+
+var (
+	errSyntax            = errors.New("ERR syntax error")
+	errNotInteger        = errors.New("ERR value is not an integer or out of range")
+	errNotFloat          = errors.New("ERR value is not a valid float")
+	errMinMaxNotFloat    = errors.New("ERR min or max is not a float")
+	errInvalidCursor     = errors.New("ERR invalid cursor")
+	errInvalidTimeout    = errors.New("ERR timeout is not a float or out of range")
+	errNegativeTimeout   = errors.New("ERR timeout is negative")
+	errNotPositive       = errors.New("ERR value is out of range, must be positive")
+	errDBIndexOutOfRange = errors.New("ERR DB index is out of range")
+	errOffsetOutOfRange  = errors.New("ERR offset is out of range")
+)
+
+// 数据类型在TYPE命令中的名字
+var typeNames = map[byte]string{
+	tiny_kvDB_redis.String: "string",
+	tiny_kvDB_redis.Hash:   "hash",
+	tiny_kvDB_redis.Set:    "set",
+	tiny_kvDB_redis.List:   "list",
+	tiny_kvDB_redis.ZSet:   "zset",
 }
 
 type BitcaskClient struct {
@@ -27,48 +143,377 @@ type BitcaskClient struct {
 	db *tiny_kvDB_redis.RedisDataStructure
 	// 连接的server
 	server *BitcaskServer
+	// 连接已经从redcon中分离，由serveDetached处理命令
+	detached bool
+	// 分离之后发现连接断开时关闭，阻塞的命令随之放弃等待
+	disconnected chan struct{}
+}
+
+// blockingCommands 可能一直阻塞的命令，第一次执行时把连接从redcon中分离出来
+var blockingCommands = map[string]bool{
+	"blpop":  true,
+	"brpop":  true,
+	"blmove": true,
 }
 
 func newWrongNumberOfArgsError(cmd string) error {
-	return fmt.Errorf("ERR wrong number of arguments for '%s' command.\n", cmd)
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", cmd)
+}
+
+func newInvalidExpireError(cmd string) error {
+	return fmt.Errorf("ERR invalid expire time in '%s' command", cmd)
 }
 
 func execClientCommand(conn redcon.Conn, cmd redcon.Command) {
 	command := strings.ToLower(string(cmd.Args[0]))
+	// quit需要先回复再关闭连接
+	if command == "quit" {
+		conn.WriteString("OK")
+		_ = conn.Close()
+		return
+	}
 	cmdFunc, ok := supportedCommand[command]
 	if !ok {
-		conn.WriteError("Err unsupported command : '" + command + "'")
+		conn.WriteError("ERR unknown command '" + command + "'")
 		return
 	}
-	//
 	client, _ := conn.Context().(*BitcaskClient)
-	switch command {
-	case "quit":
-		_ = conn.Close()
-	case "ping":
-		conn.WriteString("PONG")
-	default:
-		res, err := cmdFunc(client, cmd.Args[1:])
-		if err != nil {
-			if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
-				conn.WriteNull()
-			} else {
-				conn.WriteError(err.Error())
-			}
+	if blockingCommands[command] && !client.detached {
+		client.detached = true
+		go client.serveDetached(conn.Detach(), cmd)
+		return
+	}
+	res, err := cmdFunc(client, cmd.Args[1:])
+	if err != nil {
+		if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			conn.WriteNull()
 			return
 		}
-		conn.WriteAny(res)
+		msg := err.Error()
+		if !strings.HasPrefix(msg, "ERR ") && !strings.HasPrefix(msg, "WRONGTYPE ") {
+			msg = "ERR " + msg
+		}
+		conn.WriteError(msg)
+		return
 	}
+	conn.WriteAny(res)
 }
 
-func set(client *BitcaskClient, args [][]byte) (any, error) {
+// 返回bulk string，nil表示不存在
+func bulkOrNull(value []byte) any {
+	if value == nil {
+		return nil
+	}
+	return value
+}
+
+// nullArray 空数组回复*-1，阻塞命令超时时使用
+type nullArray struct{}
+
+func (nullArray) MarshalRESP() []byte {
+	return []byte("*-1\r\n")
+}
+
+func boolToInt(ok bool) redcon.SimpleInt {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+func ping(client *BitcaskClient, args [][]byte) (any, error) {
+	switch len(args) {
+	case 0:
+		return redcon.SimpleString("PONG"), nil
+	case 1:
+		return args[0], nil
+	}
+	return nil, newWrongNumberOfArgsError("ping")
+}
+
+func echo(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("echo")
+	}
+	return args[0], nil
+}
+
+func selectDB(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("select")
+	}
+	index, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if index < 0 || index >= databaseNum {
+		return nil, errDBIndexOutOfRange
+	}
+	db, err := client.server.selectDB(index)
+	if err != nil {
+		return nil, err
+	}
+	client.db = db
+	return redcon.SimpleString("OK"), nil
+}
+
+func config(client *BitcaskClient, args [][]byte) (any, error) {
+	// 返回一个空数组响应
+	return []any{}, nil
+}
+
+func del(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("del")
+	}
+	var count int
+	for _, key := range args {
+		ok, err := client.db.Del(key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func typ(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("type")
+	}
+	dataType, err := client.db.Type(args[0])
+	if err != nil {
+		if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			return redcon.SimpleString("none"), nil
+		}
+		return nil, err
+	}
+	return redcon.SimpleString(typeNames[dataType]), nil
+}
+
+func exists(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("exists")
+	}
+	n, err := client.db.Exists(args...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+// parseExpireAt 把EXPIRE类命令的参数转换成过期时刻，unit是参数的单位，relative表示参数是相对现在的时长
+func parseExpireAt(cmd string, arg []byte, unit time.Duration, relative bool) (time.Time, error) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return time.Time{}, errNotInteger
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return time.Time{}, newInvalidExpireError(cmd)
+	}
+	d := time.Duration(n) * unit
+	at := time.Unix(0, 0).Add(d)
+	if relative {
+		at = time.Now().Add(d)
+	}
+	// 过期时间以纳秒时间戳保存，不能超出int64的范围
+	if at.After(time.Unix(0, math.MaxInt64)) {
+		return time.Time{}, newInvalidExpireError(cmd)
+	}
+	return at, nil
+}
+
+func expireCommand(client *BitcaskClient, args [][]byte, cmd string, unit time.Duration, relative bool) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	at, err := parseExpireAt(cmd, args[1], unit, relative)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.db.ExpireAt(args[0], at)
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+// EXPIRE key seconds
+func expire(client *BitcaskClient, args [][]byte) (any, error) {
+	return expireCommand(client, args, "expire", time.Second, true)
+}
+
+// PEXPIRE key milliseconds
+func pexpire(client *BitcaskClient, args [][]byte) (any, error) {
+	return expireCommand(client, args, "pexpire", time.Millisecond, true)
+}
+
+// EXPIREAT key unix-time-seconds
+func expireat(client *BitcaskClient, args [][]byte) (any, error) {
+	return expireCommand(client, args, "expireat", time.Second, false)
+}
+
+// PEXPIREAT key unix-time-milliseconds
+func pexpireat(client *BitcaskClient, args [][]byte) (any, error) {
+	return expireCommand(client, args, "pexpireat", time.Millisecond, false)
+}
+
+// key不存在时返回-2，没有设置过期时间时返回-1，否则返回按unit四舍五入的剩余时间
+func ttlCommand(client *BitcaskClient, args [][]byte, cmd string, unit time.Duration) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	d, err := client.db.TTL(args[0])
+	if err != nil {
+		if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			return redcon.SimpleInt(-2), nil
+		}
+		return nil, err
+	}
+	if d == tiny_kvDB_redis.NoExpire {
+		return redcon.SimpleInt(-1), nil
+	}
+	return redcon.SimpleInt((d + unit/2) / unit), nil
+}
+
+func ttl(client *BitcaskClient, args [][]byte) (any, error) {
+	return ttlCommand(client, args, "ttl", time.Second)
+}
+
+func pttl(client *BitcaskClient, args [][]byte) (any, error) {
+	return ttlCommand(client, args, "pttl", time.Millisecond)
+}
+
+func persist(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("persist")
+	}
+	ok, err := client.db.Persist(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+func keys(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("keys")
+	}
+	res, err := client.db.Keys(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scan(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("scan")
+	}
+	// TYPE只有SCAN支持，先取出来，其余的参数交给parseScanArgs
+	var typeName string
+	rest := [][]byte{args[0]}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 < len(args) && strings.ToLower(string(args[i])) == "type" {
+			typeName = strings.ToLower(string(args[i+1]))
+			continue
+		}
+		rest = append(rest, args[i])
+		if i+1 < len(args) {
+			rest = append(rest, args[i+1])
+		}
+	}
+	cursor, match, count, err := parseScanArgs(rest)
+	if err != nil {
+		return nil, err
+	}
+	next, infos, err := client.db.Scan(cursor, match, count)
+	if err != nil {
+		return nil, err
+	}
+	// 和redis一样，TYPE在检查完count个key之后再过滤
+	res := make([]any, 0, len(infos))
+	for _, info := range infos {
+		if typeName == "" || typeNames[info.Type] == typeName {
+			res = append(res, info.Key)
+		}
+	}
+	return []any{strconv.FormatUint(next, 10), res}, nil
+}
+
+func rename(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("rename")
+	}
+	if err := client.db.Rename(args[0], args[1]); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func renamenx(client *BitcaskClient, args [][]byte) (any, error) {
 	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("renamenx")
+	}
+	ok, err := client.db.RenameNX(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+// SET key value [NX|XX] [EX seconds|PX milliseconds]
+func set(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
 		return nil, newWrongNumberOfArgsError("set")
 	}
 	key, value := args[0], args[1]
-	if err := client.db.Set(key, value, 0); err != nil {
+	var (
+		ttl       time.Duration
+		hasExpire bool
+		cond      = tiny_kvDB_redis.SetAlways
+	)
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); option {
+		case "nx", "xx":
+			if cond != tiny_kvDB_redis.SetAlways {
+				return nil, errSyntax
+			}
+			cond = tiny_kvDB_redis.SetIfNotExist
+			if option == "xx" {
+				cond = tiny_kvDB_redis.SetIfExist
+			}
+		case "ex", "px":
+			if hasExpire || i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, errNotInteger
+			}
+			if n <= 0 {
+				return nil, newInvalidExpireError("set")
+			}
+			hasExpire = true
+			ttl = time.Duration(n) * time.Millisecond
+			if option == "ex" {
+				ttl = time.Duration(n) * time.Second
+			}
+		default:
+			return nil, errSyntax
+		}
+	}
+	ok, err := client.db.SetWithCondition(key, value, ttl, cond)
+	if err != nil {
 		return nil, err
 	}
+	if !ok {
+		return nil, nil
+	}
 	return redcon.SimpleString("OK"), nil
 }
 
@@ -76,76 +521,1132 @@ func get(client *BitcaskClient, args [][]byte) (any, error) {
 	if len(args) != 1 {
 		return nil, newWrongNumberOfArgsError("get")
 	}
-	key := args[0]
-	var value []byte
-	var err error
-	if value, err = client.db.Get(key); err != nil {
+	value, err := client.db.Get(args[0])
+	if err != nil {
 		return nil, err
 	}
-	return value, nil
+	return bulkOrNull(value), nil
 }
 
-func hset(client *BitcaskClient, args [][]byte) (any, error) {
-	if len(args) != 3 {
-		return nil, newWrongNumberOfArgsError("hset")
+func setnx(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("setnx")
 	}
-	var ok = 0
-	key, field, value := args[0], args[1], args[2]
-	res, err := client.db.HSet(key, field, value)
+	ok, err := client.db.SetWithCondition(args[0], args[1], 0, tiny_kvDB_redis.SetIfNotExist)
 	if err != nil {
 		return nil, err
 	}
-	if res {
-		ok = 1
+	return boolToInt(ok), nil
+}
+
+// SETEX、PSETEX的过期时间必须是正数
+func setexCommand(client *BitcaskClient, args [][]byte, cmd string, unit time.Duration) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if n <= 0 || n > math.MaxInt64/int64(unit) {
+		return nil, newInvalidExpireError(cmd)
+	}
+	if err := client.db.Set(args[0], args[2], time.Duration(n)*unit); err != nil {
+		return nil, err
 	}
-	return redcon.SimpleInt(ok), nil
+	return redcon.SimpleString("OK"), nil
 }
 
-func sadd(client *BitcaskClient, args [][]byte) (any, error) {
+// SETEX key seconds value
+func setex(client *BitcaskClient, args [][]byte) (any, error) {
+	return setexCommand(client, args, "setex", time.Second)
+}
+
+// PSETEX key milliseconds value
+func psetex(client *BitcaskClient, args [][]byte) (any, error) {
+	return setexCommand(client, args, "psetex", time.Millisecond)
+}
+
+func getset(client *BitcaskClient, args [][]byte) (any, error) {
 	if len(args) != 2 {
-		return nil, newWrongNumberOfArgsError("sadd")
+		return nil, newWrongNumberOfArgsError("getset")
 	}
-	var ok = 0
-	key, member := args[0], args[1]
-	res, err := client.db.SAdd(key, member)
+	value, err := client.db.GetSet(args[0], args[1])
 	if err != nil {
 		return nil, err
 	}
-	if res {
-		ok = 1
+	return bulkOrNull(value), nil
+}
+
+func getdel(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("getdel")
+	}
+	value, err := client.db.GetDel(args[0])
+	if err != nil {
+		return nil, err
 	}
-	return redcon.SimpleInt(ok), nil
+	return bulkOrNull(value), nil
 }
 
-func lpush(client *BitcaskClient, args [][]byte) (any, error) {
+func mget(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("mget")
+	}
+	values, err := client.db.MGet(args...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, len(values))
+	for i, value := range values {
+		res[i] = bulkOrNull(value)
+	}
+	return res, nil
+}
+
+// 把key value交替出现的参数转换成KeyValue
+func parseKeyValues(args [][]byte) []tiny_kvDB_redis.KeyValue {
+	pairs := make([]tiny_kvDB_redis.KeyValue, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, tiny_kvDB_redis.KeyValue{Key: args[i], Value: args[i+1]})
+	}
+	return pairs
+}
+
+// MSET key value [key value ...]
+func mset(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, newWrongNumberOfArgsError("mset")
+	}
+	if err := client.db.MSet(parseKeyValues(args)...); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// MSETNX key value [key value ...]
+func msetnx(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, newWrongNumberOfArgsError("msetnx")
+	}
+	ok, err := client.db.MSetNX(parseKeyValues(args)...)
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+func incrByCommand(client *BitcaskClient, key []byte, delta int64) (any, error) {
+	n, err := client.db.IncrBy(key, delta)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func incr(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("incr")
+	}
+	return incrByCommand(client, args[0], 1)
+}
+
+func decr(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("decr")
+	}
+	return incrByCommand(client, args[0], -1)
+}
+
+func incrby(client *BitcaskClient, args [][]byte) (any, error) {
 	if len(args) != 2 {
-		return nil, newWrongNumberOfArgsError("sadd")
+		return nil, newWrongNumberOfArgsError("incrby")
 	}
-	key, value := args[0], args[1]
-	res, err := client.db.LPush(key, value)
+	increment, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	return incrByCommand(client, args[0], increment)
+}
+
+func decrby(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("decrby")
+	}
+	decrement, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	// -math.MinInt64会溢出
+	if decrement == math.MinInt64 {
+		return nil, tiny_kvDB_redis.ErrIncrOverflow
+	}
+	return incrByCommand(client, args[0], -decrement)
+}
+
+func incrbyfloat(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("incrbyfloat")
+	}
+	increment, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return nil, errNotFloat
+	}
+	f, err := client.db.IncrByFloat(args[0], increment)
 	if err != nil {
 		return nil, err
 	}
-	return redcon.SimpleInt(res), nil
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
 }
 
-func zadd(client *BitcaskClient, args [][]byte) (any, error) {
-	if len(args) != 3 {
-		return nil, newWrongNumberOfArgsError("zadd")
+// APPEND key value，append是内置函数所以换个名字
+func appendCommand(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("append")
 	}
-	var ok = 0
-	key, score, member := args[0], args[1], args[2]
-	res, err := client.db.ZAdd(key, utils.FloatFromBytes(score), member)
+	n, err := client.db.Append(args[0], args[1])
 	if err != nil {
 		return nil, err
 	}
-	if res {
-		ok = 1
+	return redcon.SimpleInt(n), nil
+}
+
+func strlen(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("strlen")
+	}
+	n, err := client.db.StrLen(args[0])
+	if err != nil {
+		return nil, err
 	}
-	return redcon.SimpleInt(ok), nil
+	return redcon.SimpleInt(n), nil
 }
 
-func config(client *BitcaskClient, args [][]byte) (any, error) {
-	// 返回一个空数组响应
-	return redcon.Array, nil
+// GETRANGE key start end
+func getrange(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("getrange")
+	}
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	return client.db.GetRange(args[0], start, end)
+}
+
+// SETRANGE key offset value
+func setrange(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("setrange")
+	}
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if offset < 0 || offset > math.MaxInt32 {
+		return nil, errOffsetOutOfRange
+	}
+	n, err := client.db.SetRange(args[0], int(offset), args[2])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+// 把field value交替出现的参数转换成FieldValue
+func parseFieldValues(args [][]byte) []tiny_kvDB_redis.FieldValue {
+	fields := make([]tiny_kvDB_redis.FieldValue, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		fields = append(fields, tiny_kvDB_redis.FieldValue{Field: args[i], Value: args[i+1]})
+	}
+	return fields
+}
+
+// HSET key field value [field value ...]
+func hset(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, newWrongNumberOfArgsError("hset")
+	}
+	added, err := client.db.HMSet(args[0], parseFieldValues(args[1:]))
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(added), nil
+}
+
+func hget(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("hget")
+	}
+	value, err := client.db.HGet(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNull(value), nil
+}
+
+func hdel(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("hdel")
+	}
+	var count int
+	for _, field := range args[1:] {
+		ok, err := client.db.HDel(args[0], field)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func hlen(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hlen")
+	}
+	size, err := client.db.HLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func hexists(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("hexists")
+	}
+	ok, err := client.db.HExists(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+func hgetall(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hgetall")
+	}
+	fields, err := client.db.HGetAll(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return fieldValuesReply(fields), nil
+}
+
+func hkeys(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hkeys")
+	}
+	return client.db.HKeys(args[0])
+}
+
+func hvals(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hvals")
+	}
+	return client.db.HVals(args[0])
+}
+
+func hmset(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, newWrongNumberOfArgsError("hmset")
+	}
+	if _, err := client.db.HMSet(args[0], parseFieldValues(args[1:])); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func hmget(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("hmget")
+	}
+	values, err := client.db.HMGet(args[0], args[1:])
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, len(values))
+	for i, value := range values {
+		res[i] = bulkOrNull(value)
+	}
+	return res, nil
+}
+
+func hsetnx(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("hsetnx")
+	}
+	ok, err := client.db.HSetNX(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+func hincrby(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("hincrby")
+	}
+	increment, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	n, err := client.db.HIncrBy(args[0], args[1], increment)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+func hincrbyfloat(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("hincrbyfloat")
+	}
+	increment, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return nil, errNotFloat
+	}
+	f, err := client.db.HIncrByFloat(args[0], args[1], increment)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count]
+func hscan(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("hscan")
+	}
+	cursor, match, count, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	next, fields, err := client.db.HScan(args[0], cursor, match, count)
+	if err != nil {
+		return nil, err
+	}
+	return []any{strconv.FormatUint(next, 10), fieldValuesReply(fields)}, nil
+}
+
+// 返回field value交替出现的数组
+func fieldValuesReply(fields []tiny_kvDB_redis.FieldValue) []any {
+	res := make([]any, 0, len(fields)*2)
+	for _, fv := range fields {
+		res = append(res, fv.Field, fv.Value)
+	}
+	return res
+}
+
+// 解析SCAN类命令的 cursor [MATCH pattern] [COUNT count]
+func parseScanArgs(args [][]byte) (uint64, []byte, int, error) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, nil, 0, errInvalidCursor
+	}
+	var (
+		match []byte
+		count int
+	)
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return 0, nil, 0, errSyntax
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			match = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil {
+				return 0, nil, 0, errNotInteger
+			}
+			if count < 1 {
+				return 0, nil, 0, errSyntax
+			}
+		default:
+			return 0, nil, 0, errSyntax
+		}
+	}
+	return cursor, match, count, nil
+}
+
+func sadd(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sadd")
+	}
+	var count int
+	for _, member := range args[1:] {
+		ok, err := client.db.SAdd(args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func sismember(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("sismember")
+	}
+	ok, err := client.db.SIsMember(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+func srem(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("srem")
+	}
+	var count int
+	for _, member := range args[1:] {
+		ok, err := client.db.SRem(args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func scard(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("scard")
+	}
+	size, err := client.db.SCard(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func smembers(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("smembers")
+	}
+	return client.db.SMembers(args[0])
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func sscan(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sscan")
+	}
+	cursor, match, count, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	next, members, err := client.db.SScan(args[0], cursor, match, count)
+	if err != nil {
+		return nil, err
+	}
+	return []any{strconv.FormatUint(next, 10), members}, nil
+}
+
+func sinter(client *BitcaskClient, args [][]byte) (any, error) {
+	return setAlgebra(args, "sinter", client.db.SInter)
+}
+
+func sunion(client *BitcaskClient, args [][]byte) (any, error) {
+	return setAlgebra(args, "sunion", client.db.SUnion)
+}
+
+func sdiff(client *BitcaskClient, args [][]byte) (any, error) {
+	return setAlgebra(args, "sdiff", client.db.SDiff)
+}
+
+// SINTER/SUNION/SDIFF key [key ...]
+func setAlgebra(args [][]byte, cmd string, algebraFunc func(keys ...[]byte) ([][]byte, error)) (any, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	return algebraFunc(args...)
+}
+
+func sinterstore(client *BitcaskClient, args [][]byte) (any, error) {
+	return setAlgebraStore(args, "sinterstore", client.db.SInterStore)
+}
+
+func sunionstore(client *BitcaskClient, args [][]byte) (any, error) {
+	return setAlgebraStore(args, "sunionstore", client.db.SUnionStore)
+}
+
+func sdiffstore(client *BitcaskClient, args [][]byte) (any, error) {
+	return setAlgebraStore(args, "sdiffstore", client.db.SDiffStore)
+}
+
+// SINTERSTORE/SUNIONSTORE/SDIFFSTORE destination key [key ...]
+func setAlgebraStore(args [][]byte, cmd string, storeFunc func(destination []byte, keys ...[]byte) (int, error)) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	size, err := storeFunc(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+// SRANDMEMBER key [count]
+func srandmember(client *BitcaskClient, args [][]byte) (any, error) {
+	return randomMembers(args, "srandmember", true, client.db.SRandMember)
+}
+
+// SPOP key [count]
+func spop(client *BitcaskClient, args [][]byte) (any, error) {
+	return randomMembers(args, "spop", false, client.db.SPop)
+}
+
+// 没有count参数时返回一个成员或者null，有count参数时返回数组，allowNegative表示count是否可以是负数
+func randomMembers(args [][]byte, cmd string, allowNegative bool,
+	randomFunc func(key []byte, count int) ([][]byte, error)) (any, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	if len(args) == 1 {
+		members, err := randomFunc(args[0], 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return members[0], nil
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if !allowNegative && count < 0 {
+		return nil, errNotPositive
+	}
+	return randomFunc(args[0], count)
+}
+
+func smove(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("smove")
+	}
+	ok, err := client.db.SMove(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return boolToInt(ok), nil
+}
+
+func lpush(client *BitcaskClient, args [][]byte) (any, error) {
+	return push(client, args, "lpush", client.db.LPush)
+}
+
+func rpush(client *BitcaskClient, args [][]byte) (any, error) {
+	return push(client, args, "rpush", client.db.RPush)
+}
+
+// 所有元素原子地写入，返回push之后列表的长度
+func push(client *BitcaskClient, args [][]byte, cmd string, pushFunc func(key []byte, elements ...[]byte) (uint32, error)) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	size, err := pushFunc(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func lpop(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("lpop")
+	}
+	element, err := client.db.LPop(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNull(element), nil
+}
+
+func rpop(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("rpop")
+	}
+	element, err := client.db.RPop(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNull(element), nil
+}
+
+func llen(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("llen")
+	}
+	size, err := client.db.LLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func lindex(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("lindex")
+	}
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	element, err := client.db.LIndex(args[0], index)
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNull(element), nil
+}
+
+// 解析start stop两个下标
+func parseRangeIndex(start, stop []byte) (int64, int64, error) {
+	i, err := strconv.ParseInt(string(start), 10, 64)
+	if err != nil {
+		return 0, 0, errNotInteger
+	}
+	j, err := strconv.ParseInt(string(stop), 10, 64)
+	if err != nil {
+		return 0, 0, errNotInteger
+	}
+	return i, j, nil
+}
+
+func lrange(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("lrange")
+	}
+	start, stop, err := parseRangeIndex(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return client.db.LRange(args[0], start, stop)
+}
+
+func lset(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("lset")
+	}
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if err := client.db.LSet(args[0], index, args[2]); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func ltrim(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("ltrim")
+	}
+	start, stop, err := parseRangeIndex(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if err := client.db.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func lrem(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("lrem")
+	}
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	n, err := client.db.LRem(args[0], count, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(n), nil
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func linsert(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 4 {
+		return nil, newWrongNumberOfArgsError("linsert")
+	}
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		return nil, errSyntax
+	}
+	size, err := client.db.LInsert(args[0], before, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+// 解析LEFT|RIGHT，返回是否是LEFT
+func parseListDirection(arg []byte) (bool, error) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, errSyntax
+}
+
+// 解析阻塞命令以秒为单位的超时时间，0表示一直等待
+func parseTimeout(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errInvalidTimeout
+	}
+	if seconds < 0 {
+		return 0, errNegativeTimeout
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	// 非常小的正数不能变成0，否则会一直等待
+	if seconds > 0 && timeout == 0 {
+		timeout = time.Nanosecond
+	}
+	return timeout, nil
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func lmove(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 4 {
+		return nil, newWrongNumberOfArgsError("lmove")
+	}
+	fromLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+	toLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+	element, err := client.db.LMove(args[0], args[1], fromLeft, toLeft)
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNull(element), nil
+}
+
+func blpop(client *BitcaskClient, args [][]byte) (any, error) {
+	return blockingPop(client, args, "blpop", client.db.BLPop)
+}
+
+func brpop(client *BitcaskClient, args [][]byte) (any, error) {
+	return blockingPop(client, args, "brpop", client.db.BRPop)
+}
+
+// BLPOP/BRPOP key [key ...] timeout
+// 只阻塞当前连接的goroutine，其他连接不受影响，连接断开时放弃等待
+func blockingPop(client *BitcaskClient, args [][]byte, cmd string,
+	popFunc func(keys [][]byte, timeout time.Duration, cancel <-chan struct{}) ([]byte, []byte, error)) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	key, element, err := popFunc(args[:len(args)-1], timeout, client.disconnected)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nullArray{}, nil
+	}
+	return []any{key, element}, nil
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func blmove(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 5 {
+		return nil, newWrongNumberOfArgsError("blmove")
+	}
+	fromLeft, err := parseListDirection(args[2])
+	if err != nil {
+		return nil, err
+	}
+	toLeft, err := parseListDirection(args[3])
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseTimeout(args[4])
+	if err != nil {
+		return nil, err
+	}
+	element, err := client.db.BLMove(args[0], args[1], fromLeft, toLeft, timeout, client.disconnected)
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNull(element), nil
+}
+
+// 解析分数，不接受NaN
+func parseScore(arg []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+// 解析分数范围的一端，"("开头表示不包含这个值，可以用-inf和+inf
+func parseScoreBound(arg []byte) (float64, bool, error) {
+	exclusive := len(arg) > 0 && arg[0] == '('
+	if exclusive {
+		arg = arg[1:]
+	}
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, errMinMaxNotFloat
+	}
+	return score, exclusive, nil
+}
+
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// 返回成员数组，withScores为true时每个成员后面跟着它的分数
+func zMembersReply(members []tiny_kvDB_redis.ZMember, withScores bool) []any {
+	res := make([]any, 0, len(members))
+	for _, zm := range members {
+		res = append(res, zm.Member)
+		if withScores {
+			res = append(res, formatScore(zm.Score))
+		}
+	}
+	return res
+}
+
+// ZADD key score member [score member ...]
+func zadd(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, newWrongNumberOfArgsError("zadd")
+	}
+	// 先检查所有的分数，避免只写入了一部分
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	var count int
+	for i, score := range scores {
+		ok, err := client.db.ZAdd(args[0], score, args[2*i+2])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func zscore(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("zscore")
+	}
+	score, err := client.db.ZScore(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return formatScore(score), nil
+}
+
+func zincrby(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("zincrby")
+	}
+	increment, err := parseScore(args[1])
+	if err != nil {
+		return nil, err
+	}
+	score, err := client.db.ZIncrBy(args[0], increment, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return formatScore(score), nil
+}
+
+func zrem(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("zrem")
+	}
+	var count int
+	for _, member := range args[1:] {
+		ok, err := client.db.ZRem(args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func zcard(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("zcard")
+	}
+	size, err := client.db.ZCard(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+// 解析min max两个参数
+func parseScoreRange(min, max []byte) (tiny_kvDB_redis.ScoreRange, error) {
+	var (
+		rng tiny_kvDB_redis.ScoreRange
+		err error
+	)
+	if rng.Min, rng.MinExclusive, err = parseScoreBound(min); err != nil {
+		return rng, err
+	}
+	if rng.Max, rng.MaxExclusive, err = parseScoreBound(max); err != nil {
+		return rng, err
+	}
+	return rng, nil
+}
+
+func zcount(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("zcount")
+	}
+	rng, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	count, err := client.db.ZCount(args[0], rng)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func zrank(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("zrank")
+	}
+	rank, err := client.db.ZRank(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(rank), nil
+}
+
+func zrevrank(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("zrevrank")
+	}
+	rank, err := client.db.ZRevRank(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(rank), nil
+}
+
+func zrange(client *BitcaskClient, args [][]byte) (any, error) {
+	return zrangeByIndex(client, args, "zrange", client.db.ZRange)
+}
+
+func zrevrange(client *BitcaskClient, args [][]byte) (any, error) {
+	return zrangeByIndex(client, args, "zrevrange", client.db.ZRevRange)
+}
+
+// ZRANGE/ZREVRANGE key start stop [WITHSCORES]
+func zrangeByIndex(client *BitcaskClient, args [][]byte, cmd string,
+	rangeFunc func(key []byte, start, stop int64) ([]tiny_kvDB_redis.ZMember, error)) (any, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, newWrongNumberOfArgsError(cmd)
+	}
+	withScores := len(args) == 4
+	if withScores && strings.ToLower(string(args[3])) != "withscores" {
+		return nil, errSyntax
+	}
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	members, err := rangeFunc(args[0], start, stop)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func zrangebyscore(client *BitcaskClient, args [][]byte) (any, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumberOfArgsError("zrangebyscore")
+	}
+	rng, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	var (
+		withScores bool
+		offset     int
+		count      = -1
+	)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return nil, errSyntax
+			}
+			if offset, err = strconv.Atoi(string(args[i+1])); err != nil {
+				return nil, errNotInteger
+			}
+			if count, err = strconv.Atoi(string(args[i+2])); err != nil {
+				return nil, errNotInteger
+			}
+			i += 2
+		default:
+			return nil, errSyntax
+		}
+	}
+	members, err := client.db.ZRangeByScore(args[0], rng, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	return zMembersReply(members, withScores), nil
 }
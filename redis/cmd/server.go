@@ -3,30 +3,37 @@ package main
 import (
 	"github.com/tidwall/redcon"
 	"log"
+	"strconv"
 	"sync"
 	tiny_kvDB "tiny-kvDB"
 	tiny_kvDB_redis "tiny-kvDB/redis"
 )
 
-const addr = "localhost:6380"
+const (
+	addr        = "localhost:6380"
+	databaseNum = 16 // SELECT可以选择的数据库数量
+)
 
 type BitcaskServer struct {
 	// 可以连接多个db
-	dbs    map[int]*tiny_kvDB_redis.RedisDataStructure
-	server *redcon.Server
-	mu     sync.RWMutex
+	dbs     map[int]*tiny_kvDB_redis.RedisDataStructure
+	options tiny_kvDB.Options // 0号数据库的配置，其他数据库放在相邻的目录中
+	server  *redcon.Server
+	mu      sync.RWMutex
 }
 
 func main() {
 	// 打开redis数据结构的服务
-	rds, err := tiny_kvDB_redis.NewRedisDataStructure(tiny_kvDB.DefaultOptions)
+	options := tiny_kvDB.DefaultOptions
+	rds, err := tiny_kvDB_redis.NewRedisDataStructure(options)
 	if err != nil {
 		panic(err)
 	}
 
 	// 初始化Bitcaskserver
 	bitcaskServer := &BitcaskServer{
-		dbs: make(map[int]*tiny_kvDB_redis.RedisDataStructure),
+		dbs:     make(map[int]*tiny_kvDB_redis.RedisDataStructure),
+		options: options,
 	}
 	bitcaskServer.dbs[0] = rds
 
@@ -37,11 +44,19 @@ func main() {
 
 func (svr *BitcaskServer) listen() {
 	log.Println("bitcask server running, ready to accept connections.")
-	_ = svr.server.ListenAndServe()
+	if err := svr.server.ListenAndServe(); err != nil {
+		log.Printf("bitcask server stopped: %v\n", err)
+	}
+	// 服务停止之后关闭所有的数据库
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	for _, db := range svr.dbs {
+		_ = db.Close()
+	}
 }
 
 func (svr *BitcaskServer) accept(conn redcon.Conn) bool {
-	client := new(BitcaskClient)
+	client := &BitcaskClient{disconnected: make(chan struct{})}
 	svr.mu.Lock()
 	defer svr.mu.Unlock()
 	client.server = svr
@@ -51,10 +66,62 @@ func (svr *BitcaskServer) accept(conn redcon.Conn) bool {
 	return true
 }
 
+// close 一个客户端断开连接，数据库由其他连接共享，不能关闭
+// 连接被分离时也会调用，之后由serveDetached处理
 func (svr *BitcaskServer) close(conn redcon.Conn, err error) {
-	for _, db := range svr.dbs {
-		_ = db.Close()
+}
+
+// serveDetached 处理分离之后的连接上所有的命令，first是触发分离的阻塞命令
+// redcon在执行命令期间不读取连接，发现不了客户端断开，阻塞的命令会一直登记在列表上，
+// 断开之后push的元素仍然会被它取走然后丢失。所以分离之后由单独的goroutine读取命令，
+// 读取出错说明连接已经断开，关闭client.disconnected让阻塞的命令放弃等待
+func (client *BitcaskClient) serveDetached(conn redcon.DetachedConn, first redcon.Command) {
+	defer conn.Close()
+	cmds := make(chan redcon.Command)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// 读到的命令都交给了处理命令的goroutine之后才关闭，断开之前发送的命令不会被丢弃
+		defer close(client.disconnected)
+		for {
+			cmd, err := conn.ReadCommand()
+			if err != nil {
+				return
+			}
+			select {
+			case cmds <- cmd:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for cmd := first; ; {
+		execClientCommand(conn, cmd)
+		if err := conn.Flush(); err != nil {
+			return
+		}
+		select {
+		case cmd = <-cmds:
+		case <-client.disconnected:
+			return
+		}
+	}
+}
+
+// selectDB 返回index号数据库，第一次选择时打开
+func (svr *BitcaskServer) selectDB(index int) (*tiny_kvDB_redis.RedisDataStructure, error) {
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	if db, ok := svr.dbs[index]; ok {
+		return db, nil
+	}
+	options := svr.options
+	options.DirPath = svr.options.DirPath + "-db" + strconv.Itoa(index)
+	db, err := tiny_kvDB_redis.NewRedisDataStructure(options)
+	if err != nil {
+		return nil, err
 	}
-	_ = svr.server.Close()
-	_ = conn.Close()
+	svr.dbs[index] = db
+	return db, nil
 }
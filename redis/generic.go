@@ -1,19 +1,376 @@
 package redis
 
-import "errors"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+	"tiny-kvDB/utils"
+)
 
-func (rds *RedisDataStructure) Del(key []byte) error {
-	return rds.db.Delete(key)
+// Del 删除key，返回删除的是否是仍然有效的key
+// 检查和删除期间持有所有类型的写锁，否则并发的写入可能按照删除之前读到的元数据把key写回来
+func (rds *RedisDataStructure) Del(key []byte) (bool, error) {
+	rds.lockAllTypes()
+	defer rds.unlockAllTypes()
+	mk := metaKey(key)
+	encValue, err := rds.db.Get(mk)
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := rds.db.Delete(mk); err != nil {
+		return false, err
+	}
+	return isLiveValue(encValue), nil
 }
 
+// Type 返回key的数据类型，key不存在或者已经过期时返回ErrKeyNotFound
 func (rds *RedisDataStructure) Type(key []byte) (redisDataType, error) {
-	encValue, err := rds.db.Get(key)
+	encValue, err := rds.db.Get(metaKey(key))
 	if err != nil {
 		return 0, err
 	}
 	if len(encValue) == 0 {
 		return 0, errors.New("value is null")
 	}
+	if !isLiveValue(encValue) {
+		return 0, tiny_kvDB.ErrKeyNotFound
+	}
 	// 第一个字节就是类型
 	return encValue[0], nil
 }
+
+// NoExpire TTL的返回值，表示key没有设置过期时间
+const NoExpire time.Duration = -1
+
+// KeyInfo SCAN返回的key和它的数据类型
+type KeyInfo struct {
+	Key  []byte
+	Type redisDataType
+}
+
+// Exists 返回keys中仍然有效的key的数量，重复的key重复计算
+func (rds *RedisDataStructure) Exists(keys ...[]byte) (int, error) {
+	var n int
+	for _, key := range keys {
+		_, err := rds.Type(key)
+		if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Expire 设置key在ttl之后过期，返回key是否存在
+func (rds *RedisDataStructure) Expire(key []byte, ttl time.Duration) (bool, error) {
+	return rds.ExpireAt(key, time.Now().Add(ttl))
+}
+
+// ExpireAt 设置key在at时刻过期，at已经过去时直接删除key，返回key是否存在
+func (rds *RedisDataStructure) ExpireAt(key []byte, at time.Time) (bool, error) {
+	remove := !at.After(time.Now())
+	return rds.updateExpire(key, func(encValue []byte, _ int64) ([]byte, bool) {
+		if remove {
+			return nil, true
+		}
+		return withExpire(encValue, at.UnixNano()), true
+	})
+}
+
+// Persist 清除key的过期时间，返回key是否存在并且设置了过期时间
+func (rds *RedisDataStructure) Persist(key []byte) (bool, error) {
+	return rds.updateExpire(key, func(encValue []byte, expire int64) ([]byte, bool) {
+		if expire == 0 {
+			return nil, false
+		}
+		return withExpire(encValue, 0), true
+	})
+}
+
+// TTL 返回key剩余的存活时间，没有设置过期时间时返回NoExpire，key不存在时返回ErrKeyNotFound
+func (rds *RedisDataStructure) TTL(key []byte) (time.Duration, error) {
+	encValue, err := rds.db.Get(metaKey(key))
+	if err != nil {
+		return 0, err
+	}
+	if !isLiveValue(encValue) {
+		return 0, tiny_kvDB.ErrKeyNotFound
+	}
+	expire, _ := binary.Varint(encValue[1:])
+	if expire == 0 {
+		return NoExpire, nil
+	}
+	return time.Duration(expire - time.Now().UnixNano()), nil
+}
+
+// Keys 按顺序返回所有匹配pattern的key
+func (rds *RedisDataStructure) Keys(pattern []byte) ([][]byte, error) {
+	keys := [][]byte{}
+	err := rds.walkKeys(func(key []byte, _ redisDataType) bool {
+		if utils.GlobMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, err
+}
+
+// Scan 从cursor开始检查最多count个key，返回其中匹配match的key以及下一次调用的cursor
+// 游标的含义见scanCursor
+func (rds *RedisDataStructure) Scan(cursor uint64, match []byte, count int) (uint64, []KeyInfo, error) {
+	return scanCursor(cursor, match, count, func(fn func([]byte, KeyInfo) bool) error {
+		return rds.walkKeys(func(key []byte, dataType redisDataType) bool {
+			return fn(key, KeyInfo{Key: key, Type: dataType})
+		})
+	})
+}
+
+// Rename 把source改名为destination，覆盖destination原来的值，过期时间保持不变
+// source不存在时返回ErrNoSuchKey
+func (rds *RedisDataStructure) Rename(source, destination []byte) error {
+	_, err := rds.rename(source, destination, false)
+	return err
+}
+
+// RenameNX destination不存在时才改名，返回是否改名
+func (rds *RedisDataStructure) RenameNX(source, destination []byte) (bool, error) {
+	return rds.rename(source, destination, true)
+}
+
+func (rds *RedisDataStructure) rename(source, destination []byte, nx bool) (bool, error) {
+	// 改名期间不能有其他写入修改source，否则复制之后的修改会随着原来的version一起被丢弃
+	rds.lockAllTypes()
+	defer rds.unlockAllTypes()
+	encValue, err := rds.db.Get(metaKey(source))
+	if err != nil && !errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return false, err
+	}
+	if err != nil || !isLiveValue(encValue) {
+		return false, ErrNoSuchKey
+	}
+	if nx {
+		n, err := rds.Exists(destination)
+		if err != nil || n > 0 {
+			return false, err
+		}
+	}
+	if bytes.Equal(source, destination) {
+		return true, nil
+	}
+
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
+	_ = wb.Delete(metaKey(source))
+	if encValue[0] == String {
+		_ = wb.Put(metaKey(destination), encValue)
+	} else {
+		// 内部key的后缀和key无关，逐个复制到destination的新version下，同时删除原来的内部key
+		// destination原来的内部key因为version不同不会再被读到，由ReclaimStaleKeys回收
+		meta := decodeMetaData(encValue)
+		oldPrefix := internalKeyPrefix(meta.dataType, source, meta.version)
+		meta.version = time.Now().UnixNano()
+		meta.isNew = true
+		newPrefix := internalKeyPrefix(meta.dataType, destination, meta.version)
+		err := rds.scanPrefix(oldPrefix, func(iter *tiny_kvDB.Iterator) (bool, error) {
+			value, err := iter.Value()
+			if err != nil {
+				return false, err
+			}
+			oldKey := append([]byte(nil), iter.Key()...)
+			newKey := append(append([]byte(nil), newPrefix...), oldKey[len(oldPrefix):]...)
+			_ = wb.Put(newKey, value)
+			_ = wb.Delete(oldKey)
+			return true, nil
+		})
+		if err != nil {
+			return false, err
+		}
+		rds.putMetaData(wb, destination, meta)
+	}
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	if encValue[0] == List {
+		rds.waiters.notify(destination)
+	}
+	return true, nil
+}
+
+// lockAllTypes 按固定的顺序持有所有类型的写锁，用于DEL、RENAME、EXPIRE这些不区分类型修改元数据的操作
+// 其他操作最多持有一个类型的锁
+func (rds *RedisDataStructure) lockAllTypes() {
+	rds.stringMu.Lock()
+	rds.listMu.Lock()
+	rds.hashMu.Lock()
+	rds.setMu.Lock()
+	rds.zsetMu.Lock()
+}
+
+func (rds *RedisDataStructure) unlockAllTypes() {
+	rds.zsetMu.Unlock()
+	rds.setMu.Unlock()
+	rds.hashMu.Unlock()
+	rds.listMu.Unlock()
+	rds.stringMu.Unlock()
+}
+
+// updateExpire 用CompareAndSwap原子地修改key的过期时间，key不存在时返回false
+// update根据原来的编码和过期时间返回新的编码，返回nil表示删除key，返回false表示不需要修改
+// 数据结构的写入无条件地覆盖元数据，所以修改期间持有所有类型的写锁，否则新的过期时间会被覆盖
+func (rds *RedisDataStructure) updateExpire(key []byte,
+	update func(encValue []byte, expire int64) ([]byte, bool)) (bool, error) {
+	rds.lockAllTypes()
+	defer rds.unlockAllTypes()
+	mk := metaKey(key)
+	for {
+		old, err := rds.db.Get(mk)
+		if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !isLiveValue(old) {
+			return false, nil
+		}
+		expire, _ := binary.Varint(old[1:])
+		encValue, ok := update(old, expire)
+		if !ok {
+			return false, nil
+		}
+		var swapped bool
+		if encValue == nil {
+			swapped, err = rds.db.DeleteIfEquals(mk, old)
+		} else {
+			swapped, err = rds.db.CompareAndSwap(mk, old, encValue)
+		}
+		if err != nil {
+			return false, err
+		}
+		// 期间key被其他写入修改了，重新读取
+		if swapped {
+			return true, nil
+		}
+	}
+}
+
+// withExpire 替换编码中的过期时间，string和元数据的编码都是type+expire开头
+func withExpire(encValue []byte, expire int64) []byte {
+	_, n := binary.Varint(encValue[1:])
+	buf := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(encValue)-1-n)
+	buf[0] = encValue[0]
+	index := 1 + binary.PutVarint(buf[1:], expire)
+	return append(buf[:index], encValue[1+n:]...)
+}
+
+// walkKeys 按顺序遍历所有仍然有效的用户key，fn返回false时停止遍历
+func (rds *RedisDataStructure) walkKeys(fn func(key []byte, dataType redisDataType) bool) error {
+	return rds.scanPrefix([]byte{tagMetaData}, func(iter *tiny_kvDB.Iterator) (bool, error) {
+		encValue, err := iter.Value()
+		if err != nil {
+			return false, err
+		}
+		if !isLiveValue(encValue) {
+			return true, nil
+		}
+		return fn(append([]byte(nil), iter.Key()[1:]...), encValue[0]), nil
+	})
+}
+
+// DumpExpireAt 从底层数据库的key和value中解析出redis key的过期时间，用作tiny_kvDB.ExportOptions.ExpireAt
+// 过期时间保存在元数据的value中，导入后原样生效；数据结构的内部key没有单独的过期时间，返回零值
+func DumpExpireAt(key, value []byte) time.Time {
+	if len(key) == 0 || key[0] != tagMetaData || len(value) < 2 {
+		return time.Time{}
+	}
+	expire, n := binary.Varint(value[1:])
+	if n <= 0 || expire <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, expire)
+}
+
+// 判断key对应的value是否仍然有效
+// string和元数据的编码都是type+expire开头，数据结构中没有元素时也视为不存在
+func isLiveValue(encValue []byte) bool {
+	if len(encValue) == 0 {
+		return false
+	}
+	if encValue[0] != String && decodeMetaData(encValue).size == 0 {
+		return false
+	}
+	expire, _ := binary.Varint(encValue[1:])
+	return expire == 0 || expire > time.Now().UnixNano()
+}
+
+// scanPrefix 按顺序遍历所有前缀为prefix的内部key，fn返回false时停止遍历
+// 创建迭代器只复制索引的写时复制快照，Seek之后的开销和前缀下key的数量成正比，和数据库中key的总数无关
+// 迭代器不设置Prefix，遇到第一个不满足前缀的key就结束，避免迭代器跳过前缀时扫描整个索引
+func (rds *RedisDataStructure) scanPrefix(prefix []byte, fn func(iter *tiny_kvDB.Iterator) (bool, error)) error {
+	iter, err := rds.db.NewIterator(tiny_kvDB.DefaultIteratorOptions)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Seek(prefix); iter.Valid(); iter.Next() {
+		if !bytes.HasPrefix(iter.Key(), prefix) {
+			break
+		}
+		ok, err := fn(iter)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+	}
+	return nil
+}
+
+// defaultScanCount SCAN类命令每次检查的元素数量
+const defaultScanCount = 10
+
+// scanCursor HSCAN、SSCAN共用的游标逻辑
+// cursor是已经遍历过的元素数量，跳过这些元素之后最多检查count个，返回其中name匹配match的元素和下一次调用的cursor
+// 返回的cursor为0表示遍历结束，match为nil时不过滤。遍历期间删除元素会让后面的元素向前移动，可能被跳过
+func scanCursor[T any](cursor uint64, match []byte, count int,
+	walk func(fn func(name []byte, item T) bool) error) (uint64, []T, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	var (
+		skipped  uint64
+		examined int
+		hasMore  bool
+	)
+	items := []T{}
+	err := walk(func(name []byte, item T) bool {
+		if skipped < cursor {
+			skipped++
+			return true
+		}
+		if examined == count {
+			hasMore = true
+			return false
+		}
+		examined++
+		if match == nil || utils.GlobMatch(match, name) {
+			items = append(items, item)
+		}
+		return true
+	})
+	if err != nil || !hasMore {
+		return 0, items, err
+	}
+	return cursor + uint64(examined), items, nil
+}
@@ -0,0 +1,420 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+)
+
+// 每种类型各写入一个key，hash的value和string的编码相同，不能被当作用户key
+func fillKeySpace(t *testing.T, rds *RedisDataStructure) {
+	assert.Nil(t, rds.Set([]byte("str"), []byte("v"), 0))
+	_, err := rds.HSet([]byte("hash"), []byte("f1"), encodeStringValue([]byte("x"), 0))
+	assert.Nil(t, err)
+	_, err = rds.HSet([]byte("hash"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("set"), []byte("m"))
+	assert.Nil(t, err)
+	_, err = rds.RPush([]byte("list"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("zset"), -1e300, []byte("m"))
+	assert.Nil(t, err)
+}
+
+func TestRedisDataStructure_Keys(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	fillKeySpace(t, rds)
+	keys, err := rds.Keys([]byte("*"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("hash", "list", "set", "str", "zset"), keys)
+	keys, err = rds.Keys([]byte("s[et]*"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("set", "str"), keys)
+
+	// 过期的key和它的内部key都不可见
+	ok, err := rds.Expire([]byte("hash"), time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	time.Sleep(5 * time.Millisecond)
+	keys, err = rds.Keys([]byte("*"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("list", "set", "str", "zset"), keys)
+
+	n, err := rds.Exists([]byte("str"), []byte("hash"), []byte("set"), []byte("str"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestRedisDataStructure_Scan(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	fillKeySpace(t, rds)
+	for i := 0; i < 20; i++ {
+		_, err := rds.HSet([]byte(fmt.Sprintf("h-%02d", i)), []byte("f"), []byte("v"))
+		assert.Nil(t, err)
+	}
+	var (
+		cursor uint64
+		all    []KeyInfo
+	)
+	for {
+		next, infos, err := rds.Scan(cursor, nil, 6)
+		assert.Nil(t, err)
+		all = append(all, infos...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 25, len(all))
+	for _, info := range all {
+		if string(info.Key) == "list" {
+			assert.Equal(t, List, info.Type)
+		}
+	}
+
+	_, infos, err := rds.Scan(0, []byte("h-1*"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(infos))
+}
+
+func TestRedisDataStructure_Expire(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	fillKeySpace(t, rds)
+	_, err := rds.TTL([]byte("none"))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+	ok, err := rds.Expire([]byte("none"), time.Minute)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	for _, key := range []string{"str", "hash", "set", "list", "zset"} {
+		ttl, err := rds.TTL([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, NoExpire, ttl)
+
+		ok, err := rds.Expire([]byte(key), time.Minute)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ttl, err = rds.TTL([]byte(key))
+		assert.Nil(t, err)
+		assert.True(t, ttl > 59*time.Second && ttl <= time.Minute)
+
+		ok, err = rds.Persist([]byte(key))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = rds.Persist([]byte(key))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+		ttl, err = rds.TTL([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, NoExpire, ttl)
+	}
+
+	// 修改过期时间不影响数据
+	value, err := rds.Get([]byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+	value, err = rds.HGet([]byte("hash"), []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	elements, err := rds.LRange([]byte("list"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "b"), elements)
+
+	// 过去的时间直接删除
+	ok, err = rds.ExpireAt([]byte("list"), time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	n, err := rds.Exists([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRedisDataStructure_Rename(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	fillKeySpace(t, rds)
+	assert.Equal(t, ErrNoSuchKey, rds.Rename([]byte("none"), []byte("x")))
+
+	ok, err := rds.Expire([]byte("hash"), time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	// 覆盖其他类型的destination
+	assert.Nil(t, rds.Rename([]byte("hash"), []byte("str")))
+	value, err := rds.HGet([]byte("str"), []byte("f2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	ttl, err := rds.TTL([]byte("str"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	n, err := rds.Exists([]byte("hash"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	// 原来的内部key已经删除，重新创建的hash是空的
+	size, err := rds.HLen([]byte("hash"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), size)
+
+	assert.Nil(t, rds.Rename([]byte("list"), []byte("list2")))
+	elements, err := rds.LRange([]byte("list2"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "b"), elements)
+
+	ok, err = rds.RenameNX([]byte("set"), []byte("zset"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.RenameNX([]byte("set"), []byte("set2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.SIsMember([]byte("set2"), []byte("m"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	keys, err := rds.Keys([]byte("*"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("list2", "set2", "str", "zset"), keys)
+}
+
+func TestRedisDataStructure_RecreateDeadKey(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 过期的string可以被当作其他类型重新创建
+	assert.Nil(t, rds.Set([]byte("expired"), []byte("v"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	n, err := rds.Exists([]byte("expired"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	size, err := rds.HLen([]byte("expired"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), size)
+	added, err := rds.HSet([]byte("expired"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	assert.True(t, added)
+	typ, err := rds.Type([]byte("expired"))
+	assert.Nil(t, err)
+	assert.Equal(t, Hash, typ)
+
+	// 删除最后一个field之后hash不存在，可以被当作集合和列表重新创建
+	ok, err := rds.HDel([]byte("expired"), []byte("f"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	n, err = rds.Exists([]byte("expired"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	added, err = rds.SAdd([]byte("expired"), []byte("m"))
+	assert.Nil(t, err)
+	assert.True(t, added)
+	ok, err = rds.SRem([]byte("expired"), []byte("m"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	length, err := rds.LPush([]byte("expired"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), length)
+	elements, err := rds.LRange([]byte("expired"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a"), elements)
+
+	// 仍然有效的key类型不同时报错
+	_, err = rds.SAdd([]byte("expired"), []byte("m"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestRedisDataStructure_RenameConcurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 改名期间对source的写入要么被复制到destination，要么写入新的source，不会丢失
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			_, err := rds.HSet([]byte("h"), []byte(fmt.Sprint(i)), []byte("v"))
+			assert.Nil(t, err)
+			_, err = rds.IncrBy([]byte("n"), 1)
+			assert.Nil(t, err)
+		}
+	}()
+	var renamed int
+	for running := true; running; renamed++ {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		for _, key := range []string{"h", "n"} {
+			err := rds.Rename([]byte(key), []byte(fmt.Sprintf("%s-%d", key, renamed)))
+			if err != nil {
+				assert.Equal(t, ErrNoSuchKey, err)
+			}
+		}
+	}
+
+	var fields uint32
+	var sum int64
+	for i := 0; i < renamed; i++ {
+		size, err := rds.HLen([]byte(fmt.Sprintf("h-%d", i)))
+		assert.Nil(t, err)
+		fields += size
+		value, err := rds.Get([]byte(fmt.Sprintf("n-%d", i)))
+		if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			continue
+		}
+		assert.Nil(t, err)
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		assert.Nil(t, err)
+		sum += n
+	}
+	assert.Equal(t, uint32(300), fields)
+	assert.Equal(t, int64(300), sum)
+}
+
+func TestRedisDataStructure_DelConcurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// DEL之前已经写入完成的field不会被并发的HSET按照旧的元数据写回来
+	var written atomic.Int64
+	written.Store(-1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			_, err := rds.HSet([]byte("h"), []byte(fmt.Sprint(i)), []byte("v"))
+			assert.Nil(t, err)
+			written.Store(int64(i))
+		}
+	}()
+	last := int64(-1)
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		last = written.Load()
+		_, err := rds.Del([]byte("h"))
+		assert.Nil(t, err)
+	}
+	for i := int64(0); i <= last; i++ {
+		value, _ := rds.HGet([]byte("h"), []byte(fmt.Sprint(i)))
+		assert.Nil(t, value)
+	}
+
+	// 同一个key只有一个DEL返回删除了key
+	var wg sync.WaitGroup
+	var deleted atomic.Int64
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		assert.Nil(t, rds.Set(key, []byte("v"), 0))
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := rds.Del(key)
+				assert.Nil(t, err)
+				if ok {
+					deleted.Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, int64(50), deleted.Load())
+}
+
+func TestRedisDataStructure_ExpireConcurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 并发的SADD不会覆盖EXPIRE设置的过期时间
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("set-%d", i))
+		_, err := rds.SAdd(key, []byte("m"))
+		assert.Nil(t, err)
+		var wg sync.WaitGroup
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(j int) {
+				defer wg.Done()
+				for k := 0; k < 20; k++ {
+					_, err := rds.SAdd(key, []byte(fmt.Sprintf("%d-%d", j, k)))
+					assert.Nil(t, err)
+				}
+			}(j)
+		}
+		ok, err := rds.Expire(key, time.Hour)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		wg.Wait()
+		ttl, err := rds.TTL(key)
+		assert.Nil(t, err)
+		assert.True(t, ttl > 59*time.Minute)
+	}
+}
+
+func TestRedisDataStructure_DumpExpireAt(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	assert.Nil(t, rds.Set([]byte("ttl"), []byte("v"), time.Hour))
+	assert.Nil(t, rds.Set([]byte("short"), []byte("v"), 10*time.Millisecond))
+	assert.Nil(t, rds.Set([]byte("plain"), []byte("v"), 0))
+	_, err := rds.HSet([]byte("hash"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	_, err = rds.Expire([]byte("hash"), time.Hour)
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	// 过期时间随元数据一起导出，已经过期的key不会导入
+	buf := new(bytes.Buffer)
+	_, err = rds.db.Export(buf, tiny_kvDB.ExportOptions{ExpireAt: DumpExpireAt})
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `"expire_at":`)
+
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-import")
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	opts.DirPath = dir
+	db, err := tiny_kvDB.Open(opts)
+	assert.Nil(t, err)
+	_, err = db.Import(buf)
+	assert.Nil(t, err)
+	_, err = db.Get(metaKey([]byte("short")))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+	assert.Nil(t, db.Close())
+
+	// 导入后过期时间不变
+	imported, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = imported.Close()
+	}()
+	for _, key := range []string{"ttl", "hash"} {
+		ttl, err := imported.TTL([]byte(key))
+		assert.Nil(t, err)
+		assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+	}
+	ttl, err := imported.TTL([]byte("plain"))
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpire, ttl)
+	value, err := imported.HGet([]byte("hash"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+}
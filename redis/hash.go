@@ -0,0 +1,232 @@
+package redis
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	tiny_kvDB "tiny-kvDB"
+)
+
+// FieldValue hash中的一个field和它的value
+type FieldValue struct {
+	Field []byte
+	Value []byte
+}
+
+// HLen 返回hash中field的数量，key不存在时返回0
+func (rds *RedisDataStructure) HLen(key []byte) (uint32, error) {
+	meta, err := rds.findMetaData(key, Hash)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// HExists 判断field是否存在
+func (rds *RedisDataStructure) HExists(key, field []byte) (bool, error) {
+	meta, err := rds.findMetaData(key, Hash)
+	if err != nil {
+		return false, err
+	}
+	if meta.size == 0 {
+		return false, nil
+	}
+	hk := &hashInternalKey{key: key, version: meta.version, field: field}
+	_, err = rds.db.Get(hk.encode())
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// HGetAll 按field的顺序返回所有的field和value
+func (rds *RedisDataStructure) HGetAll(key []byte) ([]FieldValue, error) {
+	fields := []FieldValue{}
+	err := rds.hScan(key, true, func(fv FieldValue) bool {
+		fields = append(fields, fv)
+		return true
+	})
+	return fields, err
+}
+
+// HKeys 按顺序返回所有的field
+func (rds *RedisDataStructure) HKeys(key []byte) ([][]byte, error) {
+	keys := [][]byte{}
+	err := rds.hScan(key, false, func(fv FieldValue) bool {
+		keys = append(keys, fv.Field)
+		return true
+	})
+	return keys, err
+}
+
+// HVals 按field的顺序返回所有的value
+func (rds *RedisDataStructure) HVals(key []byte) ([][]byte, error) {
+	values := [][]byte{}
+	err := rds.hScan(key, true, func(fv FieldValue) bool {
+		values = append(values, fv.Value)
+		return true
+	})
+	return values, err
+}
+
+// HMSet 在一个WriteBatch中写入多个field，返回新增的field数量
+func (rds *RedisDataStructure) HMSet(key []byte, fields []FieldValue) (int, error) {
+	rds.hashMu.Lock()
+	defer rds.hashMu.Unlock()
+	meta, err := rds.findMetaData(key, Hash)
+	if err != nil {
+		return 0, err
+	}
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return 0, err
+	}
+	var added int
+	// 同一个field出现多次时只计算一次
+	seen := make(map[string]struct{}, len(fields))
+	for _, fv := range fields {
+		hk := &hashInternalKey{key: key, version: meta.version, field: fv.Field}
+		encKey := hk.encode()
+		if _, ok := seen[string(fv.Field)]; !ok {
+			seen[string(fv.Field)] = struct{}{}
+			_, err := rds.db.Get(encKey)
+			if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+				added++
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		_ = wb.Put(encKey, fv.Value)
+	}
+	if added > 0 {
+		meta.size += uint32(added)
+		rds.putMetaData(wb, key, meta)
+	}
+	if err := wb.Commit(); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
+
+// HMGet 返回多个field的value，不存在的field对应nil
+func (rds *RedisDataStructure) HMGet(key []byte, fields [][]byte) ([][]byte, error) {
+	meta, err := rds.findMetaData(key, Hash)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(fields))
+	if meta.size == 0 {
+		return values, nil
+	}
+	for i, field := range fields {
+		hk := &hashInternalKey{key: key, version: meta.version, field: field}
+		value, err := rds.db.Get(hk.encode())
+		if err != nil && !errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// HSetNX field不存在时才写入，返回是否写入
+func (rds *RedisDataStructure) HSetNX(key, field, value []byte) (bool, error) {
+	rds.hashMu.Lock()
+	defer rds.hashMu.Unlock()
+	exist, err := rds.HExists(key, field)
+	if err != nil || exist {
+		return false, err
+	}
+	return rds.hSet(key, field, value)
+}
+
+// HIncrBy 给field的整数值加上increment，field不存在时当作0，返回新的值
+func (rds *RedisDataStructure) HIncrBy(key, field []byte, increment int64) (int64, error) {
+	rds.hashMu.Lock()
+	defer rds.hashMu.Unlock()
+	value, err := rds.hGetOrNil(key, field)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	if value != nil {
+		if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, ErrHashValueNotInteger
+		}
+	}
+	if (increment > 0 && n > math.MaxInt64-increment) || (increment < 0 && n < math.MinInt64-increment) {
+		return 0, ErrIncrOverflow
+	}
+	n += increment
+	if _, err := rds.hSet(key, field, []byte(strconv.FormatInt(n, 10))); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// HIncrByFloat 给field的浮点数值加上increment，field不存在时当作0，返回新的值
+func (rds *RedisDataStructure) HIncrByFloat(key, field []byte, increment float64) (float64, error) {
+	rds.hashMu.Lock()
+	defer rds.hashMu.Unlock()
+	value, err := rds.hGetOrNil(key, field)
+	if err != nil {
+		return 0, err
+	}
+	var f float64
+	if value != nil {
+		if f, err = strconv.ParseFloat(string(value), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, ErrHashValueNotFloat
+		}
+	}
+	f += increment
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrIncrNaNOrInfinity
+	}
+	if _, err := rds.hSet(key, field, []byte(strconv.FormatFloat(f, 'f', -1, 64))); err != nil {
+		return 0, err
+	}
+	return f, nil
+}
+
+// HScan 从cursor开始检查最多count个field，返回其中匹配match的field和value，以及下一次调用的cursor
+// 游标的含义见scanCursor
+func (rds *RedisDataStructure) HScan(key []byte, cursor uint64, match []byte, count int) (uint64, []FieldValue, error) {
+	return scanCursor(cursor, match, count, func(fn func([]byte, FieldValue) bool) error {
+		return rds.hScan(key, true, func(fv FieldValue) bool {
+			return fn(fv.Field, fv)
+		})
+	})
+}
+
+// hGetOrNil field不存在时返回nil, nil
+func (rds *RedisDataStructure) hGetOrNil(key, field []byte) ([]byte, error) {
+	value, err := rds.HGet(key, field)
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// hScan 按field的顺序遍历hash，withValue为false时不读取value，fn返回false时停止遍历
+func (rds *RedisDataStructure) hScan(key []byte, withValue bool, fn func(FieldValue) bool) error {
+	meta, err := rds.findMetaData(key, Hash)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return nil
+	}
+	hk := &hashInternalKey{key: key, version: meta.version}
+	prefix := hk.prefix()
+	return rds.scanPrefix(prefix, func(iter *tiny_kvDB.Iterator) (bool, error) {
+		fv := FieldValue{Field: append([]byte(nil), iter.Key()[len(prefix):]...)}
+		if withValue {
+			value, err := iter.Value()
+			if err != nil {
+				return false, err
+			}
+			fv.Value = value
+		}
+		return fn(fv), nil
+	})
+}
@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"testing"
+	tiny_kvDB "tiny-kvDB"
+)
+
+func TestHash_GetAll(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hash")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	key := []byte("user:1")
+	added, err := rds.HMSet(key, []FieldValue{
+		{Field: []byte("name"), Value: []byte("tom")},
+		{Field: []byte("age"), Value: []byte("18")},
+		{Field: []byte("city"), Value: []byte("beijing")},
+		{Field: []byte("age"), Value: []byte("19")},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, added)
+	// 其他hash的数据不能出现在结果中
+	_, err = rds.HSet([]byte("user:10"), []byte("name"), []byte("jerry"))
+	assert.Nil(t, err)
+
+	size, err := rds.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+
+	fields, err := rds.HGetAll(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []FieldValue{
+		{Field: []byte("age"), Value: []byte("19")},
+		{Field: []byte("city"), Value: []byte("beijing")},
+		{Field: []byte("name"), Value: []byte("tom")},
+	}, fields)
+	keys, err := rds.HKeys(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("age"), []byte("city"), []byte("name")}, keys)
+	values, err := rds.HVals(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("19"), []byte("beijing"), []byte("tom")}, values)
+
+	values, err = rds.HMGet(key, [][]byte{[]byte("name"), []byte("none")})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("tom"), nil}, values)
+
+	ok, err := rds.HExists(key, []byte("city"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.HExists(key, []byte("none"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = rds.HSetNX(key, []byte("name"), []byte("jerry"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.HSetNX(key, []byte("email"), []byte("tom@example.com"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 删除之后不再出现
+	ok, err = rds.HDel(key, []byte("city"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	keys, err = rds.HKeys(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("age"), []byte("email"), []byte("name")}, keys)
+
+	// 不存在的key
+	fields, err = rds.HGetAll([]byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(fields))
+	_, err = rds.HGetAll([]byte("user:1:none"))
+	assert.Nil(t, err)
+	assert.Nil(t, rds.Set([]byte("str"), []byte("v"), 0))
+	_, err = rds.HGetAll([]byte("str"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestHash_IncrBy(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hash")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	key := []byte("counter")
+	n, err := rds.HIncrBy(key, []byte("visits"), 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = rds.HIncrBy(key, []byte("visits"), -7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-2), n)
+	value, err := rds.HGet(key, []byte("visits"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("-2"), value)
+
+	_, err = rds.HSet(key, []byte("name"), []byte("tom"))
+	assert.Nil(t, err)
+	_, err = rds.HIncrBy(key, []byte("name"), 1)
+	assert.Equal(t, ErrHashValueNotInteger, err)
+	_, err = rds.HSet(key, []byte("max"), []byte("9223372036854775807"))
+	assert.Nil(t, err)
+	_, err = rds.HIncrBy(key, []byte("max"), 1)
+	assert.Equal(t, ErrIncrOverflow, err)
+
+	f, err := rds.HIncrByFloat(key, []byte("price"), 10.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.5, f)
+	f, err = rds.HIncrByFloat(key, []byte("visits"), 0.25)
+	assert.Nil(t, err)
+	assert.Equal(t, -1.75, f)
+	_, err = rds.HIncrByFloat(key, []byte("name"), 1)
+	assert.Equal(t, ErrHashValueNotFloat, err)
+}
+
+func TestHash_Scan(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hash")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	key := []byte("profile")
+	for i := 0; i < 25; i++ {
+		_, err := rds.HSet(key, []byte(fmt.Sprintf("field-%02d", i)), []byte("v"))
+		assert.Nil(t, err)
+	}
+
+	// 分多次遍历得到所有的field
+	var (
+		cursor uint64
+		all    []FieldValue
+		calls  int
+	)
+	for {
+		next, fields, err := rds.HScan(key, cursor, nil, 10)
+		assert.Nil(t, err)
+		all = append(all, fields...)
+		calls++
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 25, len(all))
+	assert.Equal(t, 3, calls)
+
+	// MATCH过滤结果，COUNT仍然按检查的field数量计算
+	next, fields, err := rds.HScan(key, 0, []byte("field-1?"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.Equal(t, 10, len(fields))
+	next, fields, err = rds.HScan(key, 0, []byte("field-2*"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), next)
+	assert.Equal(t, 0, len(fields))
+}
+
+func TestHash_Concurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 并发的HINCRBY、HSETNX和新增field都不会丢失更新
+	var wg sync.WaitGroup
+	var setNX sync.Map
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := rds.HIncrBy([]byte("h"), []byte("counter"), 1)
+				assert.Nil(t, err)
+				_, err = rds.HIncrByFloat([]byte("h"), []byte("float"), 0.5)
+				assert.Nil(t, err)
+				_, err = rds.HSet([]byte("h"), []byte(fmt.Sprintf("f-%d-%d", i, j)), []byte("v"))
+				assert.Nil(t, err)
+				ok, err := rds.HSetNX([]byte("h"), []byte(fmt.Sprintf("nx-%d", j)), []byte(fmt.Sprint(i)))
+				assert.Nil(t, err)
+				if ok {
+					_, loaded := setNX.LoadOrStore(j, i)
+					assert.False(t, loaded)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	value, err := rds.HGet([]byte("h"), []byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("800"), value)
+	value, err = rds.HGet([]byte("h"), []byte("float"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("400"), value)
+	size, err := rds.HLen([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2+800+100), size)
+	fields, err := rds.HKeys([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2+800+100, len(fields))
+}
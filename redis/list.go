@@ -0,0 +1,346 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	tiny_kvDB "tiny-kvDB"
+)
+
+var (
+	ErrNoSuchKey       = errors.New("no such key")
+	ErrIndexOutOfRange = errors.New("index out of range")
+)
+
+/*
+	列表的元素连续存放在[head, tail)这些下标中，第i个元素的下标是head+i
+	所以按下标读取元素不需要遍历，插入和删除中间的元素时把较短的一侧整体移动一位
+*/
+
+// LLen 返回列表的长度，key不存在时返回0
+func (rds *RedisDataStructure) LLen(key []byte) (uint32, error) {
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// LIndex 返回下标为index的元素，负数下标从末尾开始计算，超出范围时返回nil
+func (rds *RedisDataStructure) LIndex(key []byte, index int64) ([]byte, error) {
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := normalizeListIndex(meta, index)
+	if !ok {
+		return nil, nil
+	}
+	return rds.lGet(key, meta, i)
+}
+
+// LRange 返回下标在[start, stop]之间的元素，负数下标从末尾开始计算
+func (rds *RedisDataStructure) LRange(key []byte, start, stop int64) ([][]byte, error) {
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return nil, err
+	}
+	start, stop = clampListRange(meta, start, stop)
+	if start > stop {
+		return [][]byte{}, nil
+	}
+	return rds.lGetRange(key, meta, uint64(start), uint64(stop)+1)
+}
+
+// LSet 修改下标为index的元素
+func (rds *RedisDataStructure) LSet(key []byte, index int64, element []byte) error {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return ErrNoSuchKey
+	}
+	i, ok := normalizeListIndex(meta, index)
+	if !ok {
+		return ErrIndexOutOfRange
+	}
+	lk := &listInternalKey{key: key, version: meta.version, index: meta.head + i}
+	return rds.db.Put(lk.encode(), element)
+}
+
+// LTrim 只保留下标在[start, stop]之间的元素，其余的全部删除
+func (rds *RedisDataStructure) LTrim(key []byte, start, stop int64) error {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return nil
+	}
+	start, stop = clampListRange(meta, start, stop)
+	if start > stop {
+		// 全部删除
+		start, stop = 0, -1
+	}
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return err
+	}
+	lk := &listInternalKey{key: key, version: meta.version}
+	newHead, newTail := meta.head+uint64(start), meta.head+uint64(stop+1)
+	for lk.index = meta.head; lk.index < newHead; lk.index++ {
+		_ = wb.Delete(lk.encode())
+	}
+	for lk.index = newTail; lk.index < meta.tail; lk.index++ {
+		_ = wb.Delete(lk.encode())
+	}
+	meta.head, meta.tail = newHead, newTail
+	meta.size = uint32(newTail - newHead)
+	rds.putMetaData(wb, key, meta)
+	return wb.Commit()
+}
+
+// LRem 删除和element相等的元素，count大于0时从头开始删除count个，小于0时从尾开始删除-count个，等于0时全部删除
+// 返回删除的数量
+func (rds *RedisDataStructure) LRem(key []byte, count int64, element []byte) (int, error) {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, nil
+	}
+	elements, err := rds.lGetRange(key, meta, 0, uint64(meta.size))
+	if err != nil {
+		return 0, err
+	}
+
+	// 标记要删除的元素
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := make([]bool, len(elements))
+	var n int
+	for k := 0; k < len(elements); k++ {
+		i := k
+		if count < 0 {
+			i = len(elements) - 1 - k
+		}
+		if bytes.Equal(elements[i], element) {
+			removed[i] = true
+			n++
+			if limit > 0 && int64(n) == limit {
+				break
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	// 剩下的元素从head开始重新连续编号，位置没有变化的元素不需要重写
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return 0, err
+	}
+	lk := &listInternalKey{key: key, version: meta.version, index: meta.head}
+	var shifted bool
+	for i, e := range elements {
+		if removed[i] {
+			shifted = true
+			continue
+		}
+		if shifted {
+			_ = wb.Put(lk.encode(), e)
+		}
+		lk.index++
+	}
+	newTail := lk.index
+	for ; lk.index < meta.tail; lk.index++ {
+		_ = wb.Delete(lk.encode())
+	}
+	meta.tail = newTail
+	meta.size -= uint32(n)
+	rds.putMetaData(wb, key, meta)
+	if err := wb.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// LInsert 在第一个和pivot相等的元素之前（before为true）或者之后插入element
+// 返回插入后列表的长度，key不存在时返回0，找不到pivot时返回-1
+// 插入位置之前的元素较少时把它们向head方向移动一位，否则把之后的元素向tail方向移动一位
+func (rds *RedisDataStructure) LInsert(key []byte, before bool, pivot, element []byte) (int64, error) {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
+	meta, err := rds.findMetaData(key, List)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, nil
+	}
+	elements, err := rds.lGetRange(key, meta, 0, uint64(meta.size))
+	if err != nil {
+		return 0, err
+	}
+	pos := -1
+	for i, e := range elements {
+		if bytes.Equal(e, pivot) {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return -1, nil
+	}
+	// element插入之后的位置
+	if !before {
+		pos++
+	}
+
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return 0, err
+	}
+	lk := &listInternalKey{key: key, version: meta.version}
+	if pos <= len(elements)/2 {
+		for i := 0; i < pos; i++ {
+			lk.index = meta.head + uint64(i) - 1
+			_ = wb.Put(lk.encode(), elements[i])
+		}
+		meta.head--
+	} else {
+		for i := pos; i < len(elements); i++ {
+			lk.index = meta.head + uint64(i) + 1
+			_ = wb.Put(lk.encode(), elements[i])
+		}
+		meta.tail++
+	}
+	lk.index = meta.head + uint64(pos)
+	_ = wb.Put(lk.encode(), element)
+	meta.size++
+	rds.putMetaData(wb, key, meta)
+	if err := wb.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(meta.size), nil
+}
+
+// LMove 从source的头部（fromLeft为true）或尾部取出一个元素，放到destination的头部（toLeft为true）或尾部
+// 返回移动的元素，source为空时返回nil，source和destination可以相同
+func (rds *RedisDataStructure) LMove(source, destination []byte, fromLeft, toLeft bool) ([]byte, error) {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
+	srcMeta, err := rds.findMetaData(source, List)
+	if err != nil {
+		return nil, err
+	}
+	// 先检查destination的类型，避免取出元素之后无法放入
+	dstMeta := srcMeta
+	if !bytes.Equal(source, destination) {
+		if dstMeta, err = rds.findMetaData(destination, List); err != nil {
+			return nil, err
+		}
+	}
+	if srcMeta.size == 0 {
+		return nil, nil
+	}
+
+	lk := &listInternalKey{key: source, version: srcMeta.version, index: srcMeta.head}
+	if !fromLeft {
+		lk.index = srcMeta.tail - 1
+	}
+	element, err := rds.db.Get(lk.encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// 取出和放入在同一个批次中提交，同一个列表时后面的Put会覆盖前面的Delete
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return nil, err
+	}
+	_ = wb.Delete(lk.encode())
+	if fromLeft {
+		srcMeta.head++
+	} else {
+		srcMeta.tail--
+	}
+	srcMeta.size--
+
+	dk := &listInternalKey{key: destination, version: dstMeta.version}
+	if toLeft {
+		dstMeta.head--
+		dk.index = dstMeta.head
+	} else {
+		dk.index = dstMeta.tail
+		dstMeta.tail++
+	}
+	dstMeta.size++
+	_ = wb.Put(dk.encode(), element)
+	rds.putMetaData(wb, source, srcMeta)
+	rds.putMetaData(wb, destination, dstMeta)
+	if err := wb.Commit(); err != nil {
+		return nil, err
+	}
+	rds.waiters.notify(destination)
+	return element, nil
+}
+
+// lGet 读取第i个元素
+func (rds *RedisDataStructure) lGet(key []byte, meta *metadata, i uint64) ([]byte, error) {
+	lk := &listInternalKey{key: key, version: meta.version, index: meta.head + i}
+	return rds.db.Get(lk.encode())
+}
+
+// lGetRange 读取[from, to)之间的元素
+func (rds *RedisDataStructure) lGetRange(key []byte, meta *metadata, from, to uint64) ([][]byte, error) {
+	elements := make([][]byte, 0, to-from)
+	for i := from; i < to; i++ {
+		element, err := rds.lGet(key, meta, i)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// normalizeListIndex 把可能为负数的下标转换成从head开始的偏移，超出范围时返回false
+func normalizeListIndex(meta *metadata, index int64) (uint64, bool) {
+	size := int64(meta.size)
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return 0, false
+	}
+	return uint64(index), true
+}
+
+// clampListRange 把[start, stop]转换成非负下标并限制在列表范围内，start > stop表示范围为空
+func clampListRange(meta *metadata, start, stop int64) (int64, int64) {
+	size := int64(meta.size)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	return start, stop
+}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	tiny_kvDB "tiny-kvDB"
+)
+
+func listElements(elements ...string) [][]byte {
+	res := make([][]byte, 0, len(elements))
+	for _, e := range elements {
+		res = append(res, []byte(e))
+	}
+	return res
+}
+
+func TestList_Range(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-list")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	key := []byte("queue")
+	size, err := rds.RPush(key, listElements("c", "d", "e")...)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+	size, err = rds.LPush(key, listElements("b", "a")...)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), size)
+
+	elements, err := rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "b", "c", "d", "e"), elements)
+	elements, err = rds.LRange(key, -2, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("d", "e"), elements)
+	elements, err = rds.LRange(key, 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(elements))
+
+	element, err := rds.LIndex(key, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("e"), element)
+	element, err = rds.LIndex(key, 5)
+	assert.Nil(t, err)
+	assert.Nil(t, element)
+
+	assert.Nil(t, rds.LSet(key, 1, []byte("B")))
+	assert.Equal(t, ErrIndexOutOfRange, rds.LSet(key, 10, []byte("x")))
+	assert.Equal(t, ErrNoSuchKey, rds.LSet([]byte("none"), 0, []byte("x")))
+
+	assert.Nil(t, rds.LTrim(key, 1, -2))
+	elements, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("B", "c", "d"), elements)
+	size, err = rds.LLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+
+	// push和pop在trim之后仍然正常
+	_, err = rds.LPush(key, []byte("a"))
+	assert.Nil(t, err)
+	element, err = rds.RPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("d"), element)
+	elements, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "B", "c"), elements)
+
+	assert.Nil(t, rds.LTrim(key, 5, 10))
+	size, err = rds.LLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), size)
+	_, err = rds.Type(key)
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+}
+
+func TestList_RemInsert(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-list")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	key := []byte("list")
+	_, err = rds.RPush(key, listElements("x", "a", "x", "b", "x", "c", "x")...)
+	assert.Nil(t, err)
+
+	n, err := rds.LRem(key, 2, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	elements, err := rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "b", "x", "c", "x"), elements)
+
+	n, err = rds.LRem(key, -1, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	elements, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "b", "x", "c"), elements)
+
+	n, err = rds.LRem(key, 0, []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// 靠近头部插入时移动前面的元素，靠近尾部时移动后面的元素
+	size, err := rds.LInsert(key, true, []byte("b"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), size)
+	size, err = rds.LInsert(key, false, []byte("x"), []byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), size)
+	size, err = rds.LInsert(key, true, []byte("a"), []byte("0"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), size)
+	size, err = rds.LInsert(key, false, []byte("c"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), size)
+	size, err = rds.LInsert(key, false, []byte("none"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), size)
+	size, err = rds.LInsert([]byte("none"), false, []byte("a"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), size)
+
+	elements, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("0", "a", "1", "b", "x", "2", "c", "3"), elements)
+	element, err := rds.LPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("0"), element)
+	element, err = rds.RPop(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("3"), element)
+
+	n, err = rds.LRem(key, 0, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	elements, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("1", "b", "x", "2", "c"), elements)
+}
@@ -20,6 +20,7 @@ type metadata struct {
 	size     uint32 // 数据量 5B
 	head     uint64 // List专用
 	tail     uint64 // List专用
+	isNew    bool   // 新创建的版本，第一次写入时需要登记到注册表，不参与编码
 }
 
 // 对元数据编码
@@ -68,25 +69,90 @@ func decodeMetaData(buf []byte) *metadata {
 	}
 }
 
+/*
+	key的编排
+	每个key的第一个字节是tag，不同tag的key互不重叠：
+	  tagMetaData                     tag+key                                string的值、数据结构的元数据
+	  tagVersionRegistry              tag+keylen(4B)+key+version(8B)         版本注册表，value是数据类型
+	  tagHash/tagSet/tagList/tagZSet  tag+keylen(4B)+key+version(8B)+...     数据结构的内部key
+	keylen和version都是大端序，key带着长度，所以一个数据结构的内部key前缀不会是另一个key的内部key前缀，
+	同一个数据结构的内部key按照后缀的字节序连续排列
+*/
+
+const (
+	tagSystem          byte = iota // 数据库自身的信息
+	tagMetaData                    // string的值和数据结构的元数据
+	tagVersionRegistry             // 版本注册表
+	tagHash                        // hash的field
+	tagSet                         // 集合的member
+	tagList                        // 列表的元素
+	tagZSet                        // 有序集合的member和score
+)
+
+// keyLayoutKey 记录key编排的版本，和当前版本不一致的数据目录需要先迁移
+var keyLayoutKey = []byte{tagSystem, 'l', 'a', 'y', 'o', 'u', 't'}
+
+// currentKeyLayout 当前key编排的版本，没有tag的旧编排是版本1
+// 版本1中有序集合的score有字符串和8字节两种编码，当前版本只有8字节编码，
+// 所以打开数据目录时必须先检查编排版本，旧数据迁移之后才能读取，见checkKeyLayout
+const currentKeyLayout byte = 2
+
+// metaKey 用户key对应的元数据key tag+key
+func metaKey(key []byte) []byte {
+	buf := make([]byte, 1+len(key))
+	buf[0] = tagMetaData
+	copy(buf[1:], key)
+	return buf
+}
+
+// internalKeyTag 数据类型的内部key使用的tag
+func internalKeyTag(dataType redisDataType) byte {
+	return tagHash + dataType - Hash
+}
+
+// versionedKey 编码 tag+keylen+key+version，extra是调用方还要追加的长度
+func versionedKey(tag byte, key []byte, version int64, extra int) []byte {
+	buf := make([]byte, 1+4+len(key)+8, 1+4+len(key)+8+extra)
+	buf[0] = tag
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(key)))
+	copy(buf[5:], key)
+	binary.BigEndian.PutUint64(buf[5+len(key):], uint64(version))
+	return buf
+}
+
+// decodeVersionedKey 从versionedKey编码的key中解析出key、version和后缀
+func decodeVersionedKey(buf []byte) ([]byte, int64, []byte) {
+	keyLen := int(binary.BigEndian.Uint32(buf[1:]))
+	key := buf[5 : 5+keyLen]
+	version := int64(binary.BigEndian.Uint64(buf[5+keyLen:]))
+	return key, version, buf[5+keyLen+8:]
+}
+
+// versionRegistryKey 版本注册表的key，每个数据结构创建的version都会登记，回收失效版本的内部key时使用
+func versionRegistryKey(key []byte, version int64) []byte {
+	return versionedKey(tagVersionRegistry, key, version, 0)
+}
+
+// internalKeyPrefix 数据结构的一个version下所有内部key的公共前缀
+func internalKeyPrefix(dataType redisDataType, key []byte, version int64) []byte {
+	return versionedKey(internalKeyTag(dataType), key, version, 0)
+}
+
 type hashInternalKey struct {
 	key     []byte
 	version int64
 	field   []byte
 }
 
-// 编码hash查找field的key=<key+version+field>
+// 编码hash查找field的key=<prefix+field>
 func (hk *hashInternalKey) encode() []byte {
-	buf := make([]byte, len(hk.key)+len(hk.field)+8) // version是固定长度
-	var index = 0
-	// 放key
-	copy(buf[index:index+len(hk.key)], hk.key[:])
-	index += len(hk.key)
-	// 放version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(hk.version))
-	index += 8
-	copy(buf[index:index+len(hk.field)], hk.field[:])
-	index += len(hk.field)
-	return buf
+	buf := versionedKey(tagHash, hk.key, hk.version, len(hk.field))
+	return append(buf, hk.field...)
+}
+
+// prefix 同一个hash所有field的公共前缀
+func (hk *hashInternalKey) prefix() []byte {
+	return versionedKey(tagHash, hk.key, hk.version, 0)
 }
 
 type setInternalKey struct {
@@ -95,24 +161,15 @@ type setInternalKey struct {
 	member  []byte
 }
 
+// 编码集合的member=<prefix+member>
 func (sk *setInternalKey) encode() []byte {
-	buf := make([]byte, len(sk.key)+len(sk.member)+8+4) // 还要额外四个字节存储member的长度
-	var index = 0
-	// key
-	copy(buf[index:index+len(sk.key)], sk.key)
-	index += len(sk.key)
-
-	// version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(sk.version))
-	index += 8
-
-	//member
-	copy(buf[index:index+len(sk.member)], sk.member)
-	index += len(sk.member)
-
-	// member size
-	binary.LittleEndian.PutUint32(buf[index:], uint32(len(sk.member)))
-	return buf
+	buf := versionedKey(tagSet, sk.key, sk.version, len(sk.member))
+	return append(buf, sk.member...)
+}
+
+// prefix 同一个集合所有member的公共前缀
+func (sk *setInternalKey) prefix() []byte {
+	return versionedKey(tagSet, sk.key, sk.version, 0)
 }
 
 type listInternalKey struct {
@@ -121,24 +178,18 @@ type listInternalKey struct {
 	index   uint64
 }
 
+// 编码列表的元素=<prefix+index>，index是大端序，同一个列表的元素按照下标排列
 func (lk *listInternalKey) encode() []byte {
-	buf := make([]byte, len(lk.key)+8+8)
-	var index = 0
-
-	// key
-	copy(buf[index:index+len(lk.key)], lk.key)
-	index += len(lk.key)
-
-	// version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(lk.version))
-	index += 8
-
-	// index
-	binary.LittleEndian.PutUint64(buf[index:], lk.index)
-
-	return buf
+	buf := versionedKey(tagList, lk.key, lk.version, 8)
+	return binary.BigEndian.AppendUint64(buf, lk.index)
 }
 
+// 有序集合的两种内部key在前缀之后用一个字节区分，避免按score遍历时读到按member查找的key
+const (
+	zSetMemberMark byte = iota
+	zSetScoreMark
+)
+
 type zSetInternalKey struct {
 	key     []byte
 	version int64
@@ -147,47 +198,37 @@ type zSetInternalKey struct {
 }
 
 func (zk *zSetInternalKey) encodeWithMember() []byte {
-	// key+version+member
-	buf := make([]byte, len(zk.key)+8+len(zk.member))
-
-	// key
-	index := 0
-	copy(buf[index:index+len(zk.key)], zk.key)
-	index += len(zk.key)
-
-	// version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(zk.version))
-	index += 8
-
-	// member
-	copy(buf[index:index+len(zk.member)], zk.member)
-	return buf
+	// prefix+mark+member
+	buf := versionedKey(tagZSet, zk.key, zk.version, 1+len(zk.member))
+	buf = append(buf, zSetMemberMark)
+	return append(buf, zk.member...)
 }
 
 func (zk *zSetInternalKey) encodeWithScore() []byte {
-	scoreBuf := utils.Float64ToBytes(zk.score)
-	// key+version+score+member+member_size
+	// prefix+mark+score+member
 	// 用于根据score的分数范围，查找对应的member
-	buf := make([]byte, len(zk.key)+8+len(scoreBuf)+len(zk.member)+4)
-
-	// key
-	index := 0
-	copy(buf[index:index+len(zk.key)], zk.key)
-	index += len(zk.key)
-
-	// version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(zk.version))
-	index += 8
+	// score固定8字节，并且字节序和分数大小一致，所以同一个有序集合的key按照score、member的顺序排列
+	buf := zk.scorePrefix()
+	buf = append(buf, utils.Float64ToBytes(zk.score)...)
+	return append(buf, zk.member...)
+}
 
-	// score
-	copy(buf[index:index+len(scoreBuf)], scoreBuf)
-	index += len(scoreBuf)
+// scorePrefix 同一个有序集合所有按score排列的key的公共前缀 prefix+mark
+func (zk *zSetInternalKey) scorePrefix() []byte {
+	buf := versionedKey(tagZSet, zk.key, zk.version, 1+8+len(zk.member))
+	return append(buf, zSetScoreMark)
+}
 
-	// member
-	copy(buf[index:index+len(zk.member)], zk.member)
-	index += len(zk.member)
+// decodeScore 解码按member查找的key对应的score，长度不是8字节的value不是当前编排写入的
+func decodeScore(value []byte) (float64, error) {
+	if len(value) != 8 {
+		return 0, ErrInvalidScoreEncoding
+	}
+	return utils.FloatFromBytes(value), nil
+}
 
-	// member_size
-	binary.LittleEndian.PutUint32(buf[index:], uint32(len(zk.member)))
-	return buf
+// decodeZSetScoreKey 从encodeWithScore编码的key中解析出score和member，prefixLen是scorePrefix的长度
+func decodeZSetScoreKey(buf []byte, prefixLen int) (float64, []byte) {
+	score := utils.FloatFromBytes(buf[prefixLen : prefixLen+8])
+	return score, buf[prefixLen+8:]
 }
@@ -0,0 +1,26 @@
+package redis
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestMetaData_EncodeDecode(t *testing.T) {
+	list := &metadata{
+		dataType: List,
+		expire:   1700000000000000000,
+		version:  1600000000000000000,
+		size:     3,
+		head:     initialListMark - 1,
+		tail:     initialListMark + 2,
+	}
+	assert.Equal(t, list, decodeMetaData(list.encode()))
+
+	hash := &metadata{
+		dataType: Hash,
+		version:  1600000000000000000,
+		size:     math.MaxUint32,
+	}
+	assert.Equal(t, hash, decodeMetaData(hash.encode()))
+}
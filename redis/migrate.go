@@ -0,0 +1,344 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	tiny_kvDB "tiny-kvDB"
+	"tiny-kvDB/utils"
+)
+
+var (
+	ErrLegacyKeyLayout       = errors.New("the data directory uses the legacy key layout, migrate it with rdsmigrate first")
+	ErrUnknownKeyLayout      = errors.New("the data directory uses an unknown key layout")
+	ErrAlreadyMigrated       = errors.New("the data directory already uses the current key layout")
+	ErrMigrateTargetNotEmpty = errors.New("the migration target directory is not empty")
+	ErrLegacyZSetEntry       = errors.New("the legacy sorted set has internal keys matching neither score encoding")
+)
+
+// checkKeyLayout 检查数据目录的key编排，空的数据目录直接写入当前版本
+func checkKeyLayout(db *tiny_kvDB.DB) error {
+	layout, err := db.Get(keyLayoutKey)
+	if err == nil {
+		if !bytes.Equal(layout, []byte{currentKeyLayout}) {
+			return ErrUnknownKeyLayout
+		}
+		return nil
+	}
+	if !errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return err
+	}
+	empty, err := isEmptyDB(db)
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return ErrLegacyKeyLayout
+	}
+	return db.Put(keyLayoutKey, []byte{currentKeyLayout})
+}
+
+func isEmptyDB(db *tiny_kvDB.DB) (bool, error) {
+	iter, err := db.NewIterator(tiny_kvDB.DefaultIteratorOptions)
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+	iter.Rewind()
+	return !iter.Valid(), nil
+}
+
+/*
+	旧的key编排（版本1）没有tag：
+	  string的值、元数据     key
+	  hash                  key+version(8B小端)+field
+	  集合                   key+version+member+member_size(4B小端)
+	  列表                   key+version+index(8B小端)
+	  有序集合               最初的版本score是字符串：key+version+member 和 key+version+score+member+member_size(4B小端)
+	                        之后score改成8字节：key+version+0x00+member 和 key+version+0x01+score+member
+	  版本注册表             "\x00rds-version\x00"+key+version
+	不同key的内部key可能互相重叠，所以迁移时按照旧的方式识别用户key，只迁移仍然有效的数据，
+	失效版本的内部key和版本注册表都会被丢弃，注册表在迁移时重新生成
+*/
+
+var legacyRegistryPrefix = []byte("\x00rds-version\x00")
+
+// MigrateLegacyLayout 把旧编排的数据目录src迁移到新的空数据目录dst，返回迁移的用户key数量
+// 全部写完之后才在dst中写入编排版本，迁移中途失败的dst无法打开，清空之后重新迁移即可
+func MigrateLegacyLayout(src, dst *tiny_kvDB.DB) (int, error) {
+	if _, err := src.Get(keyLayoutKey); err == nil {
+		return 0, ErrAlreadyMigrated
+	}
+	empty, err := isEmptyDB(dst)
+	if err != nil {
+		return 0, err
+	}
+	if !empty {
+		return 0, ErrMigrateTargetNotEmpty
+	}
+	w := &migrateWriter{db: dst}
+	var count int
+	err = walkLegacyKeys(src, func(key, encValue []byte) error {
+		count++
+		if encValue[0] == String {
+			return w.put(metaKey(key), encValue)
+		}
+		meta := decodeMetaData(encValue)
+		if err := migrateLegacyElements(src, w, key, meta); err != nil {
+			return err
+		}
+		if err := w.put(versionRegistryKey(key, meta.version), []byte{meta.dataType}); err != nil {
+			return err
+		}
+		return w.put(metaKey(key), encValue)
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := w.flush(); err != nil {
+		return count, err
+	}
+	return count, dst.Put(keyLayoutKey, []byte{currentKeyLayout})
+}
+
+// walkLegacyKeys 按顺序遍历旧编排中所有仍然有效的string和数据结构
+// 内部key都以元数据的key+version开头，排在元数据之后，并且同一个前缀的内部key是连续的，
+// 所以遍历时记住遇到过的数据结构的前缀，以这些前缀开头的key就是内部key
+func walkLegacyKeys(db *tiny_kvDB.DB, fn func(key, encValue []byte) error) error {
+	iter, err := db.NewIterator(tiny_kvDB.DefaultIteratorOptions)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	var prefixes [][]byte
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		key := iter.Key()
+		if bytes.HasPrefix(key, legacyRegistryPrefix) {
+			continue
+		}
+		// 去掉已经遍历完的前缀，还没有遍历到的前缀保留
+		internal := false
+		pending := prefixes[:0]
+		for _, prefix := range prefixes {
+			if bytes.HasPrefix(key, prefix) {
+				internal = true
+			} else if bytes.Compare(key, prefix) > 0 {
+				continue
+			}
+			pending = append(pending, prefix)
+		}
+		prefixes = pending
+		if internal {
+			continue
+		}
+
+		encValue, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		if len(encValue) == 0 || encValue[0] > ZSet {
+			continue
+		}
+		if encValue[0] != String {
+			// 已经过期的数据结构的内部key也要跳过
+			prefixes = append(prefixes, legacyInternalKeyPrefix(key, decodeMetaData(encValue).version))
+		}
+		if !isLiveValue(encValue) {
+			continue
+		}
+		if err := fn(append([]byte(nil), key...), encValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func legacyInternalKeyPrefix(key []byte, version int64) []byte {
+	buf := make([]byte, len(key)+8)
+	copy(buf, key)
+	binary.LittleEndian.PutUint64(buf[len(key):], uint64(version))
+	return buf
+}
+
+// migrateLegacyElements 把一个数据结构在旧编排中的内部key转换成新编排，version保持不变
+func migrateLegacyElements(src *tiny_kvDB.DB, w *migrateWriter, key []byte, meta *metadata) error {
+	if meta.dataType == ZSet {
+		return migrateLegacyZSet(src, w, key, meta)
+	}
+	prefix := legacyInternalKeyPrefix(key, meta.version)
+	iter, err := src.NewIterator(tiny_kvDB.DefaultIteratorOptions)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	for iter.Seek(prefix); iter.Valid() && bytes.HasPrefix(iter.Key(), prefix); iter.Next() {
+		suffix := iter.Key()[len(prefix):]
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		var newKey []byte
+		switch meta.dataType {
+		case Hash:
+			newKey = (&hashInternalKey{key: key, version: meta.version, field: suffix}).encode()
+		case Set:
+			// 长度对不上的key不是这个集合的成员
+			if len(suffix) < 4 || binary.LittleEndian.Uint32(suffix[len(suffix)-4:]) != uint32(len(suffix)-4) {
+				continue
+			}
+			newKey = (&setInternalKey{key: key, version: meta.version, member: suffix[:len(suffix)-4]}).encode()
+		case List:
+			if len(suffix) != 8 {
+				continue
+			}
+			index := binary.LittleEndian.Uint64(suffix)
+			if index < meta.head || index >= meta.tail {
+				continue
+			}
+			newKey = (&listInternalKey{key: key, version: meta.version, index: index}).encode()
+		}
+		if newKey == nil {
+			continue
+		}
+		if err := w.put(newKey, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateLegacyZSet 迁移有序集合，同一个有序集合的内部key全部读入内存之后判断score是哪一种编码
+// 两种编码都对不上的数据不能安全地丢弃，返回ErrLegacyZSetEntry
+func migrateLegacyZSet(src *tiny_kvDB.DB, w *migrateWriter, key []byte, meta *metadata) error {
+	prefix := legacyInternalKeyPrefix(key, meta.version)
+	iter, err := src.NewIterator(tiny_kvDB.DefaultIteratorOptions)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+	var entries [][2][]byte
+	for iter.Seek(prefix); iter.Valid() && bytes.HasPrefix(iter.Key(), prefix); iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, [2][]byte{iter.Key()[len(prefix):], value})
+	}
+
+	members, ok := decodeLegacyZSet(entries, meta.size, parseFloat64ZSetEntry)
+	if !ok {
+		members, ok = decodeLegacyZSet(entries, meta.size, parseStringZSetEntry)
+	}
+	if !ok {
+		return ErrLegacyZSetEntry
+	}
+	for _, zm := range members {
+		zk := &zSetInternalKey{key: key, version: meta.version, member: zm.Member, score: zm.Score}
+		if err := w.put(zk.encodeWithMember(), utils.Float64ToBytes(zm.Score)); err != nil {
+			return err
+		}
+		if err := w.put(zk.encodeWithScore(), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyZSetParser 解析有序集合的一个旧内部key，suffix是去掉key+version之后的部分
+// 返回member、score以及是否是按member查找的key，ok为false表示不符合这种编码
+type legacyZSetParser func(suffix, value []byte) (member []byte, score float64, isMember, ok bool)
+
+// decodeLegacyZSet 按parse解析所有内部key，按member查找和按score排列的key必须一一对应，
+// 并且成员数量和元数据一致，返回按member查找的key中的成员和score
+func decodeLegacyZSet(entries [][2][]byte, size uint32, parse legacyZSetParser) ([]ZMember, bool) {
+	var members, scoreKeys []ZMember
+	scores := make(map[string]float64)
+	for _, entry := range entries {
+		member, score, isMember, ok := parse(entry[0], entry[1])
+		if !ok {
+			return nil, false
+		}
+		if isMember {
+			members = append(members, ZMember{Member: member, Score: score})
+			scores[string(member)] = score
+		} else {
+			scoreKeys = append(scoreKeys, ZMember{Member: member, Score: score})
+		}
+	}
+	if len(members) != int(size) || len(scores) != len(members) || len(scoreKeys) != len(members) {
+		return nil, false
+	}
+	for _, zm := range scoreKeys {
+		score, ok := scores[string(zm.Member)]
+		if !ok || math.Float64bits(score) != math.Float64bits(zm.Score) {
+			return nil, false
+		}
+		delete(scores, string(zm.Member))
+	}
+	return members, true
+}
+
+// parseFloat64ZSetEntry 解析8字节score的编码 0x00+member -> score 和 0x01+score+member -> nil
+func parseFloat64ZSetEntry(suffix, value []byte) ([]byte, float64, bool, bool) {
+	switch {
+	case len(suffix) > 0 && suffix[0] == zSetMemberMark && len(value) == 8:
+		return suffix[1:], utils.FloatFromBytes(value), true, true
+	case len(suffix) >= 1+8 && suffix[0] == zSetScoreMark && len(value) == 0:
+		score, member := decodeZSetScoreKey(suffix, 1)
+		return member, score, false, true
+	}
+	return nil, 0, false, false
+}
+
+// parseStringZSetEntry 解析最初的字符串score编码 member -> score 和 score+member+member_size -> nil
+func parseStringZSetEntry(suffix, value []byte) ([]byte, float64, bool, bool) {
+	if len(value) > 0 {
+		score, err := strconv.ParseFloat(string(value), 64)
+		return suffix, score, true, err == nil
+	}
+	if len(suffix) < 4 {
+		return nil, 0, false, false
+	}
+	end := len(suffix) - 4
+	size := binary.LittleEndian.Uint32(suffix[end:])
+	if uint64(size) > uint64(end) {
+		return nil, 0, false, false
+	}
+	start := end - int(size)
+	score, err := strconv.ParseFloat(string(suffix[:start]), 64)
+	return suffix[start:end], score, false, err == nil
+}
+
+// migrateWriter 把迁移的数据分批写入目标数据库
+type migrateWriter struct {
+	db      *tiny_kvDB.DB
+	wb      *tiny_kvDB.WriteBatch
+	pending uint
+}
+
+func (w *migrateWriter) put(key, value []byte) error {
+	if w.wb == nil {
+		wb, err := w.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+		if err != nil {
+			return err
+		}
+		w.wb = wb
+	}
+	_ = w.wb.Put(key, value)
+	w.pending++
+	if w.pending == tiny_kvDB.DefaultWriteBatchOptions.MaxBatchNum {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *migrateWriter) flush() error {
+	if w.wb == nil {
+		return nil
+	}
+	err := w.wb.Commit()
+	w.wb, w.pending = nil, 0
+	return err
+}
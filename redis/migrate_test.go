@@ -0,0 +1,178 @@
+package redis
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+	"tiny-kvDB/utils"
+)
+
+func openTestDB(t *testing.T, name string) (*tiny_kvDB.DB, tiny_kvDB.Options) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-"+name)
+	opts.DirPath = dir
+	db, err := tiny_kvDB.Open(opts)
+	assert.Nil(t, err)
+	return db, opts
+}
+
+// legacyKey 旧编排的内部key key+version(小端)+suffix
+func legacyKey(key []byte, version int64, suffix ...byte) []byte {
+	return append(legacyInternalKeyPrefix(key, version), suffix...)
+}
+
+// 按旧编排写入每种类型的数据，包括过期的key和失效版本的内部key
+func writeLegacyData(t *testing.T, db *tiny_kvDB.DB) {
+	put := func(key, value []byte) {
+		assert.Nil(t, db.Put(key, value))
+	}
+	put([]byte("str"), encodeStringValue([]byte("v"), 0))
+	put([]byte("expired"), encodeStringValue([]byte("v"), time.Nanosecond))
+
+	hash := &metadata{dataType: Hash, version: 100, size: 2}
+	put([]byte("h"), hash.encode())
+	put(legacyKey([]byte("h"), 100, []byte("f1")...), []byte("v1"))
+	put(legacyKey([]byte("h"), 100, []byte("f2")...), []byte("v2"))
+	put(legacyKey([]byte("h"), 99, []byte("old")...), []byte("stale"))
+	put(append(legacyRegistryPrefix, legacyKey([]byte("h"), 100)...), nil)
+
+	set := &metadata{dataType: Set, version: 200, size: 2}
+	put([]byte("s"), set.encode())
+	for _, member := range []string{"a", "bb"} {
+		size := binary.LittleEndian.AppendUint32(nil, uint32(len(member)))
+		put(legacyKey([]byte("s"), 200, append([]byte(member), size...)...), nil)
+	}
+
+	list := &metadata{dataType: List, version: 300, size: 3, head: initialListMark - 1, tail: initialListMark + 2}
+	put([]byte("l"), list.encode())
+	for i, element := range []string{"x", "y", "z"} {
+		index := binary.LittleEndian.AppendUint64(nil, list.head+uint64(i))
+		put(legacyKey([]byte("l"), 300, index...), []byte(element))
+	}
+
+	zset := &metadata{dataType: ZSet, version: 400, size: 2}
+	put([]byte("z"), zset.encode())
+	for member, score := range map[string]float64{"m1": 1.5, "m2": -2} {
+		put(legacyKey([]byte("z"), 400, append([]byte{zSetMemberMark}, member...)...), utils.Float64ToBytes(score))
+		scoreKey := append([]byte{zSetScoreMark}, utils.Float64ToBytes(score)...)
+		put(legacyKey([]byte("z"), 400, append(scoreKey, member...)...), nil)
+	}
+
+	// 最初的版本score按字符串编码，按score排列的key末尾是member的长度
+	zb := &metadata{dataType: ZSet, version: 500, size: 2}
+	put([]byte("zb"), zb.encode())
+	for member, score := range map[string]string{"n1": "0.25", "n2": "-10"} {
+		put(legacyKey([]byte("zb"), 500, []byte(member)...), []byte(score))
+		scoreKey := append([]byte(score), member...)
+		scoreKey = binary.LittleEndian.AppendUint32(scoreKey, uint32(len(member)))
+		put(legacyKey([]byte("zb"), 500, scoreKey...), nil)
+	}
+}
+
+func TestMigrateLegacyLayout(t *testing.T) {
+	src, srcOpts := openTestDB(t, "migrate-src")
+	defer os.RemoveAll(srcOpts.DirPath)
+	dst, dstOpts := openTestDB(t, "migrate-dst")
+	defer os.RemoveAll(dstOpts.DirPath)
+
+	writeLegacyData(t, src)
+	assert.Nil(t, src.Close())
+	// 旧编排的数据目录不能直接打开
+	_, err := NewRedisDataStructure(srcOpts)
+	assert.Equal(t, ErrLegacyKeyLayout, err)
+
+	src, err = tiny_kvDB.Open(srcOpts)
+	assert.Nil(t, err)
+	n, err := MigrateLegacyLayout(src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	_, err = MigrateLegacyLayout(src, dst)
+	assert.Equal(t, ErrMigrateTargetNotEmpty, err)
+	_, err = MigrateLegacyLayout(dst, src)
+	assert.Equal(t, ErrAlreadyMigrated, err)
+	assert.Nil(t, src.Close())
+	assert.Nil(t, dst.Close())
+
+	rds, err := NewRedisDataStructure(dstOpts)
+	assert.Nil(t, err)
+	defer rds.Close()
+
+	keys, err := rds.Keys([]byte("*"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("h", "l", "s", "str", "z", "zb"), keys)
+	value, err := rds.Get([]byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+	fields, err := rds.HGetAll([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, []FieldValue{{Field: []byte("f1"), Value: []byte("v1")}, {Field: []byte("f2"), Value: []byte("v2")}}, fields)
+	members, err := rds.SMembers([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a", "bb"), members)
+	elements, err := rds.LRange([]byte("l"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("x", "y", "z"), elements)
+	zMembers, err := rds.ZRange([]byte("z"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("m2"), Score: -2}, {Member: []byte("m1"), Score: 1.5}}, zMembers)
+	zMembers, err = rds.ZRange([]byte("zb"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("n2"), Score: -10}, {Member: []byte("n1"), Score: 0.25}}, zMembers)
+	score, err := rds.ZScore([]byte("zb"), []byte("n1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0.25, score)
+
+	// 注册表在迁移时重新生成，失效版本的内部key没有被迁移
+	reclaimed, err := rds.ReclaimStaleKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, reclaimed)
+	_, err = rds.Del([]byte("h"))
+	assert.Nil(t, err)
+	reclaimed, err = rds.ReclaimStaleKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, reclaimed)
+}
+
+func TestMigrateLegacyLayout_InvalidZSet(t *testing.T) {
+	src, srcOpts := openTestDB(t, "migrate-zset-src")
+	defer os.RemoveAll(srcOpts.DirPath)
+	dst, dstOpts := openTestDB(t, "migrate-zset-dst")
+	defer os.RemoveAll(dstOpts.DirPath)
+
+	// 按member查找的key没有对应的按score排列的key，两种编码都对不上
+	zset := &metadata{dataType: ZSet, version: 1, size: 1}
+	assert.Nil(t, src.Put([]byte("z"), zset.encode()))
+	assert.Nil(t, src.Put(legacyKey([]byte("z"), 1, []byte("m")...), []byte("1.5")))
+	_, err := MigrateLegacyLayout(src, dst)
+	assert.Equal(t, ErrLegacyZSetEntry, err)
+	assert.Nil(t, src.Close())
+	assert.Nil(t, dst.Close())
+}
+
+func TestKeyLayout_NoCollision(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 旧编排中"ab"的内部key和"a"的内部key前缀可能重叠，string的key也可能落在数据结构的前缀下
+	_, err := rds.SAdd([]byte("a"), []byte("1"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("ab"), []byte("2"))
+	assert.Nil(t, err)
+	meta, err := rds.findMetaData([]byte("a"), Set)
+	assert.Nil(t, err)
+	collide := append(legacyInternalKeyPrefix([]byte("a"), meta.version), "x"...)
+	assert.Nil(t, rds.Set(collide, []byte("v"), 0))
+
+	members, err := rds.SMembers([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("1"), members)
+	members, err = rds.SMembers([]byte("ab"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("2"), members)
+	keys, err := rds.Keys([]byte("*"))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, [][]byte{[]byte("a"), []byte("ab"), collide}, keys)
+}
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"errors"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+)
+
+/*
+	删除、过期或者覆盖一个数据结构时只会删除或替换元数据，原来version下的内部key不会再被读到，
+	但是它们仍然在索引和数据文件中，Merge也无法回收。
+	每个数据结构创建的version都登记在版本注册表中（见putMetaData），后台定期检查注册表，
+	删除失效版本的所有内部key，最后删除注册表中的记录。
+*/
+
+const (
+	defaultReclaimInterval = time.Minute // 后台回收的间隔
+	reclaimBatchSize       = 1000        // 回收时每个批次删除的key数量
+)
+
+// ReclaimStaleKeys 删除所有失效版本的内部key，返回删除的内部key数量
+// 元数据已经被删除、被其他类型覆盖、换成了新的version或者已经过期时，这个version就失效了
+// 已经过期的元数据也会一起删除
+func (rds *RedisDataStructure) ReclaimStaleKeys() (int, error) {
+	var total int
+	err := rds.scanPrefix([]byte{tagVersionRegistry}, func(iter *tiny_kvDB.Iterator) (bool, error) {
+		select {
+		case <-rds.closed:
+			return false, nil
+		default:
+		}
+		registryKey := append([]byte(nil), iter.Key()...)
+		key, version, _ := decodeVersionedKey(registryKey)
+		stale, err := rds.isStaleVersion(key, version)
+		if err != nil || !stale {
+			return err == nil, err
+		}
+		// 注册表的value是数据类型
+		dataType, err := iter.Value()
+		if err != nil {
+			return false, err
+		}
+		n, err := rds.reclaimVersion(internalKeyPrefix(dataType[0], key, version), registryKey)
+		total += n
+		return err == nil, err
+	})
+	return total, err
+}
+
+// isStaleVersion 判断key的version是否已经失效
+func (rds *RedisDataStructure) isStaleVersion(key []byte, version int64) (bool, error) {
+	encValue, err := rds.db.Get(metaKey(key))
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(encValue) == 0 || encValue[0] == String {
+		return true, nil
+	}
+	meta := decodeMetaData(encValue)
+	if meta.version != version {
+		return true, nil
+	}
+	if meta.expire == 0 || meta.expire > time.Now().UnixNano() {
+		return false, nil
+	}
+	// 已经过期，先删除元数据，期间元数据被修改过时留到下一次检查
+	return rds.db.DeleteIfEquals(metaKey(key), encValue)
+}
+
+// reclaimVersion 分批删除前缀为prefix的所有内部key，最后删除注册表中的记录
+func (rds *RedisDataStructure) reclaimVersion(prefix, registryKey []byte) (int, error) {
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return 0, err
+	}
+	var n, pending int
+	err = rds.scanPrefix(prefix, func(iter *tiny_kvDB.Iterator) (bool, error) {
+		_ = wb.Delete(append([]byte(nil), iter.Key()...))
+		n++
+		pending++
+		if pending < reclaimBatchSize {
+			return true, nil
+		}
+		if err := wb.Commit(); err != nil {
+			return false, err
+		}
+		pending = 0
+		wb, err = rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+		return err == nil, err
+	})
+	if err != nil {
+		return n, err
+	}
+	_ = wb.Delete(registryKey)
+	return n, wb.Commit()
+}
+
+// reclaimLoop 每隔interval回收一次，直到关闭
+func (rds *RedisDataStructure) reclaimLoop(interval time.Duration) {
+	defer rds.reclaimWg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := rds.ReclaimStaleKeys()
+			if rds.logger == nil {
+				continue
+			}
+			if err != nil {
+				rds.logger.Log(tiny_kvDB.LogError, "failed to reclaim stale keys", "reclaimed", n, "err", err)
+			} else if n > 0 {
+				rds.logger.Log(tiny_kvDB.LogInfo, "reclaimed stale keys", "reclaimed", n)
+			}
+		case <-rds.closed:
+			return
+		}
+	}
+}
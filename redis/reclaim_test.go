@@ -0,0 +1,99 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisDataStructure_ReclaimStaleKeys(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		_, err := rds.HSet([]byte("deleted"), []byte(fmt.Sprint(i)), []byte("v"))
+		assert.Nil(t, err)
+		_, err = rds.SAdd([]byte("overwritten"), []byte(fmt.Sprint(i)))
+		assert.Nil(t, err)
+		_, err = rds.HSet([]byte("live"), []byte(fmt.Sprint(i)), []byte("v"))
+		assert.Nil(t, err)
+	}
+	_, err := rds.RPush([]byte("expired"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	// 过期之后重新创建的版本不能被回收
+	_, err = rds.ZAdd([]byte("recreated"), 1, []byte("old"))
+	assert.Nil(t, err)
+
+	// 没有失效的版本
+	n, err := rds.ReclaimStaleKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	keys, err := rds.db.ListKeys()
+	assert.Nil(t, err)
+	keyCount := len(keys)
+
+	_, err = rds.Del([]byte("deleted"))
+	assert.Nil(t, err)
+	assert.Nil(t, rds.Set([]byte("overwritten"), []byte("v"), 0))
+	_, err = rds.Expire([]byte("expired"), time.Millisecond)
+	assert.Nil(t, err)
+	_, err = rds.Expire([]byte("recreated"), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = rds.ZAdd([]byte("recreated"), 2, []byte("new"))
+	assert.Nil(t, err)
+
+	// hash 5个field，set 5个member，list 3个元素，zset每个member两个key
+	n, err = rds.ReclaimStaleKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 5+5+3+2, n)
+	n, err = rds.ReclaimStaleKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	// 删除：hash的元数据、field和注册表记录
+	// 覆盖：set的member和注册表记录，元数据变成string
+	// 过期：list的元数据、元素和注册表记录
+	// 重新创建：旧版本的两个key和注册表记录，新版本多了两个key和注册表记录
+	expected := keyCount - (1 + 5 + 1) - (5 + 1) - (1 + 3 + 1) - (2 + 1) + (2 + 1)
+	keys, err = rds.db.ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, len(keys))
+
+	size, err := rds.HLen([]byte("live"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), size)
+	members, err := rds.ZRange([]byte("recreated"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZMember{{Member: []byte("new"), Score: 2}}, members)
+	value, err := rds.Get([]byte("overwritten"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+
+	// 注册表不会出现在KEYS中
+	keys, err = rds.Keys([]byte("*"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("live", "overwritten", "recreated"), keys)
+}
+
+func TestRedisDataStructure_ReclaimRenamed(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	_, err := rds.SAdd([]byte("src"), []byte("a"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("dst"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("dst"), []byte("c"))
+	assert.Nil(t, err)
+
+	// destination原来的两个member失效
+	assert.Nil(t, rds.Rename([]byte("src"), []byte("dst")))
+	n, err := rds.ReclaimStaleKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	members, err := rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("a"), members)
+}
@@ -0,0 +1,337 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"time"
+	tiny_kvDB "tiny-kvDB"
+)
+
+// SCard 返回集合的成员数量，key不存在时返回0
+func (rds *RedisDataStructure) SCard(key []byte) (uint32, error) {
+	meta, err := rds.findMetaData(key, Set)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// SMembers 按顺序返回集合的所有成员
+func (rds *RedisDataStructure) SMembers(key []byte) ([][]byte, error) {
+	members := [][]byte{}
+	err := rds.sScan(key, func(member []byte) bool {
+		members = append(members, member)
+		return true
+	})
+	return members, err
+}
+
+// SScan 从cursor开始检查最多count个成员，返回其中匹配match的成员，以及下一次调用的cursor
+// 游标的含义见scanCursor
+func (rds *RedisDataStructure) SScan(key []byte, cursor uint64, match []byte, count int) (uint64, [][]byte, error) {
+	return scanCursor(cursor, match, count, func(fn func([]byte, []byte) bool) error {
+		return rds.sScan(key, func(member []byte) bool {
+			return fn(member, member)
+		})
+	})
+}
+
+// SInter 返回所有集合的交集
+func (rds *RedisDataStructure) SInter(keys ...[]byte) ([][]byte, error) {
+	metas, err := rds.findSetMetas(keys)
+	if err != nil {
+		return nil, err
+	}
+	// 遍历最小的集合，检查成员是否在其他所有集合中
+	smallest := 0
+	for i, meta := range metas {
+		if meta.size < metas[smallest].size {
+			smallest = i
+		}
+	}
+	result := [][]byte{}
+	if len(metas) == 0 || metas[smallest].size == 0 {
+		return result, nil
+	}
+	members, err := rds.SMembers(keys[smallest])
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		inAll := true
+		for i, meta := range metas {
+			if i == smallest {
+				continue
+			}
+			ok, err := rds.sIsMember(keys[i], meta, member)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			result = append(result, member)
+		}
+	}
+	return result, nil
+}
+
+// SUnion 返回所有集合的并集
+func (rds *RedisDataStructure) SUnion(keys ...[]byte) ([][]byte, error) {
+	if _, err := rds.findSetMetas(keys); err != nil {
+		return nil, err
+	}
+	result := [][]byte{}
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		err := rds.sScan(key, func(member []byte) bool {
+			if _, ok := seen[string(member)]; !ok {
+				seen[string(member)] = struct{}{}
+				result = append(result, member)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// SDiff 返回在第一个集合中但是不在其他集合中的成员
+func (rds *RedisDataStructure) SDiff(keys ...[]byte) ([][]byte, error) {
+	metas, err := rds.findSetMetas(keys)
+	if err != nil {
+		return nil, err
+	}
+	result := [][]byte{}
+	if len(keys) == 0 {
+		return result, nil
+	}
+	members, err := rds.SMembers(keys[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		inOther := false
+		for i := 1; i < len(keys) && !inOther; i++ {
+			if inOther, err = rds.sIsMember(keys[i], metas[i], member); err != nil {
+				return nil, err
+			}
+		}
+		if !inOther {
+			result = append(result, member)
+		}
+	}
+	return result, nil
+}
+
+// SInterStore 把交集保存到destination，覆盖destination原来的值，返回结果的成员数量
+func (rds *RedisDataStructure) SInterStore(destination []byte, keys ...[]byte) (int, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
+	members, err := rds.SInter(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return len(members), rds.sStore(destination, members)
+}
+
+// SUnionStore 把并集保存到destination，覆盖destination原来的值，返回结果的成员数量
+func (rds *RedisDataStructure) SUnionStore(destination []byte, keys ...[]byte) (int, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
+	members, err := rds.SUnion(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return len(members), rds.sStore(destination, members)
+}
+
+// SDiffStore 把差集保存到destination，覆盖destination原来的值，返回结果的成员数量
+func (rds *RedisDataStructure) SDiffStore(destination []byte, keys ...[]byte) (int, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
+	members, err := rds.SDiff(keys...)
+	if err != nil {
+		return 0, err
+	}
+	return len(members), rds.sStore(destination, members)
+}
+
+// SRandMember 随机返回集合中的成员
+// count大于0时返回最多count个不同的成员，小于0时返回-count个成员，同一个成员可能出现多次
+func (rds *RedisDataStructure) SRandMember(key []byte, count int) ([][]byte, error) {
+	members, err := rds.SMembers(key)
+	if err != nil {
+		return nil, err
+	}
+	if count >= 0 {
+		return randomDistinct(members, count), nil
+	}
+	result := [][]byte{}
+	for i := 0; i < -count && len(members) > 0; i++ {
+		result = append(result, members[rand.Intn(len(members))])
+	}
+	return result, nil
+}
+
+// SPop 随机删除并返回最多count个不同的成员
+func (rds *RedisDataStructure) SPop(key []byte, count int) ([][]byte, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
+	meta, err := rds.findMetaData(key, Set)
+	if err != nil {
+		return nil, err
+	}
+	if meta.size == 0 || count <= 0 {
+		return [][]byte{}, nil
+	}
+	members, err := rds.SMembers(key)
+	if err != nil {
+		return nil, err
+	}
+	popped := randomDistinct(members, count)
+
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range popped {
+		sk := &setInternalKey{key: key, version: meta.version, member: member}
+		_ = wb.Delete(sk.encode())
+	}
+	meta.size -= uint32(len(popped))
+	rds.putMetaData(wb, key, meta)
+	if err := wb.Commit(); err != nil {
+		return nil, err
+	}
+	return popped, nil
+}
+
+// SMove 把member从source移动到destination，返回member是否在source中
+func (rds *RedisDataStructure) SMove(source, destination, member []byte) (bool, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
+	srcMeta, err := rds.findMetaData(source, Set)
+	if err != nil {
+		return false, err
+	}
+	dstMeta, err := rds.findMetaData(destination, Set)
+	if err != nil {
+		return false, err
+	}
+	ok, err := rds.sIsMember(source, srcMeta, member)
+	if err != nil || !ok {
+		return false, err
+	}
+	if bytes.Equal(source, destination) {
+		return true, nil
+	}
+	inDst, err := rds.sIsMember(destination, dstMeta, member)
+	if err != nil {
+		return false, err
+	}
+
+	// 删除和添加在同一个批次中提交
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
+	sk := &setInternalKey{key: source, version: srcMeta.version, member: member}
+	_ = wb.Delete(sk.encode())
+	srcMeta.size--
+	rds.putMetaData(wb, source, srcMeta)
+	if !inDst {
+		dk := &setInternalKey{key: destination, version: dstMeta.version, member: member}
+		_ = wb.Put(dk.encode(), nil)
+		dstMeta.size++
+		rds.putMetaData(wb, destination, dstMeta)
+	}
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// sStore 用members覆盖destination，不管destination原来是什么类型，结果为空时删除destination
+// 调用方需要持有setMu，计算结果和写入之间集合不会被修改
+// 使用新的version，原来的成员不会再被读到
+func (rds *RedisDataStructure) sStore(destination []byte, members [][]byte) error {
+	if len(members) == 0 {
+		return rds.db.Delete(metaKey(destination))
+	}
+	meta := &metadata{
+		dataType: Set,
+		version:  time.Now().UnixNano(),
+		size:     uint32(len(members)),
+		isNew:    true,
+	}
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		sk := &setInternalKey{key: destination, version: meta.version, member: member}
+		_ = wb.Put(sk.encode(), nil)
+	}
+	rds.putMetaData(wb, destination, meta)
+	return wb.Commit()
+}
+
+// findSetMetas 读取所有集合的元数据，任何一个key不是集合时返回错误
+func (rds *RedisDataStructure) findSetMetas(keys [][]byte) ([]*metadata, error) {
+	metas := make([]*metadata, len(keys))
+	for i, key := range keys {
+		meta, err := rds.findMetaData(key, Set)
+		if err != nil {
+			return nil, err
+		}
+		metas[i] = meta
+	}
+	return metas, nil
+}
+
+func (rds *RedisDataStructure) sIsMember(key []byte, meta *metadata, member []byte) (bool, error) {
+	if meta.size == 0 {
+		return false, nil
+	}
+	sk := &setInternalKey{key: key, version: meta.version, member: member}
+	_, err := rds.db.Get(sk.encode())
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// sScan 按顺序遍历集合的成员，fn返回false时停止遍历
+func (rds *RedisDataStructure) sScan(key []byte, fn func(member []byte) bool) error {
+	meta, err := rds.findMetaData(key, Set)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return nil
+	}
+	sk := &setInternalKey{key: key, version: meta.version}
+	prefix := sk.prefix()
+	return rds.scanPrefix(prefix, func(iter *tiny_kvDB.Iterator) (bool, error) {
+		member := append([]byte(nil), iter.Key()[len(prefix):]...)
+		return fn(member), nil
+	})
+}
+
+// randomDistinct 随机选出最多count个不同的成员
+func randomDistinct(members [][]byte, count int) [][]byte {
+	if count >= len(members) {
+		return members
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	return members[:count]
+}
@@ -0,0 +1,232 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func addMembers(t *testing.T, rds *RedisDataStructure, key string, members ...string) {
+	for _, member := range members {
+		_, err := rds.SAdd([]byte(key), []byte(member))
+		assert.Nil(t, err)
+	}
+}
+
+func sortedMembers(members [][]byte) []string {
+	res := make([]string, 0, len(members))
+	for _, member := range members {
+		res = append(res, string(member))
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestSet_Algebra(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	addMembers(t, rds, "s1", "a", "b", "c", "d")
+	addMembers(t, rds, "s2", "c", "d", "e")
+	addMembers(t, rds, "s3", "d", "e", "f")
+	// 前缀相同的其他集合不能混进来
+	addMembers(t, rds, "s10", "x")
+
+	size, err := rds.SCard([]byte("s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), size)
+	members, err := rds.SMembers([]byte("s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, sortedMembers(members))
+
+	members, err = rds.SInter([]byte("s1"), []byte("s2"), []byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d"}, sortedMembers(members))
+	members, err = rds.SUnion([]byte("s1"), []byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f"}, sortedMembers(members))
+	members, err = rds.SDiff([]byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, sortedMembers(members))
+	members, err = rds.SInter([]byte("s1"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(members))
+
+	// STORE覆盖原来的值，包括其他类型
+	assert.Nil(t, rds.Set([]byte("dst"), []byte("v"), 0))
+	n, err := rds.SUnionStore([]byte("dst"), []byte("s2"), []byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	members, err = rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d", "e", "f"}, sortedMembers(members))
+	n, err = rds.SInterStore([]byte("dst"), []byte("dst"), []byte("s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	members, err = rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d"}, sortedMembers(members))
+	n, err = rds.SDiffStore([]byte("dst"), []byte("s2"), []byte("s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	members, err = rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e"}, sortedMembers(members))
+	// 结果为空时删除destination
+	n, err = rds.SInterStore([]byte("dst"), []byte("s1"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	size, err = rds.SCard([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), size)
+
+	_, err = rds.SUnion([]byte("s1"), []byte("str"))
+	assert.Nil(t, err)
+	assert.Nil(t, rds.Set([]byte("str"), []byte("v"), 0))
+	_, err = rds.SUnion([]byte("s1"), []byte("str"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestSet_PopMove(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	addMembers(t, rds, "s", "a", "b", "c", "d", "e")
+
+	members, err := rds.SRandMember([]byte("s"), 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(members))
+	assert.Equal(t, 3, len(map[string]bool{string(members[0]): true, string(members[1]): true, string(members[2]): true}))
+	members, err = rds.SRandMember([]byte("s"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(members))
+	members, err = rds.SRandMember([]byte("s"), -8)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, len(members))
+
+	popped, err := rds.SPop([]byte("s"), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(popped))
+	size, err := rds.SCard([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+	for _, member := range popped {
+		ok, err := rds.SIsMember([]byte("s"), member)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	rest, err := rds.SMembers([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, sortedMembers(append(rest, popped...)))
+
+	member := rest[0]
+	ok, err := rds.SMove([]byte("s"), []byte("t"), member)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.SMove([]byte("s"), []byte("t"), member)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SIsMember([]byte("t"), member)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	size, err = rds.SCard([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), size)
+
+	popped, err = rds.SPop([]byte("s"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(popped))
+	popped, err = rds.SPop([]byte("s"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(popped))
+}
+
+func TestSet_Scan(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	for i := 0; i < 25; i++ {
+		addMembers(t, rds, "s", fmt.Sprintf("member-%02d", i))
+	}
+	var (
+		cursor uint64
+		all    [][]byte
+	)
+	for {
+		next, members, err := rds.SScan([]byte("s"), cursor, nil, 7)
+		assert.Nil(t, err)
+		all = append(all, members...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 25, len(all))
+
+	_, members, err := rds.SScan([]byte("s"), 0, []byte("member-0*"), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(members))
+}
+
+func TestSet_Concurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 并发添加不同的成员，size和成员一致
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := rds.SAdd([]byte("s"), []byte(fmt.Sprintf("%d-%d", i, j)))
+				assert.Nil(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	size, err := rds.SCard([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(800), size)
+
+	// 并发SPOP和SMOVE，每个成员只会被取出一次
+	var mu sync.Mutex
+	taken := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				popped, err := rds.SPop([]byte("s"), 1)
+				assert.Nil(t, err)
+				moved, err := rds.SMove([]byte("s"), []byte("dst"), []byte(fmt.Sprintf("%d-%d", i, 99-j)))
+				assert.Nil(t, err)
+				mu.Lock()
+				for _, member := range popped {
+					taken[string(member)]++
+				}
+				if moved {
+					taken[fmt.Sprintf("%d-%d", i, 99-j)]++
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for member, n := range taken {
+		assert.Equal(t, 1, n, member)
+	}
+	size, err = rds.SCard([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, 800-len(taken), int(size))
+	members, err := rds.SMembers([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, int(size), len(members))
+	size, err = rds.SCard([]byte("dst"))
+	assert.Nil(t, err)
+	members, err = rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, int(size), len(members))
+}
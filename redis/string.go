@@ -0,0 +1,266 @@
+package redis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	tiny_kvDB "tiny-kvDB"
+)
+
+var (
+	ErrValueNotInteger = errors.New("value is not an integer or out of range")
+	ErrValueNotFloat   = errors.New("value is not a valid float")
+	ErrStringTooLong   = errors.New("string exceeds maximum allowed size (proto-max-bulk-len)")
+)
+
+// maxStringLength SETRANGE、APPEND之后string的最大长度，和redis相同
+const maxStringLength = 512 << 20
+
+/*
+	读改写string的命令都通过CompareAndSwap完成，期间key被其他写入修改了就重新读取，
+	INCR、APPEND、SETRANGE这些修改已有值的命令保留原来的过期时间，GETSET、MSET和SET一样清除过期时间
+*/
+
+// KeyValue MSET、MSETNX写入的key和value
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// IncrBy 把key的值当作十进制整数加上delta，key不存在时视为0，返回增加后的值
+func (rds *RedisDataStructure) IncrBy(key []byte, delta int64) (int64, error) {
+	var n int64
+	err := rds.updateString(key, func(value []byte, expire int64) ([]byte, int64, error) {
+		n = 0
+		if value != nil {
+			var err error
+			if n, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+				return nil, 0, ErrValueNotInteger
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, 0, ErrIncrOverflow
+		}
+		n += delta
+		return []byte(strconv.FormatInt(n, 10)), expire, nil
+	})
+	return n, err
+}
+
+// IncrByFloat 把key的值当作浮点数加上delta，key不存在时视为0，返回增加后的值
+func (rds *RedisDataStructure) IncrByFloat(key []byte, delta float64) (float64, error) {
+	var f float64
+	err := rds.updateString(key, func(value []byte, expire int64) ([]byte, int64, error) {
+		f = 0
+		if value != nil {
+			var err error
+			if f, err = strconv.ParseFloat(string(value), 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				return nil, 0, ErrValueNotFloat
+			}
+		}
+		f += delta
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, 0, ErrIncrNaNOrInfinity
+		}
+		return []byte(strconv.FormatFloat(f, 'f', -1, 64)), expire, nil
+	})
+	return f, err
+}
+
+// Append 把value追加到key原来的值后面，key不存在时相当于SET，返回追加之后的长度
+func (rds *RedisDataStructure) Append(key, value []byte) (int, error) {
+	var length int
+	err := rds.updateString(key, func(old []byte, expire int64) ([]byte, int64, error) {
+		if len(old)+len(value) > maxStringLength {
+			return nil, 0, ErrStringTooLong
+		}
+		newValue := make([]byte, 0, len(old)+len(value))
+		newValue = append(append(newValue, old...), value...)
+		length = len(newValue)
+		return newValue, expire, nil
+	})
+	return length, err
+}
+
+// StrLen 返回key的值的长度，key不存在时返回0
+func (rds *RedisDataStructure) StrLen(key []byte) (int, error) {
+	_, value, _, err := rds.readString(metaKey(key))
+	return len(value), err
+}
+
+// GetRange 返回key的值中下标在[start, end]之间的部分，负数下标从末尾开始计算
+func (rds *RedisDataStructure) GetRange(key []byte, start, end int64) ([]byte, error) {
+	_, value, _, err := rds.readString(metaKey(key))
+	if err != nil {
+		return nil, err
+	}
+	size := int64(len(value))
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end {
+		return []byte{}, nil
+	}
+	return value[start : end+1], nil
+}
+
+// SetRange 从offset开始用value覆盖key的值，原来的值不够长时用0补齐，返回修改之后的长度
+// value为空时不修改，key不存在时也不会创建
+func (rds *RedisDataStructure) SetRange(key []byte, offset int, value []byte) (int, error) {
+	if offset+len(value) > maxStringLength {
+		return 0, ErrStringTooLong
+	}
+	var length int
+	err := rds.updateString(key, func(old []byte, expire int64) ([]byte, int64, error) {
+		length = len(old)
+		if len(value) == 0 {
+			return nil, 0, nil
+		}
+		newValue := old
+		if end := offset + len(value); end > len(old) {
+			newValue = make([]byte, end)
+			copy(newValue, old)
+		} else {
+			newValue = append([]byte(nil), old...)
+		}
+		copy(newValue[offset:], value)
+		length = len(newValue)
+		return newValue, expire, nil
+	})
+	return length, err
+}
+
+// GetSet 写入value并返回原来的值，key不存在时返回nil，原来的过期时间被清除
+func (rds *RedisDataStructure) GetSet(key, value []byte) ([]byte, error) {
+	var oldValue []byte
+	err := rds.updateString(key, func(old []byte, _ int64) ([]byte, int64, error) {
+		oldValue = old
+		return value, 0, nil
+	})
+	return oldValue, err
+}
+
+// GetDel 删除key并返回原来的值，key不存在时返回nil
+func (rds *RedisDataStructure) GetDel(key []byte) ([]byte, error) {
+	rds.stringMu.RLock()
+	defer rds.stringMu.RUnlock()
+	mk := metaKey(key)
+	for {
+		encValue, value, _, err := rds.readString(mk)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		ok, err := rds.db.DeleteIfEquals(mk, encValue)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return value, nil
+		}
+	}
+}
+
+// MGet 按顺序返回所有key的值，不存在或者不是string的key返回nil
+func (rds *RedisDataStructure) MGet(keys ...[]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		_, value, _, err := rds.readString(metaKey(key))
+		if errors.Is(err, ErrWrongTypeOperation) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// MSet 在同一个批次中写入所有的key，覆盖原来的值和过期时间
+func (rds *RedisDataStructure) MSet(pairs ...KeyValue) error {
+	rds.stringMu.RLock()
+	defer rds.stringMu.RUnlock()
+	return rds.mSet(pairs)
+}
+
+// MSetNX 所有的key都不存在时才在同一个批次中写入，返回是否写入
+// 其他类型的写入也会创建key，所以检查和写入期间持有所有类型的写锁
+func (rds *RedisDataStructure) MSetNX(pairs ...KeyValue) (bool, error) {
+	rds.lockAllTypes()
+	defer rds.unlockAllTypes()
+	for _, pair := range pairs {
+		n, err := rds.Exists(pair.Key)
+		if err != nil || n > 0 {
+			return false, err
+		}
+	}
+	return true, rds.mSet(pairs)
+}
+
+func (rds *RedisDataStructure) mSet(pairs []KeyValue) error {
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		_ = wb.Put(metaKey(pair.Key), encodeStringWithExpire(pair.Value, 0))
+	}
+	return wb.Commit()
+}
+
+// readString 读取string，返回原来的编码、value和过期时间
+// key不存在时编码为nil，不存在或者已经过期时value为nil，key是其他类型时返回ErrWrongTypeOperation
+func (rds *RedisDataStructure) readString(mk []byte) ([]byte, []byte, int64, error) {
+	encValue, err := rds.db.Get(mk)
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return nil, nil, 0, nil
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if !isLiveValue(encValue) {
+		return encValue, nil, 0, nil
+	}
+	if encValue[0] != String {
+		return nil, nil, 0, ErrWrongTypeOperation
+	}
+	expire, n := binary.Varint(encValue[1:])
+	return encValue, encValue[1+n:], expire, nil
+}
+
+// updateString 用CompareAndSwap原子地读改写string，key不存在或者已经过期时value为nil
+// update返回新的value和过期时间，返回的value为nil表示不修改
+func (rds *RedisDataStructure) updateString(key []byte,
+	update func(value []byte, expire int64) ([]byte, int64, error)) error {
+	rds.stringMu.RLock()
+	defer rds.stringMu.RUnlock()
+	mk := metaKey(key)
+	for {
+		encValue, value, expire, err := rds.readString(mk)
+		if err != nil {
+			return err
+		}
+		newValue, newExpire, err := update(value, expire)
+		if err != nil || newValue == nil {
+			return err
+		}
+		ok, err := rds.db.CompareAndSwap(mk, encValue, encodeStringWithExpire(newValue, newExpire))
+		if err != nil {
+			return err
+		}
+		// 期间key被其他写入修改了，重新读取
+		if ok {
+			return nil
+		}
+	}
+}
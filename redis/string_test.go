@@ -0,0 +1,235 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestString_Incr(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	n, err := rds.IncrBy([]byte("n"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = rds.IncrBy([]byte("n"), -11)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-10), n)
+
+	assert.Nil(t, rds.Set([]byte("max"), []byte("9223372036854775807"), 0))
+	_, err = rds.IncrBy([]byte("max"), 1)
+	assert.Equal(t, ErrIncrOverflow, err)
+	assert.Nil(t, rds.Set([]byte("str"), []byte("abc"), 0))
+	_, err = rds.IncrBy([]byte("str"), 1)
+	assert.Equal(t, ErrValueNotInteger, err)
+	_, err = rds.SAdd([]byte("set"), []byte("m"))
+	assert.Nil(t, err)
+	_, err = rds.IncrBy([]byte("set"), 1)
+	assert.Equal(t, ErrWrongTypeOperation, err)
+
+	f, err := rds.IncrByFloat([]byte("n"), 0.5)
+	assert.Nil(t, err)
+	assert.Equal(t, -9.5, f)
+	value, err := rds.Get([]byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("-9.5"), value)
+	// 浮点数的结果不能再用INCR
+	_, err = rds.IncrBy([]byte("n"), 1)
+	assert.Equal(t, ErrValueNotInteger, err)
+	assert.Nil(t, rds.Set([]byte("big"), []byte("1e308"), 0))
+	_, err = rds.IncrByFloat([]byte("big"), math.MaxFloat64)
+	assert.Equal(t, ErrIncrNaNOrInfinity, err)
+
+	// 并发的INCR不会丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := rds.IncrBy([]byte("counter"), 1)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	value, err = rds.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("400"), value)
+}
+
+func TestString_Expire(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 修改已有值的命令保留过期时间
+	assert.Nil(t, rds.Set([]byte("n"), []byte("1"), time.Hour))
+	_, err := rds.IncrBy([]byte("n"), 1)
+	assert.Nil(t, err)
+	_, err = rds.Append([]byte("n"), []byte("0"))
+	assert.Nil(t, err)
+	_, err = rds.SetRange([]byte("n"), 0, []byte("3"))
+	assert.Nil(t, err)
+	ttl, err := rds.TTL([]byte("n"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 59*time.Minute)
+	value, err := rds.Get([]byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("30"), value)
+
+	// GETSET、MSET清除过期时间
+	old, err := rds.GetSet([]byte("n"), []byte("v"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("30"), old)
+	ttl, err = rds.TTL([]byte("n"))
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpire, ttl)
+	assert.Nil(t, rds.Set([]byte("m"), []byte("1"), time.Hour))
+	assert.Nil(t, rds.MSet(KeyValue{Key: []byte("m"), Value: []byte("2")}))
+	ttl, err = rds.TTL([]byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpire, ttl)
+
+	// 过期的key当作不存在
+	assert.Nil(t, rds.Set([]byte("expired"), []byte("10"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	n, err := rds.IncrBy([]byte("expired"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	ttl, err = rds.TTL([]byte("expired"))
+	assert.Nil(t, err)
+	assert.Equal(t, NoExpire, ttl)
+}
+
+func TestString_Range(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	n, err := rds.Append([]byte("s"), []byte("Hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	n, err = rds.Append([]byte("s"), []byte(" World"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = rds.StrLen([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = rds.StrLen([]byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	for _, c := range []struct {
+		start, end int64
+		expected   string
+	}{
+		{0, 4, "Hello"},
+		{-5, -1, "World"},
+		{-100, 2, "Hel"},
+		{6, 100, "World"},
+		{5, 3, ""},
+		{20, 30, ""},
+	} {
+		value, err := rds.GetRange([]byte("s"), c.start, c.end)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(c.expected), value)
+	}
+
+	n, err = rds.SetRange([]byte("s"), 6, []byte("Redis"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = rds.SetRange([]byte("pad"), 3, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	value, err := rds.Get([]byte("pad"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("\x00\x00\x00x"), value)
+	value, err = rds.Get([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("Hello Redis"), value)
+
+	// 空的value不会创建key
+	n, err = rds.SetRange([]byte("empty"), 5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	exists, err := rds.Exists([]byte("empty"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exists)
+	_, err = rds.SetRange([]byte("s"), maxStringLength, []byte("x"))
+	assert.Equal(t, ErrStringTooLong, err)
+}
+
+func TestString_Multi(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	assert.Nil(t, rds.MSet(
+		KeyValue{Key: []byte("a"), Value: []byte("1")},
+		KeyValue{Key: []byte("b"), Value: []byte("2")},
+	))
+	_, err := rds.SAdd([]byte("set"), []byte("m"))
+	assert.Nil(t, err)
+	values, err := rds.MGet([]byte("a"), []byte("missing"), []byte("set"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), nil, nil, []byte("2")}, values)
+
+	// 有一个key存在就都不写入，包括其他类型的key
+	ok, err := rds.MSetNX(
+		KeyValue{Key: []byte("c"), Value: []byte("3")},
+		KeyValue{Key: []byte("set"), Value: []byte("x")},
+	)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	exists, err := rds.Exists([]byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exists)
+	ok, err = rds.MSetNX(
+		KeyValue{Key: []byte("c"), Value: []byte("3")},
+		KeyValue{Key: []byte("d"), Value: []byte("4")},
+	)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	values, err = rds.MGet([]byte("c"), []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, listElements("3", "4"), values)
+
+	value, err := rds.GetDel([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+	value, err = rds.GetDel([]byte("a"))
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	old, err := rds.GetSet([]byte("a"), []byte("new"))
+	assert.Nil(t, err)
+	assert.Nil(t, old)
+	_, err = rds.GetSet([]byte("set"), []byte("x"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestString_MSetNXConcurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 同时执行MSETNX和SADD，只有一个能创建key
+	for i := 0; i < 200; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		var added bool
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rds.SAdd(key, []byte("m"))
+			if err != nil {
+				assert.Equal(t, ErrWrongTypeOperation, err)
+			}
+			added = err == nil
+		}()
+		ok, err := rds.MSetNX(KeyValue{Key: key, Value: []byte("v")})
+		assert.Nil(t, err)
+		wg.Wait()
+		assert.NotEqual(t, ok, added)
+	}
+}
@@ -3,15 +3,29 @@ package redis
 import (
 	"encoding/binary"
 	"errors"
+	"math"
+	"sync"
 	"time"
 	tiny_kvDB "tiny-kvDB"
 	"tiny-kvDB/utils"
 )
 
 var (
-	ErrWrongTypeOperation = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value.")
+	ErrWrongTypeOperation   = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value.")
+	ErrScoreIsNaN           = errors.New("resulting score is not a number (NaN)")
+	ErrHashValueNotInteger  = errors.New("hash value is not an integer")
+	ErrHashValueNotFloat    = errors.New("hash value is not a float")
+	ErrIncrOverflow         = errors.New("increment or decrement would overflow")
+	ErrIncrNaNOrInfinity    = errors.New("increment would produce NaN or Infinity")
+	ErrInvalidScoreEncoding = errors.New("sorted set score is not in the current encoding, the data directory needs migration")
 )
 
+// unlimitedWriteBatchOptions 不限制数量的批次，给列表重新编号、SPOP、*STORE这些一次可能修改整个数据结构的操作使用
+var unlimitedWriteBatchOptions = tiny_kvDB.WriteBatchOptions{
+	MaxBatchNum: math.MaxUint32,
+	SyncWrite:   tiny_kvDB.DefaultWriteBatchOptions.SyncWrite,
+}
+
 type redisDataType = byte
 
 const (
@@ -24,22 +38,54 @@ const (
 
 // RedisDataStructure redis数据结构服务
 type RedisDataStructure struct {
-	db *tiny_kvDB.DB
+	db        *tiny_kvDB.DB
+	listMu    sync.Mutex    // 列表的读改写操作互斥，并发pop时每个元素只会被取出一次
+	hashMu    sync.Mutex    // hash的读改写操作互斥，元数据中的size和HINCRBY的结果不会丢失更新
+	setMu     sync.Mutex    // 集合的读改写操作互斥，元数据中的size和成员保持一致
+	zsetMu    sync.Mutex    // 有序集合的读改写操作互斥，ZINCRBY不会丢失更新
+	stringMu  sync.RWMutex  // string写入持有读锁，MSETNX、DEL这些跨类型的操作通过lockAllTypes持有写锁
+	waiters   *listWaiters  // 阻塞在列表上的等待者
+	closed    chan struct{} // 关闭时唤醒所有阻塞的调用，并停止后台回收
+	closeOnce sync.Once
+	reclaimWg sync.WaitGroup   // 等待后台回收退出之后再关闭数据库
+	logger    tiny_kvDB.Logger // 后台回收出错时输出日志，为空时不输出
 }
 
-// NewRedisDataStructure 初始化redis数据结构服务
+// NewRedisDataStructure 初始化redis数据结构服务，并启动后台回收失效的内部key
 func NewRedisDataStructure(option tiny_kvDB.Options) (*RedisDataStructure, error) {
 	db, err := tiny_kvDB.Open(option)
 	if err != nil {
 		return nil, err
 	}
-	return &RedisDataStructure{db: db}, nil
+	if err := checkKeyLayout(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	rds := &RedisDataStructure{
+		db:      db,
+		waiters: newListWaiters(),
+		closed:  make(chan struct{}),
+		logger:  option.Logger,
+	}
+	rds.reclaimWg.Add(1)
+	go rds.reclaimLoop(defaultReclaimInterval)
+	return rds, nil
 }
 
 func (rds *RedisDataStructure) Close() error {
+	rds.closeOnce.Do(func() { close(rds.closed) })
+	rds.reclaimWg.Wait()
 	return rds.db.Close()
 }
 
+// putMetaData 在批次中写入元数据，新创建的版本同时登记到版本注册表
+func (rds *RedisDataStructure) putMetaData(wb *tiny_kvDB.WriteBatch, key []byte, meta *metadata) {
+	_ = wb.Put(metaKey(key), meta.encode())
+	if meta.isNew {
+		_ = wb.Put(versionRegistryKey(key, meta.version), []byte{meta.dataType})
+	}
+}
+
 /*
 string
 value: type(1B)+expire(8B)+value(N B)
@@ -49,26 +95,75 @@ func (rds *RedisDataStructure) Set(key, value []byte, ttl time.Duration) error {
 	if value == nil {
 		return nil
 	}
+	rds.stringMu.RLock()
+	defer rds.stringMu.RUnlock()
 
-	// 编码value : type+expire +payload
-	buf := make([]byte, binary.MaxVarintLen64+1)
-	buf[0] = String
-	var index = 1
+	// 调用存储引擎的接口进行写入
+	return rds.db.Put(metaKey(key), encodeStringValue(value, ttl))
+}
+
+// SetCondition SET命令的写入条件
+type SetCondition int8
+
+const (
+	SetAlways     SetCondition = iota // 总是写入
+	SetIfNotExist                     // NX，key不存在时才写入
+	SetIfExist                        // XX，key存在时才写入
+)
+
+// SetWithCondition 满足条件时写入string，返回是否写入
+// 判断条件和写入通过CompareAndSwap原子完成，已经过期的key视为不存在
+func (rds *RedisDataStructure) SetWithCondition(key, value []byte, ttl time.Duration, cond SetCondition) (bool, error) {
+	if cond == SetAlways {
+		return true, rds.Set(key, value, ttl)
+	}
+	rds.stringMu.RLock()
+	defer rds.stringMu.RUnlock()
+	encValue := encodeStringValue(value, ttl)
+	mk := metaKey(key)
+	for {
+		old, err := rds.db.Get(mk)
+		if err != nil && !errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+			return false, err
+		}
+		exist := err == nil && isLiveValue(old)
+		if exist == (cond == SetIfNotExist) {
+			return false, nil
+		}
+		ok, err := rds.db.CompareAndSwap(mk, old, encValue)
+		if err != nil {
+			return false, err
+		}
+		// 期间key被其他写入修改了，重新判断
+		if ok {
+			return true, nil
+		}
+	}
+}
+
+// 编码value : type+expire +payload
+func encodeStringValue(value []byte, ttl time.Duration) []byte {
 	var expire int64 = 0
 	if ttl != 0 {
 		expire = time.Now().Add(ttl).UnixNano()
 	}
+	return encodeStringWithExpire(value, expire)
+}
+
+// encodeStringWithExpire 使用指定的过期时间编码value，expire为0表示不过期
+func encodeStringWithExpire(value []byte, expire int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+1)
+	buf[0] = String
+	var index = 1
 	index += binary.PutVarint(buf[index:], expire)
 	encValue := make([]byte, index+len(value))
 	copy(encValue[:index], buf[:index])
 	copy(encValue[index:], value)
-
-	// 调用存储引擎的接口进行写入
-	return rds.db.Put(key, encValue)
+	return encValue
 }
 
 func (rds *RedisDataStructure) Get(key []byte) ([]byte, error) {
-	encValue, err := rds.db.Get(key)
+	encValue, err := rds.db.Get(metaKey(key))
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +195,13 @@ func (rds *RedisDataStructure) Get(key []byte) ([]byte, error) {
 
 // HSet Hash 分成两部分，<key,meta>,<key+meta.version+field,value>
 func (rds *RedisDataStructure) HSet(key, field, value []byte) (bool, error) {
+	rds.hashMu.Lock()
+	defer rds.hashMu.Unlock()
+	return rds.hSet(key, field, value)
+}
+
+// hSet 调用方需要持有hashMu
+func (rds *RedisDataStructure) hSet(key, field, value []byte) (bool, error) {
 	meta, err := rds.findMetaData(key, Hash)
 	if err != nil {
 		return false, err
@@ -122,10 +224,13 @@ func (rds *RedisDataStructure) HSet(key, field, value []byte) (bool, error) {
 	// 以上操作需要保证原子性，使用writeBatch
 
 	// 更新元数据
-	wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
 	if !exist {
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		rds.putMetaData(wb, key, meta)
 	}
 
 	// 更新<key+version+field,value>
@@ -156,6 +261,8 @@ func (rds *RedisDataStructure) HGet(key, field []byte) ([]byte, error) {
 }
 
 func (rds *RedisDataStructure) HDel(key []byte, field []byte) (bool, error) {
+	rds.hashMu.Lock()
+	defer rds.hashMu.Unlock()
 	meta, err := rds.findMetaData(key, Hash)
 	if err != nil {
 		return false, err
@@ -176,9 +283,12 @@ func (rds *RedisDataStructure) HDel(key []byte, field []byte) (bool, error) {
 	}
 	// 更新元数据
 	if exist {
-		wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+		wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+		if err != nil {
+			return false, err
+		}
 		meta.size--
-		_ = wb.Put(key, meta.encode())
+		rds.putMetaData(wb, key, meta)
 		_ = wb.Delete(encKey)
 		if err = wb.Commit(); err != nil {
 			return true, err
@@ -192,12 +302,14 @@ func (rds *RedisDataStructure) HDel(key []byte, field []byte) (bool, error) {
 */
 
 func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
 	meta, err := rds.findMetaData(key, Set)
 	if err != nil {
 		return false, err
 	}
 	// 构造数据部分的key
-	// key+version+member+member_size
+	// key+version+member
 	sk := &setInternalKey{
 		key:     key,
 		version: meta.version,
@@ -206,9 +318,12 @@ func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
 	// 如果不存在，就新增，存在就不用管了
 	var ok bool
 	if _, err := rds.db.Get(sk.encode()); errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
-		wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+		wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+		if err != nil {
+			return false, err
+		}
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		rds.putMetaData(wb, key, meta)
 		_ = wb.Put(sk.encode(), nil)
 		if err := wb.Commit(); err != nil {
 			return false, err
@@ -241,6 +356,8 @@ func (rds *RedisDataStructure) SIsMember(key, member []byte) (bool, error) {
 }
 
 func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
+	rds.setMu.Lock()
+	defer rds.setMu.Unlock()
 	meta, err := rds.findMetaData(key, Set)
 	if err != nil {
 		return false, err
@@ -263,9 +380,12 @@ func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
 	}
 
 	// 存在更新
-	wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
 	meta.size--
-	_ = wb.Put(key, meta.encode())
+	rds.putMetaData(wb, key, meta)
 	_ = wb.Delete(sk.encode())
 	if err := wb.Commit(); err != nil {
 		return false, err
@@ -274,12 +394,15 @@ func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
 }
 
 // List 数据结构
-func (rds *RedisDataStructure) LPush(key []byte, element []byte) (uint32, error) {
-	return rds.pushInner(key, element, true)
+
+// LPush 依次把elements插入到列表头部，返回插入后列表的长度
+func (rds *RedisDataStructure) LPush(key []byte, elements ...[]byte) (uint32, error) {
+	return rds.pushInner(key, elements, true)
 }
 
-func (rds *RedisDataStructure) RPush(key []byte, element []byte) (uint32, error) {
-	return rds.pushInner(key, element, false)
+// RPush 依次把elements插入到列表尾部，返回插入后列表的长度
+func (rds *RedisDataStructure) RPush(key []byte, elements ...[]byte) (uint32, error) {
+	return rds.pushInner(key, elements, false)
 }
 
 func (rds *RedisDataStructure) LPop(key []byte) ([]byte, error) {
@@ -291,11 +414,13 @@ func (rds *RedisDataStructure) RPop(key []byte) ([]byte, error) {
 }
 
 // 返回当前一共有多少数据
-func (rds *RedisDataStructure) pushInner(key, element []byte, isLeft bool) (uint32, error) {
+func (rds *RedisDataStructure) pushInner(key []byte, elements [][]byte, isLeft bool) (uint32, error) {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
 	// isLeft == true 表示左边push，反之是右边push
 	meta, err := rds.findMetaData(key, List)
 	if err != nil {
-		return 0, nil
+		return 0, err
 	}
 
 	// 构造数据部分的key
@@ -304,32 +429,36 @@ func (rds *RedisDataStructure) pushInner(key, element []byte, isLeft bool) (uint
 		version: meta.version,
 	}
 
-	// 如果是左边插入，index根据head修改
-	// 当head == tail时，表示此时链表为空
-	if isLeft {
-		lk.index = meta.head - 1
-	} else {
-		lk.index = meta.tail
+	// 更新元数据和数据部分，所有元素在一个批次中原子提交
+	wb, err := rds.db.NewWriteBatch(unlimitedWriteBatchOptions)
+	if err != nil {
+		return 0, err
 	}
-
-	// 更新元数据和数据部分
-	// 原子提交
-	wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
-	meta.size++
-	if isLeft {
-		meta.head--
-	} else {
-		meta.tail++
+	for _, element := range elements {
+		// 如果是左边插入，index根据head修改
+		// 当head == tail时，表示此时链表为空
+		if isLeft {
+			meta.head--
+			lk.index = meta.head
+		} else {
+			lk.index = meta.tail
+			meta.tail++
+		}
+		meta.size++
+		_ = wb.Put(lk.encode(), element)
 	}
-	_ = wb.Put(key, meta.encode())
-	_ = wb.Put(lk.encode(), element)
+	rds.putMetaData(wb, key, meta)
 	if err := wb.Commit(); err != nil {
 		return 0, err
 	}
+	// 唤醒阻塞在这个列表上的等待者
+	rds.waiters.notify(key)
 	return meta.size, nil
 }
 
 func (rds *RedisDataStructure) popInner(key []byte, isLeft bool) ([]byte, error) {
+	rds.listMu.Lock()
+	defer rds.listMu.Unlock()
 	meta, err := rds.findMetaData(key, List)
 	if err != nil {
 		return nil, err
@@ -359,8 +488,11 @@ func (rds *RedisDataStructure) popInner(key []byte, isLeft bool) ([]byte, error)
 	} else {
 		meta.tail--
 	}
-	wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
-	_ = wb.Put(key, meta.encode())
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return nil, err
+	}
+	rds.putMetaData(wb, key, meta)
 	_ = wb.Delete(lk.encode())
 	if err := wb.Commit(); err != nil {
 		return nil, err
@@ -373,6 +505,16 @@ Sorted Set
 */
 
 func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (bool, error) {
+	if math.IsNaN(score) {
+		return false, ErrScoreIsNaN
+	}
+	rds.zsetMu.Lock()
+	defer rds.zsetMu.Unlock()
+	return rds.zAdd(key, score, member)
+}
+
+// zAdd 调用方需要持有zsetMu
+func (rds *RedisDataStructure) zAdd(key []byte, score float64, member []byte) (bool, error) {
 	meta, err := rds.findMetaData(key, ZSet)
 	if err != nil {
 		return false, err
@@ -393,18 +535,25 @@ func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (b
 		exist = false
 	}
 
+	var oldScore float64
 	if exist {
+		if oldScore, err = decodeScore(v); err != nil {
+			return false, err
+		}
 		// 如果已经存在，且score相等，则不做任何修改
-		if score == utils.FloatFromBytes(v) {
+		if score == oldScore {
 			return false, nil
 		}
 	}
 
 	// 更新元数据和数据部分
-	wb := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
 	if !exist {
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		rds.putMetaData(wb, key, meta)
 	}
 	// 如果存在需要获取sk_withScore
 	// 因为对应with member来说，直接更新<key+version+member,score>即可修改对应的分数
@@ -414,7 +563,7 @@ func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (b
 			key:     key,
 			version: meta.version,
 			member:  member,
-			score:   utils.FloatFromBytes(v),
+			score:   oldScore,
 		}
 		_ = wb.Delete(oldKey.encodeWithScore())
 	}
@@ -432,7 +581,7 @@ func (rds *RedisDataStructure) ZScore(key []byte, member []byte) (float64, error
 		return -1, err
 	}
 	if meta.size == 0 {
-		return -1, err
+		return -1, tiny_kvDB.ErrKeyNotFound
 	}
 	zk := &zSetInternalKey{
 		key:     key,
@@ -443,36 +592,30 @@ func (rds *RedisDataStructure) ZScore(key []byte, member []byte) (float64, error
 	if err != nil {
 		return -1, err
 	}
-	return utils.FloatFromBytes(value), nil
+	return decodeScore(value)
 }
 
 // 找到元数据
+// 和EXISTS、TYPE一致，已经过期或者没有元素的key视为不存在，不管原来是什么类型都创建新的版本
 func (rds *RedisDataStructure) findMetaData(key []byte, dataType redisDataType) (*metadata, error) {
-	metaBuf, err := rds.db.Get(key)
+	metaBuf, err := rds.db.Get(metaKey(key))
 	if err != nil && !errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
 		return nil, err
 	}
 	var meta *metadata
-	var exist = true
-	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
-		exist = false
-	} else {
+	if err == nil && isLiveValue(metaBuf) {
 		meta = decodeMetaData(metaBuf)
 		// 判断数据类型是否匹配
 		if meta.dataType != dataType {
 			return nil, ErrWrongTypeOperation
 		}
-		// 判断过期时间
-		if meta.expire != 0 && meta.expire <= time.Now().UnixNano() {
-			exist = false
-		}
-	}
-	if !exist {
+	} else {
 		meta = &metadata{
 			dataType: dataType,
 			expire:   0,
 			version:  time.Now().UnixNano(),
 			size:     0,
+			isNew:    true,
 		}
 		if dataType == List {
 			meta.head = initialListMark
@@ -38,6 +38,51 @@ func TestRedisDataStructure_Set(t *testing.T) {
 	assert.Nil(t, value3)
 }
 
+func TestRedisDataStructure_SetWithCondition(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	// key不存在时XX不写入，NX写入
+	ok, err := rds.SetWithCondition(utils.GetTestKey(1), []byte("v1"), 0, SetIfExist)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SetWithCondition(utils.GetTestKey(1), []byte("v1"), 0, SetIfNotExist)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// key存在时NX不写入，XX写入
+	ok, err = rds.SetWithCondition(utils.GetTestKey(1), []byte("v2"), 0, SetIfNotExist)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SetWithCondition(utils.GetTestKey(1), []byte("v3"), 0, SetIfExist)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	value, err := rds.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), value)
+
+	// 过期的key视为不存在
+	err = rds.Set(utils.GetTestKey(2), []byte("v1"), time.Millisecond*100)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+	_, err = rds.Type(utils.GetTestKey(2))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+	ok, err = rds.SetWithCondition(utils.GetTestKey(2), []byte("v2"), 0, SetIfExist)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SetWithCondition(utils.GetTestKey(2), []byte("v2"), time.Second, SetIfNotExist)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	value, err = rds.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+}
+
 func TestRedisDataStructure_Del(t *testing.T) {
 	opts := tiny_kvDB.DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-redis")
@@ -48,14 +93,16 @@ func TestRedisDataStructure_Del(t *testing.T) {
 	}
 
 	// 删除不存在的key
-	err = rds.Del(utils.GetTestKey(111))
+	ok, err := rds.Del(utils.GetTestKey(111))
 	assert.Equal(t, nil, err)
+	assert.False(t, ok)
 
 	//
 	err = rds.Set(utils.GetTestKey(1), utils.RandomValue(100), 0)
 	assert.Nil(t, err)
-	err = rds.Del(utils.GetTestKey(1))
+	ok, err = rds.Del(utils.GetTestKey(1))
 	assert.Nil(t, err)
+	assert.True(t, ok)
 
 	v, err := rds.Get(utils.GetTestKey(1))
 	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
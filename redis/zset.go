@@ -0,0 +1,288 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	tiny_kvDB "tiny-kvDB"
+	"tiny-kvDB/utils"
+)
+
+// ZMember 有序集合中的一个成员和它的分数
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ScoreRange 分数范围，默认包含两端，Exclusive为true时不包含对应的一端
+// 用math.Inf表示-inf和+inf
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// ZCard 返回有序集合的成员数量，key不存在时返回0
+func (rds *RedisDataStructure) ZCard(key []byte) (uint32, error) {
+	meta, err := rds.findMetaData(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// ZRem 删除成员，返回成员是否存在
+func (rds *RedisDataStructure) ZRem(key, member []byte) (bool, error) {
+	rds.zsetMu.Lock()
+	defer rds.zsetMu.Unlock()
+	meta, err := rds.findMetaData(key, ZSet)
+	if err != nil {
+		return false, err
+	}
+	if meta.size == 0 {
+		return false, nil
+	}
+	zk := &zSetInternalKey{
+		key:     key,
+		version: meta.version,
+		member:  member,
+	}
+	value, err := rds.db.Get(zk.encodeWithMember())
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if zk.score, err = decodeScore(value); err != nil {
+		return false, err
+	}
+
+	wb, err := rds.db.NewWriteBatch(tiny_kvDB.DefaultWriteBatchOptions)
+	if err != nil {
+		return false, err
+	}
+	meta.size--
+	rds.putMetaData(wb, key, meta)
+	_ = wb.Delete(zk.encodeWithMember())
+	_ = wb.Delete(zk.encodeWithScore())
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ZIncrBy 给成员的分数加上increment，成员不存在时当作0，返回新的分数
+func (rds *RedisDataStructure) ZIncrBy(key []byte, increment float64, member []byte) (float64, error) {
+	rds.zsetMu.Lock()
+	defer rds.zsetMu.Unlock()
+	score, err := rds.ZScore(key, member)
+	if err != nil && !errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		return 0, err
+	}
+	if errors.Is(err, tiny_kvDB.ErrKeyNotFound) {
+		score = 0
+	}
+	score += increment
+	if math.IsNaN(score) {
+		return 0, ErrScoreIsNaN
+	}
+	if _, err := rds.zAdd(key, score, member); err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// ZCount 返回分数在rng范围内的成员数量
+func (rds *RedisDataStructure) ZCount(key []byte, rng ScoreRange) (int, error) {
+	var count int
+	err := rds.zScanByScore(key, rng, false, func(ZMember) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// ZRange 按分数从小到大返回下标在[start, stop]之间的成员，负数下标从末尾开始计算，-1表示最后一个
+func (rds *RedisDataStructure) ZRange(key []byte, start, stop int64) ([]ZMember, error) {
+	return rds.zRangeByIndex(key, start, stop, false)
+}
+
+// ZRevRange 和ZRange相同，但是按分数从大到小排列
+func (rds *RedisDataStructure) ZRevRange(key []byte, start, stop int64) ([]ZMember, error) {
+	return rds.zRangeByIndex(key, start, stop, true)
+}
+
+// ZRangeByScore 按分数从小到大返回分数在rng范围内的成员，跳过前offset个，最多返回count个，count小于0表示不限制
+func (rds *RedisDataStructure) ZRangeByScore(key []byte, rng ScoreRange, offset, count int) ([]ZMember, error) {
+	var members []ZMember
+	if count == 0 || offset < 0 {
+		return members, nil
+	}
+	err := rds.zScanByScore(key, rng, false, func(zm ZMember) bool {
+		if offset > 0 {
+			offset--
+			return true
+		}
+		members = append(members, zm)
+		return count < 0 || len(members) < count
+	})
+	return members, err
+}
+
+// ZRank 返回成员按分数从小到大的排名，从0开始，成员不存在时返回ErrKeyNotFound
+func (rds *RedisDataStructure) ZRank(key, member []byte) (int64, error) {
+	return rds.zRank(key, member, false)
+}
+
+// ZRevRank 返回成员按分数从大到小的排名
+func (rds *RedisDataStructure) ZRevRank(key, member []byte) (int64, error) {
+	return rds.zRank(key, member, true)
+}
+
+func (rds *RedisDataStructure) zRank(key, member []byte, reverse bool) (int64, error) {
+	score, err := rds.ZScore(key, member)
+	if err != nil {
+		return -1, err
+	}
+	// 排名就是排在这个成员前面的成员数量
+	var rank int64 = -1
+	var found bool
+	rng := ScoreRange{Min: math.Inf(-1), Max: score}
+	if reverse {
+		rng = ScoreRange{Min: score, Max: math.Inf(1)}
+	}
+	err = rds.zScanByScore(key, rng, reverse, func(zm ZMember) bool {
+		rank++
+		found = zm.Score == score && bytes.Equal(zm.Member, member)
+		return !found
+	})
+	if err != nil {
+		return -1, err
+	}
+	// 读取分数之后成员被删除或者修改了分数
+	if !found {
+		return -1, tiny_kvDB.ErrKeyNotFound
+	}
+	return rank, nil
+}
+
+func (rds *RedisDataStructure) zRangeByIndex(key []byte, start, stop int64, reverse bool) ([]ZMember, error) {
+	meta, err := rds.findMetaData(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+	size := int64(meta.size)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	members := []ZMember{}
+	if start > stop {
+		return members, nil
+	}
+	var index int64
+	err = rds.zScan(key, meta, nil, reverse, func(zm ZMember) bool {
+		if index >= start {
+			members = append(members, zm)
+		}
+		index++
+		return index <= stop
+	})
+	return members, err
+}
+
+// zScanByScore 按分数顺序遍历分数在rng范围内的成员，fn返回false时停止遍历
+func (rds *RedisDataStructure) zScanByScore(key []byte, rng ScoreRange, reverse bool, fn func(ZMember) bool) error {
+	meta, err := rds.findMetaData(key, ZSet)
+	if err != nil {
+		return err
+	}
+	// 直接定位到范围的一端，不需要从头遍历
+	bound := rng.Min
+	if reverse {
+		bound = rng.Max
+	}
+	return rds.zScan(key, meta, &bound, reverse, func(zm ZMember) bool {
+		// 正向遍历时超过最大值结束，反向遍历时小于最小值结束，另一端只会在开头跳过相等的分数
+		if !rng.aboveMin(zm.Score) {
+			return !reverse
+		}
+		if !rng.belowMax(zm.Score) {
+			return reverse
+		}
+		return fn(zm)
+	})
+}
+
+// zScan 按分数顺序遍历有序集合，bound不为nil时从分数bound的位置开始，fn返回false时停止遍历
+func (rds *RedisDataStructure) zScan(key []byte, meta *metadata, bound *float64, reverse bool, fn func(ZMember) bool) error {
+	if meta.size == 0 {
+		return nil
+	}
+	zk := &zSetInternalKey{key: key, version: meta.version}
+	prefix := zk.scorePrefix()
+
+	// 迭代器不设置Prefix，不满足前缀时自己结束遍历，避免迭代器跳过前缀时扫描整个索引，创建迭代器的开销见scanPrefix
+	iter, err := rds.db.NewIterator(tiny_kvDB.IteratorOptions{Reverse: reverse})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	seekKey := make([]byte, len(prefix), len(prefix)+8)
+	copy(seekKey, prefix)
+	if reverse {
+		// 反向遍历时定位到不大于seekKey的最后一个key，所以要用比bound大一点的编码
+		upper := uint64(math.MaxUint64)
+		if bound != nil {
+			upper = binary.BigEndian.Uint64(utils.Float64ToBytes(*bound))
+		}
+		if upper == math.MaxUint64 {
+			seekKey[len(seekKey)-1]++
+		} else {
+			seekKey = binary.BigEndian.AppendUint64(seekKey, upper+1)
+		}
+	} else if bound != nil {
+		seekKey = append(seekKey, utils.Float64ToBytes(*bound)...)
+	}
+
+	for iter.Seek(seekKey); iter.Valid(); iter.Next() {
+		k := iter.Key()
+		if !bytes.HasPrefix(k, prefix) {
+			if reverse && bytes.Compare(k, prefix) > 0 {
+				continue
+			}
+			break
+		}
+		score, member := decodeZSetScoreKey(k, len(prefix))
+		// key是索引中的数据，返回给调用方之前需要拷贝
+		member = append([]byte(nil), member...)
+		if !fn(ZMember{Member: member, Score: score}) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"os"
+	"sync"
+	"testing"
+	tiny_kvDB "tiny-kvDB"
+)
+
+func zMembers(members []ZMember) []string {
+	res := make([]string, 0, len(members))
+	for _, zm := range members {
+		res = append(res, string(zm.Member))
+	}
+	return res
+}
+
+func TestSortedSet_Range(t *testing.T) {
+	opts := tiny_kvDB.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-zset")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer func() {
+		_ = rds.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	key := []byte("leaderboard")
+	// 另一个有序集合的数据不能出现在结果中
+	_, err = rds.ZAdd([]byte("leaderboard2"), 1, []byte("other"))
+	assert.Nil(t, err)
+	scores := map[string]float64{"a": -10.5, "b": -1, "c": 0, "d": 2.5, "e": 2.5, "f": 100, "g": math.Inf(1)}
+	for member, score := range scores {
+		_, err := rds.ZAdd(key, score, []byte(member))
+		assert.Nil(t, err)
+	}
+
+	size, err := rds.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(7), size)
+
+	members, err := rds.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "f", "g"}, zMembers(members))
+	assert.Equal(t, -10.5, members[0].Score)
+	members, err = rds.ZRange(key, -3, -2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e", "f"}, zMembers(members))
+	members, err = rds.ZRange(key, 5, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(members))
+	members, err = rds.ZRevRange(key, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"g", "f", "e"}, zMembers(members))
+
+	members, err = rds.ZRangeByScore(key, ScoreRange{Min: -1, Max: 2.5}, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "c", "d", "e"}, zMembers(members))
+	members, err = rds.ZRangeByScore(key, ScoreRange{Min: -1, Max: 2.5, MinExclusive: true, MaxExclusive: true}, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c"}, zMembers(members))
+	members, err = rds.ZRangeByScore(key, ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, 2, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "d", "e"}, zMembers(members))
+
+	count, err := rds.ZCount(key, ScoreRange{Min: 0, Max: math.Inf(1)})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+
+	rank, err := rds.ZRank(key, []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), rank)
+	rank, err = rds.ZRevRank(key, []byte("d"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), rank)
+	rank, err = rds.ZRevRank(key, []byte("g"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rank)
+	_, err = rds.ZRank(key, []byte("none"))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+
+	// 修改分数之后顺序随之改变
+	score, err := rds.ZIncrBy(key, -20, []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(80), score)
+	score, err = rds.ZIncrBy(key, -200, []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(-120), score)
+	members, err = rds.ZRange(key, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f", "a"}, zMembers(members))
+	_, err = rds.ZIncrBy(key, math.Inf(-1), []byte("g"))
+	assert.Equal(t, ErrScoreIsNaN, err)
+
+	ok, err := rds.ZRem(key, []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.ZRem(key, []byte("c"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.ZScore(key, []byte("c"))
+	assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+	members, err = rds.ZRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f", "a", "b", "d", "e", "g"}, zMembers(members))
+	size, err = rds.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(6), size)
+
+	// 不存在的key
+	members, err = rds.ZRange([]byte("none"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(members))
+}
+
+func TestSortedSet_Concurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	// 并发的ZINCRBY不会丢失更新，并发ZADD、ZREM之后size和成员一致
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := rds.ZIncrBy([]byte("z"), 1, []byte("counter"))
+				assert.Nil(t, err)
+				member := []byte(fmt.Sprintf("%d-%d", i, j))
+				_, err = rds.ZAdd([]byte("z"), float64(j), member)
+				assert.Nil(t, err)
+				if j%2 == 0 {
+					_, err = rds.ZRem([]byte("z"), member)
+					assert.Nil(t, err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	score, err := rds.ZScore([]byte("z"), []byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(800), score)
+	size, err := rds.ZCard([]byte("z"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1+400), size)
+	members, err := rds.ZRange([]byte("z"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1+400, len(members))
+	assert.Equal(t, []byte("counter"), members[len(members)-1].Member)
+}
+
+func TestSortedSet_RankConcurrent(t *testing.T) {
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+
+	for i, member := range []string{"a", "b", "c"} {
+		_, err := rds.ZAdd([]byte("z"), float64(i), []byte(member))
+		assert.Nil(t, err)
+	}
+	// b不断被删除和重新添加，排名只能是1或者不存在
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			_, err := rds.ZRem([]byte("z"), []byte("b"))
+			assert.Nil(t, err)
+			_, err = rds.ZAdd([]byte("z"), 1, []byte("b"))
+			assert.Nil(t, err)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		rank, err := rds.ZRank([]byte("z"), []byte("b"))
+		if err != nil {
+			assert.Equal(t, tiny_kvDB.ErrKeyNotFound, err)
+			continue
+		}
+		assert.Equal(t, int64(1), rank)
+	}
+}
+
+func TestSortedSet_LegacyScoreEncoding(t *testing.T) {
+	// 旧版本按字符串写入score的数据目录在打开时被拒绝
+	db, opts := openTestDB(t, "zset-legacy-score")
+	defer os.RemoveAll(opts.DirPath)
+	zset := &metadata{dataType: ZSet, version: 1, size: 1}
+	assert.Nil(t, db.Put([]byte("z"), zset.encode()))
+	assert.Nil(t, db.Put(legacyKey([]byte("z"), 1, []byte("m")...), []byte("1.5")))
+	assert.Nil(t, db.Close())
+	_, err := NewRedisDataStructure(opts)
+	assert.Equal(t, ErrLegacyKeyLayout, err)
+
+	// 当前编排中不是8字节的score返回错误，而不是解码出错误的分数
+	rds, cleanup := openTestRedis(t)
+	defer cleanup()
+	key := []byte("z")
+	_, err = rds.ZAdd(key, 1.5, []byte("m"))
+	assert.Nil(t, err)
+	buf, err := rds.db.Get(metaKey(key))
+	assert.Nil(t, err)
+	meta := decodeMetaData(buf)
+	zk := &zSetInternalKey{key: key, version: meta.version, member: []byte("m")}
+	assert.Nil(t, rds.db.Put(zk.encodeWithMember(), []byte("1.5")))
+
+	_, err = rds.ZScore(key, []byte("m"))
+	assert.Equal(t, ErrInvalidScoreEncoding, err)
+	_, err = rds.ZAdd(key, 2, []byte("m"))
+	assert.Equal(t, ErrInvalidScoreEncoding, err)
+	_, err = rds.ZRem(key, []byte("m"))
+	assert.Equal(t, ErrInvalidScoreEncoding, err)
+}
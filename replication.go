@@ -0,0 +1,589 @@
+package tiny_kvDB
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tiny-kvDB/data"
+	"tiny-kvDB/fio"
+)
+
+/*
+	复制协议
+	从节点连接后发送请求：fileID(4B) + offset(8B)，表示从该位置开始复制
+	主节点持续发送帧：
+	  数据帧：type(1B) + 主节点序列号(8B) + 主节点活跃文件ID(4B) + 主节点写入位置(8B) + fileID(4B) + offset(8B) + 数据长度(4B) + 数据
+	  数据长度为0时作为心跳，用于从节点计算复制延迟
+	  错误帧：type(1B) + 消息长度(4B) + 消息
+	数据帧中的数据都是完整的日志记录，从节点原样追加到同名的数据文件中，再按照加载数据文件的流程更新索引
+*/
+
+const (
+	replFrameData byte = iota + 1
+	replFrameError
+)
+
+const (
+	replRequestSize       = 4 + 8
+	replFrameHeaderSize   = 1 + 8 + 4 + 8 + 4 + 8 + 4
+	replMaxChunkSize      = 4 * 1024 * 1024
+	replHeartbeatInterval = 100 * time.Millisecond
+	replRetryInterval     = 200 * time.Millisecond
+)
+
+// ReplicationServer 主节点上的复制服务
+type ReplicationServer struct {
+	db       *DB
+	listener net.Listener
+	mu       *sync.Mutex
+	conns    map[net.Conn]struct{}
+	done     chan struct{}
+	wg       *sync.WaitGroup
+}
+
+// StartReplication 在addr上监听从节点的连接，把数据文件的内容发送给从节点
+func (db *DB) StartReplication(addr string) (*ReplicationServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	rs := &ReplicationServer{
+		db:       db,
+		listener: listener,
+		mu:       new(sync.Mutex),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+		wg:       new(sync.WaitGroup),
+	}
+	rs.wg.Add(1)
+	go rs.serve()
+	return rs, nil
+}
+
+// Addr 复制服务监听的地址
+func (rs *ReplicationServer) Addr() net.Addr {
+	return rs.listener.Addr()
+}
+
+// Close 停止复制服务，断开所有从节点
+func (rs *ReplicationServer) Close() error {
+	rs.mu.Lock()
+	select {
+	case <-rs.done:
+		rs.mu.Unlock()
+		return nil
+	default:
+	}
+	close(rs.done)
+	err := rs.listener.Close()
+	for conn := range rs.conns {
+		_ = conn.Close()
+	}
+	rs.mu.Unlock()
+	rs.wg.Wait()
+	return err
+}
+
+func (rs *ReplicationServer) serve() {
+	defer rs.wg.Done()
+	for {
+		conn, err := rs.listener.Accept()
+		if err != nil {
+			return
+		}
+		rs.mu.Lock()
+		select {
+		case <-rs.done:
+			rs.mu.Unlock()
+			_ = conn.Close()
+			return
+		default:
+		}
+		rs.conns[conn] = struct{}{}
+		rs.wg.Add(1)
+		rs.mu.Unlock()
+
+		go func() {
+			defer rs.wg.Done()
+			if err := rs.handle(conn); err != nil {
+				rs.db.logger.Log(LogInfo, "replication connection closed", "follower", conn.RemoteAddr(), "err", err)
+			}
+			rs.mu.Lock()
+			delete(rs.conns, conn)
+			rs.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// 处理一个从节点的连接
+func (rs *ReplicationServer) handle(conn net.Conn) error {
+	var req [replRequestSize]byte
+	if _, err := io.ReadFull(conn, req[:]); err != nil {
+		return err
+	}
+	fileID := binary.BigEndian.Uint32(req[:4])
+	offset := int64(binary.BigEndian.Uint64(req[4:]))
+
+	writer := bufio.NewWriter(conn)
+	for {
+		db := rs.db
+		db.mu.Lock()
+		var (
+			activeFileID uint32
+			activeOffset int64
+			dataFile     = db.getDataFile(fileID)
+			end          int64
+			caughtUp     = true
+			sealed       bool
+			lastSeq      = db.LastSeq()
+			signal       = db.appendSignalLocked()
+		)
+		if db.activeFile != nil {
+			activeFileID, activeOffset = db.activeFile.FileID, db.activeFile.WriteOff
+			switch {
+			case fileID < db.mergeBoundary && offset > 0:
+				// merge重写了该文件，原来的位置已经失效
+				db.mu.Unlock()
+				return writeReplicationError(writer, ErrReplicationPosition)
+			case dataFile == db.activeFile && offset > activeOffset:
+				// 从节点的数据比主节点更新
+				db.mu.Unlock()
+				return writeReplicationError(writer, ErrReplicationPosition)
+			case dataFile == db.activeFile:
+				end, caughtUp = activeOffset, offset == activeOffset
+			case dataFile != nil:
+				sealed, caughtUp = true, false
+			case fileID < activeFileID && offset == 0:
+				// 中间缺少的空文件直接跳过
+				fileID = db.nextDataFileID(fileID)
+				db.mu.Unlock()
+				continue
+			case fileID > activeFileID || offset > 0:
+				db.mu.Unlock()
+				return writeReplicationError(writer, ErrReplicationPosition)
+			}
+		}
+		db.mu.Unlock()
+
+		if sealed {
+			// 已经封存的文件不会再变化
+			size, err := dataFile.IOManager.Size()
+			if err != nil {
+				return writeReplicationError(writer, err)
+			}
+			end = size
+			if offset > end {
+				return writeReplicationError(writer, ErrReplicationPosition)
+			}
+			if offset == end {
+				fileID, offset = fileID+1, 0
+				continue
+			}
+		}
+
+		var chunk []byte
+		if !caughtUp {
+			var err error
+			if chunk, err = readReplicationChunk(dataFile, offset, end); err != nil {
+				return writeReplicationError(writer, err)
+			}
+		}
+		if err := writeReplicationFrame(writer, lastSeq, activeFileID, activeOffset, fileID, offset, chunk); err != nil {
+			return err
+		}
+		offset += int64(len(chunk))
+		if !caughtUp {
+			continue
+		}
+
+		// 已经追上主节点，等待新的写入
+		select {
+		case <-signal:
+		case <-time.After(replHeartbeatInterval):
+		case <-rs.done:
+			return nil
+		}
+	}
+}
+
+// 读取[offset, end)中不超过replMaxChunkSize的若干条完整记录
+func readReplicationChunk(dataFile *data.DataFile, offset, end int64) ([]byte, error) {
+	chunkEnd := offset
+	for chunkEnd < end {
+		_, size, err := dataFile.ReadLogRecord(chunkEnd)
+		if err != nil {
+			return nil, err
+		}
+		if chunkEnd > offset && chunkEnd+size-offset > replMaxChunkSize {
+			break
+		}
+		chunkEnd += size
+	}
+	chunk := make([]byte, chunkEnd-offset)
+	if _, err := dataFile.IOManager.Read(chunk, offset); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+func writeReplicationFrame(w *bufio.Writer, lastSeq uint64, activeFileID uint32, activeOffset int64,
+	fileID uint32, offset int64, chunk []byte) error {
+	var header [replFrameHeaderSize]byte
+	header[0] = replFrameData
+	index := 1
+	binary.BigEndian.PutUint64(header[index:], lastSeq)
+	index += 8
+	binary.BigEndian.PutUint32(header[index:], activeFileID)
+	index += 4
+	binary.BigEndian.PutUint64(header[index:], uint64(activeOffset))
+	index += 8
+	binary.BigEndian.PutUint32(header[index:], fileID)
+	index += 4
+	binary.BigEndian.PutUint64(header[index:], uint64(offset))
+	index += 8
+	binary.BigEndian.PutUint32(header[index:], uint32(len(chunk)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(chunk); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeReplicationError(w *bufio.Writer, replErr error) error {
+	msg := []byte(replErr.Error())
+	var header [5]byte
+	header[0] = replFrameError
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return replErr
+}
+
+// 返回大于fileID的第一个数据文件ID，调用方需要持有db.mu
+func (db *DB) nextDataFileID(fileID uint32) uint32 {
+	next := db.activeFile.FileID
+	for fid := range db.olderFile {
+		if fid > fileID && fid < next {
+			next = fid
+		}
+	}
+	return next
+}
+
+// 返回下一次写入时会被关闭的通道，调用方需要持有db.mu的写锁
+func (db *DB) appendSignalLocked() <-chan struct{} {
+	if db.appendSignal == nil {
+		db.appendSignal = make(chan struct{})
+	}
+	return db.appendSignal
+}
+
+// 唤醒等待新写入的复制连接，调用方需要持有db.mu的写锁
+func (db *DB) notifyAppend() {
+	if db.appendSignal != nil {
+		close(db.appendSignal)
+		db.appendSignal = nil
+	}
+}
+
+// ReplicationStatus 从节点的复制状态
+type ReplicationStatus struct {
+	Connected     bool   // 是否连接到了主节点
+	PrimarySeq    uint64 // 主节点最新的序列号
+	AppliedSeq    uint64 // 从节点已经应用的序列号
+	PrimaryFileID uint32 // 主节点活跃文件的ID
+	PrimaryOffset int64  // 主节点活跃文件的写入位置
+	FileID        uint32 // 从节点复制到的文件ID
+	Offset        int64  // 从节点复制到的文件位置
+	LastError     error  // 最近一次复制出错的原因
+}
+
+// Follower 复制的从节点，只读，数据文件和主节点保持一致
+type Follower struct {
+	db      *DB
+	addr    string
+	mu      *sync.Mutex
+	status  ReplicationStatus
+	conn    net.Conn
+	done    chan struct{}
+	wg      *sync.WaitGroup
+	applied chan struct{} // 每次应用完数据后关闭，用于等待复制进度
+}
+
+// OpenFollower 打开一个从节点，从primaryAddr复制数据
+// 从节点从本地已经复制到的位置继续复制，断开后会自动重连
+func OpenFollower(options Options, primaryAddr string) (*Follower, error) {
+	db, err := Open(options)
+	if err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	db.readOnly = true
+	db.mu.Unlock()
+
+	f := &Follower{
+		db:      db,
+		addr:    primaryAddr,
+		mu:      new(sync.Mutex),
+		done:    make(chan struct{}),
+		wg:      new(sync.WaitGroup),
+		applied: make(chan struct{}),
+	}
+	f.wg.Add(1)
+	go f.run()
+	return f, nil
+}
+
+// DB 返回从节点的只读数据库
+func (f *Follower) DB() *DB {
+	return f.db
+}
+
+// Status 返回复制状态
+func (f *Follower) Status() ReplicationStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := f.status
+	status.AppliedSeq = f.db.LastSeq()
+	return status
+}
+
+// Lag 返回从节点落后主节点的序列号数量
+func (f *Follower) Lag() uint64 {
+	status := f.Status()
+	if status.PrimarySeq <= status.AppliedSeq {
+		return 0
+	}
+	return status.PrimarySeq - status.AppliedSeq
+}
+
+// WaitForSeq 等待从节点应用到序列号seq，超时返回false
+func (f *Follower) WaitForSeq(seq uint64, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		f.mu.Lock()
+		applied := f.applied
+		f.mu.Unlock()
+		if f.db.LastSeq() >= seq {
+			return true
+		}
+		select {
+		case <-applied:
+		case <-timer.C:
+			return false
+		case <-f.done:
+			return false
+		}
+	}
+}
+
+// Merge 在从节点上merge已经封存的数据文件，活跃文件继续和主节点保持一致
+// merge期间的复制数据和主节点merge期间的写入一样追加到活跃文件中
+func (f *Follower) Merge() error {
+	return f.db.merge()
+}
+
+// Close 停止复制并关闭数据库
+func (f *Follower) Close() error {
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		return nil
+	default:
+	}
+	close(f.done)
+	if f.conn != nil {
+		_ = f.conn.Close()
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return f.db.Close()
+}
+
+func (f *Follower) run() {
+	defer f.wg.Done()
+	for {
+		err := f.replicate()
+		f.mu.Lock()
+		f.status.Connected = false
+		f.conn = nil
+		if err != nil {
+			f.status.LastError = err
+		}
+		f.mu.Unlock()
+
+		select {
+		case <-f.done:
+			return
+		default:
+		}
+		if err != nil {
+			f.db.logger.Log(LogWarn, "replication from primary interrupted", "primary", f.addr, "err", err)
+		}
+		select {
+		case <-f.done:
+			return
+		case <-time.After(replRetryInterval):
+		}
+	}
+}
+
+// 连接主节点并持续应用收到的数据，直到连接断开
+func (f *Follower) replicate() error {
+	conn, err := net.DialTimeout("tcp", f.addr, time.Second)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	select {
+	case <-f.done:
+		f.mu.Unlock()
+		_ = conn.Close()
+		return nil
+	default:
+	}
+	f.conn = conn
+	f.status.Connected = true
+	f.mu.Unlock()
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// 从本地活跃文件的末尾开始复制
+	var req [replRequestSize]byte
+	f.db.mu.RLock()
+	if f.db.activeFile != nil {
+		binary.BigEndian.PutUint32(req[:4], f.db.activeFile.FileID)
+		binary.BigEndian.PutUint64(req[4:], uint64(f.db.activeFile.WriteOff))
+	}
+	f.db.mu.RUnlock()
+	if _, err := conn.Write(req[:]); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		frameType, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if frameType == replFrameError {
+			var size [4]byte
+			if _, err := io.ReadFull(reader, size[:]); err != nil {
+				return err
+			}
+			msg := make([]byte, binary.BigEndian.Uint32(size[:]))
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				return err
+			}
+			if string(msg) == ErrReplicationPosition.Error() {
+				return ErrReplicationPosition
+			}
+			return errors.New(string(msg))
+		}
+
+		var header [replFrameHeaderSize - 1]byte
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return err
+		}
+		index := 0
+		primarySeq := binary.BigEndian.Uint64(header[index:])
+		index += 8
+		primaryFileID := binary.BigEndian.Uint32(header[index:])
+		index += 4
+		primaryOffset := int64(binary.BigEndian.Uint64(header[index:]))
+		index += 8
+		fileID := binary.BigEndian.Uint32(header[index:])
+		index += 4
+		offset := int64(binary.BigEndian.Uint64(header[index:]))
+		index += 8
+		chunk := make([]byte, binary.BigEndian.Uint32(header[index:]))
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return err
+		}
+
+		if len(chunk) > 0 {
+			if err := f.db.applyReplicatedData(fileID, offset, chunk); err != nil {
+				return err
+			}
+			offset += int64(len(chunk))
+		}
+
+		f.mu.Lock()
+		f.status.PrimarySeq = primarySeq
+		f.status.PrimaryFileID = primaryFileID
+		f.status.PrimaryOffset = primaryOffset
+		f.status.FileID = fileID
+		f.status.Offset = offset
+		f.status.LastError = nil
+		close(f.applied)
+		f.applied = make(chan struct{})
+		f.mu.Unlock()
+	}
+}
+
+// applyReplicatedData 将主节点发来的数据追加到同名的数据文件中，再更新内存索引
+func (db *DB) applyReplicatedData(fileID uint32, offset int64, buf []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.activeFile == nil || db.activeFile.FileID != fileID {
+		if db.activeFile != nil && fileID < db.activeFile.FileID {
+			return ErrReplicationPosition
+		}
+		// 主节点切换了活跃文件
+		if db.activeFile != nil {
+			if err := db.syncActiveFile(); err != nil {
+				return err
+			}
+			db.olderFile[db.activeFile.FileID] = db.activeFile
+		}
+		dataFile, err := data.OpenDataFile(db.options.DirPath, fileID, fio.StandardFileIO)
+		if err != nil {
+			return err
+		}
+		if db.activeFile != nil {
+			db.listener.OnFileRotated(FileRotatedInfo{
+				OldFileID: db.activeFile.FileID,
+				OldSize:   db.activeFile.WriteOff,
+				NewFileID: fileID,
+			})
+		}
+		db.activeFile = dataFile
+	}
+	if offset != db.activeFile.WriteOff {
+		return ErrReplicationPosition
+	}
+
+	if err := db.activeFile.Write(buf); err != nil {
+		return err
+	}
+	atomic.AddUint64(&db.metrics.bytesWritten, uint64(len(buf)))
+	if db.options.SyncWrites {
+		if err := db.syncActiveFile(); err != nil {
+			return err
+		}
+	}
+	if db.pendingTxnRecords == nil {
+		db.pendingTxnRecords = make(map[uint64][]*data.TransactionRecord)
+	}
+	_, err := db.applyDataFile(db.activeFile, offset, db.pendingTxnRecords)
+	return err
+}
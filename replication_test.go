@@ -0,0 +1,183 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+	"tiny-kvDB/utils"
+)
+
+func destroyFollower(f *Follower) {
+	if f != nil {
+		_ = f.Close()
+		_ = os.RemoveAll(f.DB().options.DirPath)
+	}
+}
+
+func assertReplicated(t *testing.T, primary *DB, follower *Follower) {
+	assert.True(t, follower.WaitForSeq(primary.LastSeq(), 5*time.Second))
+	assert.Equal(t, uint64(0), follower.Lag())
+	keys, err := primary.ListKeys()
+	assert.Nil(t, err)
+	followerKeys, err := follower.DB().ListKeys()
+	assert.Nil(t, err)
+	assert.Equal(t, keys, followerKeys)
+	for _, key := range keys {
+		want, err := primary.Get(key)
+		assert.Nil(t, err)
+		got, err := follower.DB().Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestDB_Replication(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-primary")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	primary, err := Open(opts)
+	defer destroyDB(primary)
+	assert.Nil(t, err)
+
+	// 从节点连接之前已经写入的数据需要追赶
+	for i := 0; i < 500; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	server, err := primary.StartReplication("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer server.Close()
+
+	followerOpts := opts
+	followerDir, _ := os.MkdirTemp("", "bitcask-go-replication-follower")
+	followerOpts.DirPath = followerDir
+	follower, err := OpenFollower(followerOpts, server.Addr().String())
+	assert.Nil(t, err)
+	assertReplicated(t, primary, follower)
+
+	// 实时写入，包括删除和事务
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, primary.Delete(utils.GetTestKey(i)))
+	}
+	wb, err := primary.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	for i := 1000; i < 1100; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.Nil(t, wb.Commit())
+	assertReplicated(t, primary, follower)
+	_, err = follower.DB().Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 从节点只读
+	assert.Equal(t, ErrDatabaseIsReadOnly, follower.DB().Put([]byte("key"), []byte("value")))
+	assert.Equal(t, ErrDatabaseIsReadOnly, follower.DB().Delete(utils.GetTestKey(200)))
+	assert.Equal(t, ErrDatabaseIsReadOnly, follower.DB().Merge())
+
+	status := follower.Status()
+	assert.True(t, status.Connected)
+	assert.Equal(t, status.PrimaryFileID, status.FileID)
+	assert.Equal(t, status.PrimaryOffset, status.Offset)
+
+	// 从节点重启后从本地的位置继续复制
+	assert.Nil(t, follower.Close())
+	for i := 2000; i < 2300; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	follower, err = OpenFollower(followerOpts, server.Addr().String())
+	defer destroyFollower(follower)
+	assert.Nil(t, err)
+	assertReplicated(t, primary, follower)
+}
+
+func TestDB_ReplicationPosition(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-primary")
+	opts.DirPath = dir
+	primary, err := Open(opts)
+	defer destroyDB(primary)
+	assert.Nil(t, err)
+	assert.Nil(t, primary.Put(utils.GetTestKey(1), utils.RandomValue(24)))
+
+	server, err := primary.StartReplication("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer server.Close()
+
+	// 从节点的数据比主节点更新，无法复制
+	followerOpts := opts
+	followerDir, _ := os.MkdirTemp("", "bitcask-go-replication-follower")
+	followerOpts.DirPath = followerDir
+	db, err := Open(followerOpts)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(24)))
+	}
+	assert.Nil(t, db.Close())
+
+	follower, err := OpenFollower(followerOpts, server.Addr().String())
+	defer destroyFollower(follower)
+	assert.Nil(t, err)
+	deadline := time.Now().Add(5 * time.Second)
+	for follower.Status().LastError == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ErrReplicationPosition, follower.Status().LastError)
+}
+
+func TestDB_ReplicationFollowerMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-replication-primary")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	primary, err := Open(opts)
+	defer destroyDB(primary)
+	assert.Nil(t, err)
+	server, err := primary.StartReplication("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer server.Close()
+
+	followerOpts := opts
+	followerDir, _ := os.MkdirTemp("", "bitcask-go-replication-follower")
+	followerOpts.DirPath = followerDir
+	follower, err := OpenFollower(followerOpts, server.Addr().String())
+	defer destroyFollower(follower)
+	assert.Nil(t, err)
+
+	// 覆盖和删除产生无效数据
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 300; i++ {
+			assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+		}
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, primary.Delete(utils.GetTestKey(i)))
+	}
+	assertReplicated(t, primary, follower)
+	sizeBefore, err := utils.DirSize(followerDir)
+	assert.Nil(t, err)
+
+	// merge期间继续复制，活跃文件保持和主节点一致
+	assert.Nil(t, follower.Merge())
+	for i := 300; i < 400; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assertReplicated(t, primary, follower)
+	status := follower.Status()
+	assert.Equal(t, status.PrimaryFileID, status.FileID)
+	assert.Equal(t, status.PrimaryOffset, status.Offset)
+
+	// 重启后安装merge的结果，从原来的位置继续复制
+	assert.Nil(t, follower.Close())
+	follower, err = OpenFollower(followerOpts, server.Addr().String())
+	assert.Nil(t, err)
+	for i := 400; i < 500; i++ {
+		assert.Nil(t, primary.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assertReplicated(t, primary, follower)
+	assert.Nil(t, follower.Status().LastError)
+	sizeAfter, err := utils.DirSize(followerDir)
+	assert.Nil(t, err)
+	assert.True(t, sizeAfter < sizeBefore)
+}
@@ -0,0 +1,296 @@
+package tiny_kvDB
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tiny-kvDB/data"
+	"tiny-kvDB/fio"
+	"tiny-kvDB/utils"
+)
+
+// RestoreOptions 时间点恢复的配置
+type RestoreOptions struct {
+	UpToSeq  uint64    // 只恢复序列号不大于UpToSeq的提交，0表示不限制
+	UpToTime time.Time // 只恢复在UpToTime及之前的提交，零值表示不限制
+	// 备份之后的数据文件所在的目录，可以是数据库的数据目录，也可以是之后的增量备份
+	// 同一个数据文件出现在多个目录中时使用最长的那一份
+	LogDirs []string
+}
+
+// 备份之后需要回放的一段数据文件
+type logSegment struct {
+	dir    string
+	fileID uint32
+	offset int64 // 从该位置开始回放，之前的部分已经包含在备份中
+	size   int64
+}
+
+// Restore 将backupDir中的备份恢复到targetDir，再按提交顺序回放LogDirs中备份之后的写入，直到UpToSeq或UpToTime
+// 恢复点之后的提交和没有完成的事务都会被跳过，恢复点不能早于备份本身
+// targetDir必须为空，恢复完成后可以直接用Open打开
+func Restore(backupDir, targetDir string, options RestoreOptions) error {
+	manifest, err := ReadBackupManifest(backupDir)
+	if err != nil {
+		return err
+	}
+	if (options.UpToSeq != 0 && options.UpToSeq < manifest.SeqNo) ||
+		(!options.UpToTime.IsZero() && options.UpToTime.Before(manifest.CreatedAt)) {
+		return ErrRestorePointBeforeBackup
+	}
+	if err := prepareBackupDir(targetDir); err != nil {
+		return err
+	}
+
+	// 备份中的文件原样拷贝，增量备份中没有拷贝的文件从之前的备份中找
+	backupSizes := make(map[uint32]int64)
+	for _, file := range manifest.Files {
+		dir := file.Dir
+		if dir == "" {
+			dir = backupDir
+		}
+		if err := utils.CopyFile(filepath.Join(dir, file.Name), filepath.Join(targetDir, file.Name), file.Size); err != nil {
+			return err
+		}
+		if fileID, ok := parseDataFileID(file.Name); ok {
+			backupSizes[fileID] = file.Size
+		}
+	}
+
+	segments, err := collectLogSegments(manifest, backupSizes, options.LogDirs)
+	if err != nil {
+		return err
+	}
+	seqNo, err := replayLogSegments(targetDir, segments, manifest.SeqNo, options)
+	if err != nil {
+		return err
+	}
+	return writeSeqNoFile(targetDir, seqNo)
+}
+
+// 找到LogDirs中备份之后的数据文件，按文件ID排序
+func collectLogSegments(manifest *BackupManifest, backupSizes map[uint32]int64, logDirs []string) ([]*logSegment, error) {
+	var maxBackupFileID uint32
+	for fileID := range backupSizes {
+		if fileID > maxBackupFileID {
+			maxBackupFileID = fileID
+		}
+	}
+
+	files := make(map[uint32]*logSegment)
+	for _, dir := range logDirs {
+		dirFiles, mergeFileID, err := listLogDirDataFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		// 备份之后发生了merge，merge重写了nonMergeFileID之前的文件，备份之后的部分数据文件已经被删除
+		merged := mergeFileID != manifest.MergeFileID
+		if merged && len(backupSizes) > 0 && mergeFileID > maxBackupFileID+1 {
+			return nil, ErrRestoreLogNotContinuous
+		}
+		for _, segment := range dirFiles {
+			if merged && segment.fileID < mergeFileID {
+				continue
+			}
+			if cur := files[segment.fileID]; cur == nil || segment.size > cur.size {
+				files[segment.fileID] = segment
+			}
+		}
+	}
+
+	var fileIDs []int
+	for fileID := range files {
+		fileIDs = append(fileIDs, int(fileID))
+	}
+	sort.Ints(fileIDs)
+
+	var segments []*logSegment
+	for _, fid := range fileIDs {
+		segment := files[uint32(fid)]
+		if size, ok := backupSizes[segment.fileID]; ok {
+			// 备份中的文件之后又追加了数据，只回放追加的部分
+			if segment.size > size {
+				segment.offset = size
+				segments = append(segments, segment)
+			}
+			continue
+		}
+		if len(backupSizes) > 0 && segment.fileID < maxBackupFileID {
+			continue
+		}
+		// 数据文件的ID是连续的，中间缺少文件说明丢失了部分写入
+		if len(segments) > 0 {
+			if last := segments[len(segments)-1].fileID; segment.fileID != last+1 {
+				return nil, ErrRestoreLogNotContinuous
+			}
+		} else if len(backupSizes) > 0 && segment.fileID != maxBackupFileID+1 {
+			return nil, ErrRestoreLogNotContinuous
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// 列出目录中的数据文件，目录是备份时以manifest为准
+func listLogDirDataFiles(dir string) ([]*logSegment, uint32, error) {
+	var segments []*logSegment
+	manifest, err := ReadBackupManifest(dir)
+	if err == nil {
+		for _, file := range manifest.Files {
+			fileID, ok := parseDataFileID(file.Name)
+			if !ok {
+				continue
+			}
+			fileDir := file.Dir
+			if fileDir == "" {
+				fileDir = dir
+			}
+			segments = append(segments, &logSegment{dir: fileDir, fileID: fileID, size: file.Size})
+		}
+		return segments, manifest.MergeFileID, nil
+	}
+	if err != ErrBackupManifestNotFound {
+		return nil, 0, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, entry := range entries {
+		fileID, ok := parseDataFileID(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, 0, err
+		}
+		segments = append(segments, &logSegment{dir: dir, fileID: fileID, size: info.Size()})
+	}
+	var mergeFileID uint32
+	if _, err := os.Stat(filepath.Join(dir, data.MergeFinishedFileName)); err == nil {
+		if mergeFileID, err = getNonMergeFileID(dir); err != nil {
+			return nil, 0, err
+		}
+	}
+	return segments, mergeFileID, nil
+}
+
+// 按提交顺序回放数据文件，遇到第一个超出恢复点的提交就停止，返回恢复到的序列号
+func replayLogSegments(targetDir string, segments []*logSegment, seqNo uint64, options RestoreOptions) (uint64, error) {
+	// 暂存事务的数据，事务完成时才写入
+	transactionRecords := make(map[uint64][][]byte)
+	var target *data.DataFile
+	defer func() {
+		if target != nil {
+			_ = target.Close()
+		}
+	}()
+
+	for i, segment := range segments {
+		if target != nil {
+			if err := target.Sync(); err != nil {
+				return 0, err
+			}
+			_ = target.Close()
+		}
+		var err error
+		if target, err = data.OpenDataFile(targetDir, segment.fileID, fio.StandardFileIO); err != nil {
+			return 0, err
+		}
+		source, err := data.OpenDataFile(segment.dir, segment.fileID, fio.StandardFileIO)
+		if err != nil {
+			return 0, err
+		}
+
+		stop, err := replayLogSegment(source, target, segment, i == len(segments)-1, transactionRecords, &seqNo, options)
+		_ = source.Close()
+		if err != nil {
+			return 0, err
+		}
+		if stop {
+			break
+		}
+	}
+	if target != nil {
+		if err := target.Sync(); err != nil {
+			return 0, err
+		}
+	}
+	return seqNo, nil
+}
+
+// 回放一个数据文件，返回true表示已经到达恢复点
+func replayLogSegment(source, target *data.DataFile, segment *logSegment, last bool,
+	transactionRecords map[uint64][][]byte, seqNo *uint64, options RestoreOptions) (bool, error) {
+	offset := segment.offset
+	for offset < segment.size {
+		logRecord, size, err := source.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// 最后一个文件可能还在写入，末尾不完整的记录不回放
+			if err == data.ErrInvalidCRC && last {
+				break
+			}
+			return false, err
+		}
+		offset += size
+
+		_, recordSeqNo := parseLogRecordKey(logRecord.Key)
+		encRecord, _ := data.EncodeLogRecord(logRecord)
+		if recordSeqNo != nonTransactionSeqNo && !logRecord.AutoCommit && logRecord.Type != data.LogRecordTxnFinished {
+			transactionRecords[recordSeqNo] = append(transactionRecords[recordSeqNo], encRecord)
+			continue
+		}
+
+		// 一次完整的提交，超出恢复点时停止，之后的提交都不会回放
+		if !options.includes(recordSeqNo, logRecord.Timestamp) {
+			return true, nil
+		}
+		if logRecord.Type == data.LogRecordTxnFinished {
+			for _, buf := range transactionRecords[recordSeqNo] {
+				if err := target.Write(buf); err != nil {
+					return false, err
+				}
+			}
+			delete(transactionRecords, recordSeqNo)
+		}
+		if err := target.Write(encRecord); err != nil {
+			return false, err
+		}
+		if recordSeqNo > *seqNo {
+			*seqNo = recordSeqNo
+		}
+	}
+	return false, nil
+}
+
+// 提交是否在恢复点之前，旧版本写入的记录没有序列号和写入时间，总是回放
+func (options RestoreOptions) includes(seqNo uint64, timestamp int64) bool {
+	if options.UpToSeq != 0 && seqNo > options.UpToSeq {
+		return false
+	}
+	if !options.UpToTime.IsZero() && timestamp != 0 && timestamp > options.UpToTime.UnixNano() {
+		return false
+	}
+	return true
+}
+
+// 解析数据文件名中的文件ID
+func parseDataFileID(name string) (uint32, bool) {
+	if !strings.HasSuffix(name, data.DataFileNameSuffix) {
+		return 0, false
+	}
+	fileID, err := strconv.ParseUint(strings.TrimSuffix(name, data.DataFileNameSuffix), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(fileID), true
+}
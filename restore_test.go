@@ -0,0 +1,132 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+	"tiny-kvDB/data"
+	"tiny-kvDB/utils"
+)
+
+func openRestored(t *testing.T, dir string) *DB {
+	opts := DefaultOptions
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	return db
+}
+
+func TestRestore(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-restore")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("v1")))
+	}
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-restore-backup")
+	defer os.RemoveAll(backupDir)
+	assert.Nil(t, db.Backup(backupDir))
+
+	// 备份之后的写入，之后有一次错误的写入
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("v2")))
+	}
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.GetTestKey(2000), []byte("batch")))
+	assert.Nil(t, wb.Delete(utils.GetTestKey(0)))
+	assert.Nil(t, wb.Commit())
+	goodSeq := db.LastSeq()
+	time.Sleep(10 * time.Millisecond)
+	goodTime := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("corrupted")))
+	}
+
+	check := func(restored *DB) {
+		defer restored.Close()
+		assert.Equal(t, goodSeq, restored.LastSeq())
+		for i := 1; i < 1000; i++ {
+			value, err := restored.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, []byte("v2"), value)
+		}
+		_, err := restored.Get(utils.GetTestKey(0))
+		assert.Equal(t, ErrKeyNotFound, err)
+		value, err := restored.Get(utils.GetTestKey(2000))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("batch"), value)
+	}
+
+	// 恢复到指定的序列号
+	target, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(target)
+	assert.Nil(t, Restore(backupDir, target, RestoreOptions{UpToSeq: goodSeq, LogDirs: []string{dir}}))
+	check(openRestored(t, target))
+
+	// 恢复到指定的时间点
+	target2, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(target2)
+	assert.Nil(t, Restore(backupDir, target2, RestoreOptions{UpToTime: goodTime, LogDirs: []string{dir}}))
+	check(openRestored(t, target2))
+
+	// 不指定日志目录时只恢复备份本身
+	target3, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(target3)
+	assert.Nil(t, Restore(backupDir, target3, RestoreOptions{}))
+	restored := openRestored(t, target3)
+	value, err := restored.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+	assert.Nil(t, restored.Close())
+
+	// 恢复点不能早于备份
+	target4, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(target4)
+	assert.Equal(t, ErrRestorePointBeforeBackup, Restore(backupDir, target4, RestoreOptions{UpToSeq: 10}))
+}
+
+func TestRestore_PartialBatch(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-restore")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("key"), []byte("v1")))
+
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-restore-backup")
+	defer os.RemoveAll(backupDir)
+	assert.Nil(t, db.Backup(backupDir))
+
+	// 模拟只写入了一半的事务：数据记录已经写入，没有事务完成的记录
+	assert.Nil(t, db.Put([]byte("key"), []byte("v2")))
+	db.mu.Lock()
+	seqNo := db.seqNo + 1
+	_, err = db.appendLogRecord(&data.LogRecord{
+		Key:       logRecordKeyWithSeq([]byte("key"), seqNo),
+		Value:     []byte("partial"),
+		Type:      data.LogRecordNormal,
+		Timestamp: time.Now().UnixNano(),
+	})
+	db.mu.Unlock()
+	assert.Nil(t, err)
+
+	target, _ := os.MkdirTemp("", "bitcask-go-restore-target")
+	defer os.RemoveAll(target)
+	assert.Nil(t, Restore(backupDir, target, RestoreOptions{LogDirs: []string{dir}}))
+	restored := openRestored(t, target)
+	defer restored.Close()
+	value, err := restored.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	// 没有完成的事务没有被回放
+	assert.Equal(t, seqNo-1, restored.LastSeq())
+}
@@ -9,16 +9,20 @@ import (
 
 func TestBTree_Delete(t *testing.T) {
 	bt := index.NewBTree()
-	res1 := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	res1, err := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	res2, ok := bt.Delete(nil)
+	res2, ok, err := bt.Delete(nil)
+	assert.Nil(t, err)
 	assert.NotNil(t, res2)
 	assert.Equal(t, true, ok)
 
-	res3 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 2, Offset: 100})
+	res3, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 2, Offset: 100})
+	assert.Nil(t, err)
 	assert.Nil(t, res3)
-	res4, ok := bt.Delete([]byte("a"))
+	res4, ok, err := bt.Delete([]byte("a"))
+	assert.Nil(t, err)
 	assert.True(t, ok)
 	assert.Equal(t, uint32(2), res4.Fid)
 	assert.Equal(t, int64(100), res4.Offset)
@@ -27,22 +31,27 @@ func TestBTree_Delete(t *testing.T) {
 func TestBTree_Get(t *testing.T) {
 	bt := index.NewBTree()
 
-	res1 := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	res1, err := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	item1 := bt.Get(nil)
+	item1, err := bt.Get(nil)
+	assert.Nil(t, err)
 	assert.Equal(t, uint32(1), item1.Fid)
 	assert.Equal(t, int64(100), item1.Offset)
 
-	res2 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	res2, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	assert.Nil(t, err)
 	assert.Nil(t, res2)
 
-	res3 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+	res3, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+	assert.Nil(t, err)
 	assert.NotNil(t, res3)
 	assert.Equal(t, uint32(1), res3.Fid)
 	assert.Equal(t, int64(2), res3.Offset)
 
-	item2 := bt.Get([]byte("a"))
+	item2, err := bt.Get([]byte("a"))
+	assert.Nil(t, err)
 	assert.Equal(t, uint32(1), item2.Fid)
 	assert.Equal(t, int64(3), item2.Offset)
 
@@ -50,15 +59,18 @@ func TestBTree_Get(t *testing.T) {
 
 func TestBTree_Put(t *testing.T) {
 	bt := index.NewBTree()
-	res1 := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	res1, err := bt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, err)
 	assert.Nil(t, res1)
 
-	res2 := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	res2, err := bt.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	assert.Nil(t, err)
 	assert.Nil(t, res2)
 
-	res3 := bt.Put([]byte("a"), &data.LogRecordPos{
+	res3, err := bt.Put([]byte("a"), &data.LogRecordPos{
 		Fid: 2, Offset: 3,
 	})
+	assert.Nil(t, err)
 	assert.Equal(t, uint32(1), res3.Fid)
 	assert.Equal(t, int64(2), res3.Offset)
 }
@@ -66,12 +78,14 @@ func TestBTree_Put(t *testing.T) {
 func TestBtree_Iterator(t *testing.T) {
 	bt1 := index.NewBTree()
 	// bt1为空的情况
-	iter1 := bt1.Iterator(false)
+	iter1, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	assert.Equal(t, false, iter1.Valid())
 
 	// Btree有数据的情况
 	bt1.Put([]byte("code"), &data.LogRecordPos{Fid: 1, Offset: 10})
-	iter2 := bt1.Iterator(false)
+	iter2, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	assert.Equal(t, true, iter2.Valid())
 	assert.NotNil(t, iter2.Key())
 	assert.NotNil(t, iter2.Value())
@@ -82,23 +96,27 @@ func TestBtree_Iterator(t *testing.T) {
 	bt1.Put([]byte("aaa"), &data.LogRecordPos{Fid: 1, Offset: 10})
 	bt1.Put([]byte("bbb"), &data.LogRecordPos{Fid: 1, Offset: 10})
 	bt1.Put([]byte("ccc"), &data.LogRecordPos{Fid: 1, Offset: 10})
-	iter3 := bt1.Iterator(false)
+	iter3, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	for iter3.Rewind(); iter3.Valid(); iter3.Next() {
 		assert.NotNil(t, iter3.Key())
 	}
-	iter4 := bt1.Iterator(true)
+	iter4, err := bt1.Iterator(true)
+	assert.Nil(t, err)
 	for iter4.Rewind(); iter4.Valid(); iter4.Next() {
 		assert.NotNil(t, iter4.Key())
 	}
 
 	// 测试seek
-	iter5 := bt1.Iterator(false)
+	iter5, err := bt1.Iterator(false)
+	assert.Nil(t, err)
 	for iter5.Seek([]byte("bb")); iter5.Valid(); iter5.Next() {
 		assert.NotNil(t, iter5.Key())
 	}
 
 	// 反向遍历的情况
-	iter6 := bt1.Iterator(true)
+	iter6, err := bt1.Iterator(true)
+	assert.Nil(t, err)
 	for iter6.Seek([]byte("bb")); iter6.Valid(); iter6.Next() {
 		assert.NotNil(t, iter6.Key())
 	}
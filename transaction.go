@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"sync"
 	"sync/atomic"
+	"time"
 	"tiny-kvDB/data"
 )
 
@@ -19,18 +20,18 @@ type WriteBatch struct {
 }
 
 // NewWriteBatch 初始化WriteBatch
-func (db *DB) NewWriteBatch(opt WriteBatchOptions) *WriteBatch {
+func (db *DB) NewWriteBatch(opt WriteBatchOptions) (*WriteBatch, error) {
 	// 在B+树索引模式下，seqNo文件不存在，且不是第一次加载
 	// 此时无法执行事务操作
 	if db.options.IndexType == BPlusTree && !db.seqNoFileExists && !db.isInitial {
-		panic("can not use write batch, seq-no file not exists")
+		return nil, ErrWriteBatchUnavailable
 	}
 	return &WriteBatch{
 		options:       opt,
 		mu:            new(sync.Mutex),
 		db:            db,
 		pendingWrites: make(map[string]*data.LogRecord),
-	}
+	}, nil
 }
 
 // Put 批量写入数据
@@ -57,7 +58,10 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	defer wb.mu.Unlock()
 
 	// 数据不存在直接返回
-	logPos := wb.db.index.Get(key)
+	logPos, err := wb.db.index.Get(key)
+	if err != nil {
+		return err
+	}
 	if logPos == nil {
 		if wb.pendingWrites[string(key)] != nil {
 			delete(wb.pendingWrites, string(key))
@@ -73,17 +77,23 @@ func (wb *WriteBatch) Delete(key []byte) error {
 
 // Commit 提交事务，将批量数据全部写入磁盘，更新内存索引
 func (wb *WriteBatch) Commit() error {
+	_, err := wb.CommitWithSeq()
+	return err
+}
+
+// CommitWithSeq 提交事务，返回本次提交的序列号，没有任何数据时不会提交，返回0
+func (wb *WriteBatch) CommitWithSeq() (uint64, error) {
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
 	// 当前无任何数据
 	if len(wb.pendingWrites) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	// 超过最大的配置的数量
 	if uint(len(wb.pendingWrites)) > wb.options.MaxBatchNum {
-		return ErrExceedMaxBatchNum
+		return 0, ErrExceedMaxBatchNum
 	}
 
 	// 加锁保证事务的串行化
@@ -91,50 +101,67 @@ func (wb *WriteBatch) Commit() error {
 	defer wb.db.mu.Unlock()
 	// 获取当前的事务序列号
 	seqNo := atomic.AddUint64(&wb.db.seqNo, 1)
+	// 事务中的记录使用同一个写入时间
+	timestamp := time.Now().UnixNano()
 
 	// 开始写到数据文件中
 	logPosMap := make(map[string]*data.LogRecordPos)
 	for _, record := range wb.pendingWrites {
 		logRecordPos, err := wb.db.appendLogRecord(&data.LogRecord{
-			Key:   logRecordKeyWithSeq(record.Key, seqNo),
-			Value: record.Value,
-			Type:  record.Type,
+			Key:       logRecordKeyWithSeq(record.Key, seqNo),
+			Value:     record.Value,
+			Type:      record.Type,
+			Timestamp: timestamp,
 		})
 		if err != nil {
-			return err
+			return 0, err
 		}
 		logPosMap[string(record.Key)] = logRecordPos
 	}
 
 	// 写一条标识事务完成的数据
-	finRecord := &data.LogRecord{Key: logRecordKeyWithSeq(txnFinKey, seqNo), Type: data.LogRecordTxnFinished}
+	finRecord := &data.LogRecord{
+		Key:       logRecordKeyWithSeq(txnFinKey, seqNo),
+		Type:      data.LogRecordTxnFinished,
+		Timestamp: timestamp,
+	}
 	if _, err := wb.db.appendLogRecord(finRecord); err != nil {
-		return err
+		return 0, err
 	}
 	// 根据配置文件决定是否持久化
 	if wb.options.SyncWrite && wb.db.activeFile != nil {
-		if err := wb.db.activeFile.Sync(); err != nil {
-			return err
+		if err := wb.db.syncActiveFile(); err != nil {
+			return 0, err
 		}
 	}
 
-	// 更新索引
+	// 更新索引，索引出错时事务已经写入数据文件，重启后会重新加载
+	changes := make([]*Change, 0, len(wb.pendingWrites))
 	for _, record := range wb.pendingWrites {
-		var oldPos *data.LogRecordPos
+		var (
+			oldPos *data.LogRecordPos
+			err    error
+		)
 		if record.Type == data.LogRecordNormal {
 			pos := logPosMap[string(record.Key)]
-			oldPos = wb.db.index.Put(record.Key, pos)
+			oldPos, err = wb.db.index.Put(record.Key, pos)
+			changes = append(changes, &Change{Type: ChangePut, Key: record.Key, Value: record.Value})
 		} else if record.Type == data.LogRecordDeleted {
-			oldPos, _ = wb.db.index.Delete(record.Key)
+			oldPos, _, err = wb.db.index.Delete(record.Key)
+			changes = append(changes, &Change{Type: ChangeDelete, Key: record.Key})
+		}
+		if err != nil {
+			return 0, err
 		}
 		if oldPos != nil {
 			wb.db.reclaimSize += int64(oldPos.Size)
 		}
 	}
+	wb.db.publish(seqNo, changes...)
 
 	// 清空暂存数据
 	wb.pendingWrites = make(map[string]*data.LogRecord)
-	return nil
+	return seqNo, nil
 }
 
 // 把key中加上seqNo
@@ -17,7 +17,8 @@ func TestDB_WriteBatch(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 
-	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 	value := utils.RandomValue(1)
 	err = wb.Put(utils.GetTestKey(1), value)
 	assert.Nil(t, err)
@@ -39,7 +40,8 @@ func TestDB_WriteBatch(t *testing.T) {
 	assert.Equal(t, value, val)
 
 	// 事务删除数据
-	wb2 := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb2, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 	err = wb2.Delete(utils.GetTestKey(1))
 	assert.Nil(t, err)
 	err = wb2.Commit()
@@ -64,7 +66,8 @@ func TestDB_WriteBatchRestart(t *testing.T) {
 	err = db.Put(utils.GetTestKey(1), utils.RandomValue(1))
 	assert.Nil(t, err)
 
-	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
 	value := utils.RandomValue(2)
 	err = wb.Put(utils.GetTestKey(2), value)
 	assert.Nil(t, err)
@@ -85,7 +88,8 @@ func TestDB_WriteBatchRestart(t *testing.T) {
 
 	db2, err := Open(opts)
 	assert.Nil(t, err)
-	assert.Equal(t, uint64(2), db2.seqNo)
+	// 一次Put和两次事务提交，各占一个序列号
+	assert.Equal(t, uint64(3), db2.seqNo)
 
 	val, err := db2.Get(utils.GetTestKey(1))
 	assert.Equal(t, ErrKeyNotFound, err)
@@ -120,6 +124,7 @@ func TestDB_WriteBatch3(t *testing.T) {
 	//err = db.Close()
 	//assert.Nil(t, err)
 
-	keys := db.ListKeys()
+	keys, err := db.ListKeys()
+	assert.Nil(t, err)
 	assert.Equal(t, 0, len(keys))
 }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -70,3 +71,21 @@ func CopyDir(src, dest string, exclude []string) error {
 	})
 	return nil
 }
+
+// CopyFile 拷贝src的前size个字节到dest，写入完成后持久化
+func CopyFile(src, dest string, size int64) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+	if _, err := io.CopyN(destFile, srcFile, size); err != nil {
+		return err
+	}
+	return destFile.Sync()
+}
@@ -1,14 +1,31 @@
 package utils
 
-import "strconv"
+import (
+	"encoding/binary"
+	"math"
+)
 
-// FloatFromBytes 从字节数组中转成float64
+// FloatFromBytes 从Float64ToBytes编码的字节数组中转成float64
 func FloatFromBytes(v []byte) float64 {
-	float, _ := strconv.ParseFloat(string(v), 64)
-	return float
+	bits := binary.BigEndian.Uint64(v)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
 }
 
-// Float64ToBytes 转成字符串再变成字节
+// Float64ToBytes 编码成8字节，编码结果的字节序和数值的大小顺序一致，可以直接用于key的范围查找
+// IEEE754的正数把符号位置1，负数所有位取反，再按大端序存放
 func Float64ToBytes(v float64) []byte {
-	return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, bits)
+	return buf
 }
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestFloat64ToBytes(t *testing.T) {
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -100.5, -1, -math.SmallestNonzeroFloat64, 0,
+		math.SmallestNonzeroFloat64, 0.5, 1, 100.5, math.MaxFloat64, math.Inf(1)}
+	for i, v := range values {
+		buf := Float64ToBytes(v)
+		assert.Equal(t, 8, len(buf))
+		assert.Equal(t, v, FloatFromBytes(buf))
+		// 编码后的字节序和数值顺序一致
+		if i > 0 {
+			assert.Equal(t, -1, bytes.Compare(Float64ToBytes(values[i-1]), buf))
+		}
+	}
+}
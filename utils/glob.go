@@ -0,0 +1,87 @@
+package utils
+
+// GlobMatch 判断str是否匹配redis风格的glob模式
+// *匹配任意个字符，?匹配一个字符，[abc]、[^abc]、[a-z]匹配字符集合，\转义下一个字符
+func GlobMatch(pattern, str []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// 合并连续的*
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if GlobMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			str = str[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			var matched bool
+			matched, pattern = matchClass(pattern[1:], str[0])
+			if !matched {
+				return false
+			}
+			str = str[1:]
+		default:
+			if pattern[0] == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(str) == 0
+}
+
+// matchClass 判断c是否在[]描述的字符集合中，pattern从[之后开始，返回结果和]之后剩余的模式
+func matchClass(pattern []byte, c byte) (bool, []byte) {
+	not := len(pattern) > 0 && pattern[0] == '^'
+	if not {
+		pattern = pattern[1:]
+	}
+	var matched bool
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) > 1:
+			if pattern[1] == c {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+			lo, hi := pattern[0], pattern[2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == c {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	// 跳过]，没有]时和redis一样视为集合到模式末尾结束
+	if len(pattern) > 0 {
+		pattern = pattern[1:]
+	}
+	return matched != not, pattern
+}
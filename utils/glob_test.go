@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, str string
+		match        bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"*:name", "user:1:name", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"abc", "abcd", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, GlobMatch([]byte(c.pattern), []byte(c.str)), "%s %s", c.pattern, c.str)
+	}
+}
@@ -0,0 +1,289 @@
+package tiny_kvDB
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+	"tiny-kvDB/data"
+)
+
+type ChangeType = byte
+
+const (
+	// ChangePut 写入
+	ChangePut ChangeType = iota
+	// ChangeDelete 删除
+	ChangeDelete
+	// ChangeMerge 写入merge操作数，Value为操作数
+	ChangeMerge
+)
+
+// Change 一次提交中对单个key的修改
+type Change struct {
+	Type  ChangeType
+	Key   []byte
+	Value []byte
+}
+
+// WatchEvent 一次提交产生的所有修改，WriteBatch的提交作为一个整体投递
+type WatchEvent struct {
+	SeqNo   uint64 // 提交的序列号
+	Changes []*Change
+}
+
+// Watcher 订阅已提交的写入，按提交顺序投递事件
+type Watcher struct {
+	db      *DB
+	prefix  []byte
+	fromSeq uint64
+	events  chan *WatchEvent
+	done    chan struct{}
+	mu      *sync.Mutex
+	cond    *sync.Cond
+	pending []*WatchEvent // 重放期间以及消费者来不及处理时暂存的实时事件，数量不超过WatchPendingLimit
+	closed  bool
+	err     error
+}
+
+// Watch 订阅key前缀为prefix的已提交写入
+// 先从磁盘上的数据文件重放历史记录：从第一个序列号不小于fromSeq的提交开始，之后写入的所有记录都会按日志顺序重放，
+// fromSeq为0时重放全部历史记录；重放完成后继续投递新的提交，不会重复也不会遗漏
+// merge之后被清理掉的历史记录无法重放，旧版本写入的没有序列号的记录只按照在日志中的位置重放
+// 暂存的实时事件达到WatchPendingLimit时，WatchBlockOnFull为true则阻塞写入直到消费者跟上，
+// 阻塞期间写入持有db的锁，消费者在处理事件时不能访问同一个db；否则关闭订阅，Err返回ErrWatchPendingOverflow
+func (db *DB) Watch(prefix []byte, fromSeq uint64) (*Watcher, error) {
+	w := &Watcher{
+		db:      db,
+		prefix:  prefix,
+		fromSeq: fromSeq,
+		events:  make(chan *WatchEvent),
+		done:    make(chan struct{}),
+		mu:      new(sync.Mutex),
+	}
+	w.cond = sync.NewCond(w.mu)
+
+	// 注册订阅和确定重放的终点需要在同一把锁内完成，之后的提交都会通过实时事件投递
+	db.mu.Lock()
+	if db.isClosed {
+		db.mu.Unlock()
+		return nil, ErrDatabaseIsClosed
+	}
+	files := db.pinDataFiles()
+	var endFileID uint32
+	var endOffset int64
+	if db.activeFile != nil {
+		endFileID, endOffset = db.activeFile.FileID, db.activeFile.WriteOff
+	}
+	if db.watchers == nil {
+		db.watchers = make(map[*Watcher]struct{})
+	}
+	db.watchers[w] = struct{}{}
+	db.mu.Unlock()
+
+	go w.run(files, endFileID, endOffset)
+	return w, nil
+}
+
+// Events 返回事件通道，订阅关闭后通道会被关闭
+func (w *Watcher) Events() <-chan *WatchEvent {
+	return w.events
+}
+
+// Err 返回订阅因为出错而关闭的原因，包括重放历史记录时遇到的错误和暂存的事件超过上限
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close 取消订阅
+func (w *Watcher) Close() {
+	// 先关闭订阅，唤醒因为暂存的事件已满而阻塞的写入，之后才能拿到db.mu
+	w.stop()
+	w.db.mu.Lock()
+	delete(w.db.watchers, w)
+	w.db.mu.Unlock()
+}
+
+func (w *Watcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopLocked()
+}
+
+// 关闭订阅，调用方需要持有w.mu
+func (w *Watcher) stopLocked() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	close(w.done)
+	w.cond.Broadcast()
+}
+
+func (w *Watcher) run(files map[uint32]*data.DataFile, endFileID uint32, endOffset int64) {
+	defer close(w.events)
+	err := w.replay(files, endFileID, endOffset)
+	w.db.unpinDataFiles(files)
+	if err != nil {
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+		w.stop()
+		return
+	}
+
+	for {
+		w.mu.Lock()
+		for len(w.pending) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		event := w.pending[0]
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		// 唤醒等待暂存空间的写入
+		w.cond.Broadcast()
+		w.mu.Unlock()
+
+		if !w.send(event) {
+			return
+		}
+	}
+}
+
+// 重放数据文件中到(endFileID, endOffset)为止的已提交记录
+func (w *Watcher) replay(files map[uint32]*data.DataFile, endFileID uint32, endOffset int64) error {
+	var fileIDs []int
+	for fid := range files {
+		if fid <= endFileID {
+			fileIDs = append(fileIDs, int(fid))
+		}
+	}
+	sort.Ints(fileIDs)
+
+	// 暂存事务的数据
+	transactionRecords := make(map[uint64][]*Change)
+	started := w.fromSeq == 0
+	for _, fid := range fileIDs {
+		dataFile := files[uint32(fid)]
+		var offset int64 = 0
+		for uint32(fid) != endFileID || offset < endOffset {
+			logRecord, size, err := dataFile.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			offset += size
+
+			realKey, seqNo := parseLogRecordKey(logRecord.Key)
+			if logRecord.Type == data.LogRecordTxnFinished {
+				changes := transactionRecords[seqNo]
+				delete(transactionRecords, seqNo)
+				if !started && seqNo >= w.fromSeq {
+					started = true
+				}
+				if started && !w.send(&WatchEvent{SeqNo: seqNo, Changes: changes}) {
+					return nil
+				}
+				continue
+			}
+
+			change := logRecordToChange(realKey, logRecord)
+			if seqNo != nonTransactionSeqNo && !logRecord.AutoCommit {
+				transactionRecords[seqNo] = append(transactionRecords[seqNo], change)
+				continue
+			}
+			if !started && seqNo != nonTransactionSeqNo && seqNo >= w.fromSeq {
+				started = true
+			}
+			if started && !w.send(&WatchEvent{SeqNo: seqNo, Changes: []*Change{change}}) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// 按前缀过滤后投递事件，返回false表示订阅已经关闭
+func (w *Watcher) send(event *WatchEvent) bool {
+	if len(w.prefix) > 0 {
+		var changes []*Change
+		for _, change := range event.Changes {
+			if bytes.HasPrefix(change.Key, w.prefix) {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) == 0 {
+			return true
+		}
+		event = &WatchEvent{SeqNo: event.SeqNo, Changes: changes}
+	}
+	select {
+	case w.events <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func logRecordToChange(key []byte, logRecord *data.LogRecord) *Change {
+	change := &Change{Key: key, Value: logRecord.Value}
+	switch logRecord.Type {
+	case data.LogRecordDeleted:
+		change.Type = ChangeDelete
+	case data.LogRecordMerge:
+		change.Type = ChangeMerge
+		_, change.Value = data.DecodeMergeOperand(logRecord.Value)
+	default:
+		change.Type = ChangePut
+	}
+	return change
+}
+
+// publish 将一次提交投递给所有订阅者，调用方需要持有db.mu，保证事件顺序和提交顺序一致
+func (db *DB) publish(seqNo uint64, changes ...*Change) {
+	if len(db.watchers) == 0 {
+		return
+	}
+	// 调用方之后可能会修改传入的key和value
+	for _, change := range changes {
+		change.Key = append([]byte{}, change.Key...)
+		if change.Value != nil {
+			change.Value = append([]byte{}, change.Value...)
+		}
+	}
+	event := &WatchEvent{SeqNo: seqNo, Changes: changes}
+	for w := range db.watchers {
+		w.mu.Lock()
+		for db.options.WatchBlockOnFull && !w.closed && len(w.pending) >= db.options.WatchPendingLimit {
+			w.cond.Wait()
+		}
+		switch {
+		case w.closed:
+		case len(w.pending) >= db.options.WatchPendingLimit:
+			// 消费者跟不上写入，关闭订阅，避免暂存的事件无限增长
+			w.err = ErrWatchPendingOverflow
+			w.stopLocked()
+			delete(db.watchers, w)
+		default:
+			w.pending = append(w.pending, event)
+			w.cond.Broadcast()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// 关闭所有订阅，调用方需要持有db.mu
+func (db *DB) closeWatchers() {
+	for w := range db.watchers {
+		w.stop()
+	}
+	db.watchers = nil
+}
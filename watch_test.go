@@ -0,0 +1,229 @@
+package tiny_kvDB
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+	"tiny-kvDB/utils"
+)
+
+// 从订阅中读取下一个事件
+func nextWatchEvent(t *testing.T, w *Watcher) *WatchEvent {
+	select {
+	case event, ok := <-w.Events():
+		assert.True(t, ok)
+		return event
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait watch event timeout")
+	}
+	return nil
+}
+
+func TestDB_Watch(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w, err := db.Watch([]byte("bitcask-go-key"), 0)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	// 单条写入和删除
+	assert.Nil(t, db.Put(utils.GetTestKey(1), []byte("v1")))
+	assert.Nil(t, db.Put([]byte("other-key"), []byte("v")))
+	assert.Nil(t, db.Delete(utils.GetTestKey(1)))
+
+	event := nextWatchEvent(t, w)
+	assert.Equal(t, 1, len(event.Changes))
+	assert.Equal(t, ChangePut, event.Changes[0].Type)
+	assert.Equal(t, utils.GetTestKey(1), event.Changes[0].Key)
+	assert.Equal(t, []byte("v1"), event.Changes[0].Value)
+
+	// 不满足前缀的写入被过滤
+	event = nextWatchEvent(t, w)
+	assert.Equal(t, ChangeDelete, event.Changes[0].Type)
+	assert.Equal(t, utils.GetTestKey(1), event.Changes[0].Key)
+
+	// 事务作为一个整体投递
+	wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, wb.Put(utils.GetTestKey(2), []byte("v2")))
+	assert.Nil(t, wb.Put(utils.GetTestKey(3), []byte("v3")))
+	assert.Nil(t, wb.Commit())
+	event = nextWatchEvent(t, w)
+	assert.Equal(t, 2, len(event.Changes))
+	assert.True(t, event.SeqNo > 0)
+}
+
+func TestDB_WatchReplay(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(64)))
+	}
+	var batchSeq uint64
+	for i := 0; i < 3; i++ {
+		wb, err := db.NewWriteBatch(DefaultWriteBatchOptions)
+		assert.Nil(t, err)
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), []byte("batch")))
+		assert.Nil(t, wb.Commit())
+		if i == 1 {
+			batchSeq = db.seqNo
+		}
+		assert.Nil(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+
+	// 从头重放所有历史记录，随后是新的写入
+	w, err := db.Watch(nil, 0)
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		event := nextWatchEvent(t, w)
+		assert.Equal(t, utils.GetTestKey(i), event.Changes[0].Key)
+	}
+	for i := 0; i < 3; i++ {
+		event := nextWatchEvent(t, w)
+		assert.Equal(t, []byte("batch"), event.Changes[0].Value)
+		event = nextWatchEvent(t, w)
+		assert.Equal(t, ChangeDelete, event.Changes[0].Type)
+	}
+	assert.Nil(t, db.Put([]byte("new-key"), []byte("new-value")))
+	event := nextWatchEvent(t, w)
+	assert.Equal(t, []byte("new-key"), event.Changes[0].Key)
+	w.Close()
+
+	// 从指定的序列号开始重放
+	w2, err := db.Watch(nil, batchSeq)
+	assert.Nil(t, err)
+	defer w2.Close()
+	event = nextWatchEvent(t, w2)
+	assert.Equal(t, batchSeq, event.SeqNo)
+	assert.Equal(t, []byte("batch"), event.Changes[0].Value)
+}
+
+// 非事务写入也可以从指定的序列号开始重放
+func TestDB_WatchFromSeq(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	var seqs []uint64
+	for i := 0; i < 10; i++ {
+		seq, err := db.PutWithSeq(utils.GetTestKey(i), utils.RandomValue(8))
+		assert.Nil(t, err)
+		seqs = append(seqs, seq)
+	}
+
+	w, err := db.Watch(nil, seqs[5])
+	assert.Nil(t, err)
+	defer w.Close()
+	for i := 5; i < 10; i++ {
+		event := nextWatchEvent(t, w)
+		assert.Equal(t, seqs[i], event.SeqNo)
+		assert.Equal(t, utils.GetTestKey(i), event.Changes[0].Key)
+	}
+	seq, err := db.DeleteWithSeq(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	event := nextWatchEvent(t, w)
+	assert.Equal(t, seq, event.SeqNo)
+}
+
+func TestDB_WatchPendingOverflow(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch")
+	opts.DirPath = dir
+	opts.WatchPendingLimit = 10
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w, err := db.Watch(nil, 0)
+	assert.Nil(t, err)
+	defer w.Close()
+
+	// 消费者不读取事件，暂存的事件超过上限后订阅被关闭，写入不受影响
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("v")))
+	}
+	timeout := time.After(5 * time.Second)
+	for closed := false; !closed; {
+		select {
+		case _, ok := <-w.Events():
+			closed = !ok
+		case <-timeout:
+			t.Fatal("wait watcher closed timeout")
+		}
+	}
+	assert.Equal(t, ErrWatchPendingOverflow, w.Err())
+	assert.Nil(t, db.Put([]byte("key"), []byte("v")))
+
+	opts.WatchPendingLimit = 0
+	_, err = Open(opts)
+	assert.Equal(t, ErrWatchPendingLimitInvalid, err)
+}
+
+func TestDB_WatchBlockOnFull(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch")
+	opts.DirPath = dir
+	opts.WatchPendingLimit = 2
+	opts.WatchBlockOnFull = true
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w, err := db.Watch(nil, 0)
+	assert.Nil(t, err)
+
+	// 暂存的事件已满时写入被阻塞，消费者读取之后继续
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("v")))
+		}
+	}()
+	select {
+	case <-done:
+		t.Fatal("put should block when pending events are full")
+	case <-time.After(100 * time.Millisecond):
+	}
+	for i := 0; i < 20; i++ {
+		event := nextWatchEvent(t, w)
+		assert.Equal(t, utils.GetTestKey(i), event.Changes[0].Key)
+	}
+	<-done
+	assert.Nil(t, w.Err())
+
+	// 关闭订阅会唤醒被阻塞的写入
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			assert.Nil(t, db.Put(utils.GetTestKey(i), []byte("v")))
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	w.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("put is still blocked after the watcher is closed")
+	}
+}